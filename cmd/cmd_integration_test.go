@@ -38,6 +38,13 @@ func TestRootCmd_GlobalFlags(t *testing.T) {
 	if configFlag == nil {
 		t.Error("config flag not found")
 	}
+
+	// Test kubeconfig override flags
+	for _, name := range []string{"cluster", "user", "namespace"} {
+		if rootCmd.PersistentFlags().Lookup(name) == nil {
+			t.Errorf("%s flag not found", name)
+		}
+	}
 }
 
 // TestExportCmd_ValidateFlags tests flag validation logic
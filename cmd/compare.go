@@ -0,0 +1,334 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/davidschrooten/manifold-k8s/pkg/exporter"
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+// Report formats of the compare command
+const (
+	compareFormatText = "text"
+	compareFormatJSON = "json"
+	compareFormatHTML = "html"
+)
+
+var (
+	compareSource     string
+	compareTarget     string
+	compareNamespaces []string
+	compareResources  []string
+	compareAllRes     bool
+	compareIgnore     []string
+	compareFormat     string
+	compareOutput     string
+	compareStrict     bool
+)
+
+var compareCmd = &cobra.Command{
+	Use:   "compare",
+	Short: "Compare the manifests of two contexts",
+	Long: `Compare the same namespaces and resource types between two contexts, e.g. staging and prod.
+
+Objects are read from both clusters in memory and cleaned the same way as during export.
+Fields that are expected to differ, such as replica counts or image tags, can be left out
+with --ignore. The report lists modified objects with their diff and the objects that only
+exist in one of the contexts, as text, JSON or HTML.
+
+Ignore paths are dotted field paths; "*" matches every map key or list element.
+
+Examples:
+  manifold-k8s compare --source staging --target prod -n payments -r deployments,services,configmaps
+  manifold-k8s compare --source staging --target prod -n payments -a --ignore spec.replicas,spec.template.spec.containers.*.image
+  manifold-k8s compare --source staging --target prod -n payments -a --output-format html -o report.html`,
+	RunE: runCompare,
+}
+
+func init() {
+	rootCmd.AddCommand(compareCmd)
+
+	compareCmd.Flags().StringVar(&compareSource, "source", "", "kubernetes context to compare from (required)")
+	compareCmd.Flags().StringVar(&compareTarget, "target", "", "kubernetes context to compare with (required)")
+	compareCmd.Flags().StringSliceVarP(&compareNamespaces, "namespaces", "n", nil, "namespaces to compare (comma-separated, required)")
+	compareCmd.Flags().StringSliceVarP(&compareResources, "resources", "r", nil, "resource types to compare (comma-separated, e.g. deployments,services)")
+	compareCmd.Flags().BoolVarP(&compareAllRes, "all-resources", "a", false, "compare all resource types")
+	compareCmd.Flags().StringSliceVar(&compareIgnore, "ignore", nil, "field paths to leave out of the comparison (comma-separated, e.g. spec.replicas)")
+	compareCmd.Flags().StringVar(&compareFormat, "output-format", compareFormatText, "report format: text, json or html")
+	compareCmd.Flags().StringVarP(&compareOutput, "output", "o", "", "file to write the report to (default is stdout)")
+	compareCmd.Flags().BoolVar(&compareStrict, "strict", false, "fail when some API groups cannot be discovered")
+
+	_ = compareCmd.MarkFlagRequired("source")
+	_ = compareCmd.MarkFlagRequired("target")
+	_ = compareCmd.MarkFlagRequired("namespaces")
+}
+
+// compareReport is the JSON form of a comparison
+type compareReport struct {
+	Source        string          `json:"source"`
+	Target        string          `json:"target"`
+	Namespaces    []string        `json:"namespaces"`
+	ResourceTypes []string        `json:"resourceTypes"`
+	IgnorePaths   []string        `json:"ignorePaths,omitempty"`
+	Summary       compareSummary  `json:"summary"`
+	Modified      []compareObject `json:"modified"`
+	OnlyInSource  []string        `json:"onlyInSource"`
+	OnlyInTarget  []string        `json:"onlyInTarget"`
+}
+
+// compareSummary counts the objects per outcome
+type compareSummary struct {
+	Modified     int `json:"modified"`
+	OnlyInSource int `json:"onlyInSource"`
+	OnlyInTarget int `json:"onlyInTarget"`
+	Identical    int `json:"identical"`
+}
+
+// compareObject is an object that differs between the contexts
+type compareObject struct {
+	Object string `json:"object"`
+	Diff   string `json:"diff"`
+}
+
+func runCompare(cmd *cobra.Command, args []string) error {
+	ctx := context.Background()
+
+	if err := validateExportFlags(compareAllRes, compareResources); err != nil {
+		return err
+	}
+	if compareFormat != compareFormatText && compareFormat != compareFormatJSON && compareFormat != compareFormatHTML {
+		return fmt.Errorf("invalid output format %q (must be %s, %s or %s)", compareFormat, compareFormatText, compareFormatJSON, compareFormatHTML)
+	}
+	if err := exporter.ValidatePaths(compareIgnore); err != nil {
+		return err
+	}
+	if compareSource == compareTarget {
+		return fmt.Errorf("--source and --target must be different contexts")
+	}
+
+	// Load kubeconfig
+	config, err := loadKubeConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load kubeconfig: %w", err)
+	}
+
+	// Progress goes to stderr so that a report written to stdout stays parseable
+	source, sourceTypes, sourceFailed, err := collectContextManifests(ctx, config, compareSource)
+	if err != nil {
+		return err
+	}
+	target, targetTypes, targetFailed, err := collectContextManifests(ctx, config, compareTarget)
+	if err != nil {
+		return err
+	}
+
+	// Pairs that could not be listed in either context are left out, since one side is unknown
+	resourceTypes := mergeResourceTypes(sourceTypes, targetTypes)
+	failed := make(map[string]error)
+	for key, err := range sourceFailed {
+		failed[key] = err
+	}
+	for key, err := range targetFailed {
+		failed[key] = err
+	}
+	source = scopeManifests(source, compareNamespaces, resourceTypes, failed)
+	target = scopeManifests(target, compareNamespaces, resourceTypes, failed)
+
+	result, err := exporter.CompareManifests(source, target, exporter.CompareOptions{
+		FromLabel:   compareSource,
+		ToLabel:     compareTarget,
+		IgnorePaths: compareIgnore,
+	})
+	if err != nil {
+		return err
+	}
+
+	report := newCompareReport(result, resourceTypes)
+
+	out := io.Writer(os.Stdout)
+	if compareOutput != "" {
+		file, err := os.Create(compareOutput)
+		if err != nil {
+			return fmt.Errorf("failed to create report file: %w", err)
+		}
+		defer func() { _ = file.Close() }()
+		out = file
+	}
+
+	if err := writeCompareReport(out, result, report, compareFormat); err != nil {
+		return err
+	}
+	if compareOutput != "" {
+		fmt.Fprintf(os.Stderr, "✓ Wrote %s report to %s\n", compareFormat, compareOutput)
+	}
+	return listFailureError(failed, len(source)+len(target))
+}
+
+// collectContextManifests reads the compared namespaces and resource types from one context
+// It returns the objects, the resource types that exist in the context and the pairs that could not be listed.
+func collectContextManifests(ctx context.Context, config *api.Config, contextName string) (map[exporter.ManifestKey]*unstructured.Unstructured, []string, map[string]error, error) {
+	client, err := newClient(config, contextName)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to create client for context %s: %w", contextName, err)
+	}
+	fmt.Fprintf(os.Stderr, "Reading context %s as %s\n", contextName, client.Identity())
+
+	discovered, err := discoverResources(client)
+	if err := checkDiscoveryError(client.Logger(), err, compareStrict); err != nil {
+		return nil, nil, nil, withExitCode(exitDiscoveryFailure, fmt.Errorf("failed to discover resources in context %s: %w", contextName, err))
+	}
+
+	resources := discovered
+	if !compareAllRes {
+		var notFound []string
+		resources, notFound = selectRequestedResources(buildResourceMap(discovered), compareResources)
+		for _, resName := range notFound {
+			client.Logger().Warn("resource type not found in cluster", "resource", resName)
+		}
+	}
+
+	var resourceTypes []string
+	for _, resource := range resources {
+		if resource.Namespaced {
+			resourceTypes = append(resourceTypes, resource.Name)
+		}
+	}
+
+	manifests, failed := collectManifests(ctx, client, resources, compareNamespaces)
+	return manifests, resourceTypes, failed, nil
+}
+
+// mergeResourceTypes returns the resource types of both contexts, in order and without duplicates
+func mergeResourceTypes(source, target []string) []string {
+	seen := make(map[string]bool)
+	var merged []string
+	for _, resourceType := range append(append([]string{}, source...), target...) {
+		if !seen[resourceType] {
+			seen[resourceType] = true
+			merged = append(merged, resourceType)
+		}
+	}
+	return merged
+}
+
+// newCompareReport converts a comparison result into its report form
+func newCompareReport(result *exporter.DiffResult, resourceTypes []string) compareReport {
+	report := compareReport{
+		Source:        compareSource,
+		Target:        compareTarget,
+		Namespaces:    compareNamespaces,
+		ResourceTypes: resourceTypes,
+		IgnorePaths:   compareIgnore,
+		Summary: compareSummary{
+			Modified:     len(result.Modified),
+			OnlyInSource: len(result.Removed),
+			OnlyInTarget: len(result.Added),
+			Identical:    result.Unchanged,
+		},
+		Modified:     []compareObject{},
+		OnlyInSource: []string{},
+		OnlyInTarget: []string{},
+	}
+	for _, diff := range result.Modified {
+		report.Modified = append(report.Modified, compareObject{Object: diff.Key.String(), Diff: diff.Diff})
+	}
+	for _, key := range result.Removed {
+		report.OnlyInSource = append(report.OnlyInSource, key.String())
+	}
+	for _, key := range result.Added {
+		report.OnlyInTarget = append(report.OnlyInTarget, key.String())
+	}
+	return report
+}
+
+// writeCompareReport writes the comparison in the given format
+func writeCompareReport(w io.Writer, result *exporter.DiffResult, report compareReport, format string) error {
+	switch format {
+	case compareFormatJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(report)
+	case compareFormatHTML:
+		return compareHTMLTemplate.Execute(w, report)
+	default:
+		_, err := fmt.Fprintf(w, "Comparing %s with %s\n\n%s", report.Source, report.Target, formatDiffResult(result, report.Target, report.Source))
+		if err == nil && !result.HasDrift() {
+			_, err = fmt.Fprintf(w, "✓ No differences: %d object(s) are identical\n", result.Unchanged)
+		}
+		return err
+	}
+}
+
+// diffLineClass returns the CSS class of a unified diff line
+func diffLineClass(line string) string {
+	switch {
+	case strings.HasPrefix(line, "+++"), strings.HasPrefix(line, "---"):
+		return "file"
+	case strings.HasPrefix(line, "@@"):
+		return "hunk"
+	case strings.HasPrefix(line, "+"):
+		return "add"
+	case strings.HasPrefix(line, "-"):
+		return "del"
+	}
+	return "context"
+}
+
+var compareHTMLTemplate = template.Must(template.New("compare").Funcs(template.FuncMap{
+	"lines":     func(s string) []string { return strings.Split(strings.TrimSuffix(s, "\n"), "\n") },
+	"lineClass": diffLineClass,
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Source}} vs {{.Target}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; }
+td, th { border: 1px solid #ccc; padding: 4px 12px; text-align: left; }
+pre { background: #f6f8fa; padding: 8px; overflow-x: auto; }
+.add { color: #22863a; background: #f0fff4; }
+.del { color: #b31d28; background: #ffeef0; }
+.hunk { color: #6f42c1; }
+.file { font-weight: bold; }
+</style>
+</head>
+<body>
+<h1>{{.Source}} vs {{.Target}}</h1>
+<p>Namespaces: {{range $i, $ns := .Namespaces}}{{if $i}}, {{end}}{{$ns}}{{end}}</p>
+{{- if .IgnorePaths}}
+<p>Ignored paths: {{range $i, $p := .IgnorePaths}}{{if $i}}, {{end}}<code>{{$p}}</code>{{end}}</p>
+{{- end}}
+<table>
+<tr><th>Modified</th><td>{{.Summary.Modified}}</td></tr>
+<tr><th>Only in {{.Source}}</th><td>{{.Summary.OnlyInSource}}</td></tr>
+<tr><th>Only in {{.Target}}</th><td>{{.Summary.OnlyInTarget}}</td></tr>
+<tr><th>Identical</th><td>{{.Summary.Identical}}</td></tr>
+</table>
+{{- if .Modified}}
+<h2>Modified</h2>
+{{- range .Modified}}
+<h3>{{.Object}}</h3>
+<pre>{{range lines .Diff}}<span class="{{lineClass .}}">{{.}}</span>
+{{end}}</pre>
+{{- end}}
+{{- end}}
+{{- if .OnlyInSource}}
+<h2>Only in {{.Source}}</h2>
+<ul>{{range .OnlyInSource}}<li>{{.}}</li>{{end}}</ul>
+{{- end}}
+{{- if .OnlyInTarget}}
+<h2>Only in {{.Target}}</h2>
+<ul>{{range .OnlyInTarget}}<li>{{.}}</li>{{end}}</ul>
+{{- end}}
+</body>
+</html>
+`))
@@ -0,0 +1,292 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/davidschrooten/manifold-k8s/pkg/exporter"
+	"github.com/davidschrooten/manifold-k8s/pkg/k8s"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+// deploymentObject returns a deployment in the default namespace
+func deploymentObject(name string, replicas int64, image string) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "apps/v1",
+		"kind":       "Deployment",
+		"metadata":   map[string]interface{}{"name": name, "namespace": "default"},
+		"spec": map[string]interface{}{
+			"replicas": replicas,
+			"template": map[string]interface{}{"spec": map[string]interface{}{
+				"containers": []interface{}{map[string]interface{}{"name": name, "image": image}},
+			}},
+		},
+	}}
+}
+
+// fakeClientWith returns a client whose dynamic client serves the given objects
+func fakeClientWith(objects ...runtime.Object) *k8s.Client {
+	listKinds := map[schema.GroupVersionResource]string{
+		{Group: "apps", Version: "v1", Resource: "deployments"}: "DeploymentList",
+		{Version: "v1", Resource: "pods"}:                       "PodList",
+		{Version: "v1", Resource: "services"}:                   "ServiceList",
+	}
+	return &k8s.Client{
+		Clientset:     &kubernetes.Clientset{},
+		DynamicClient: dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), listKinds, objects...),
+	}
+}
+
+// stubCompareContexts serves different deployments from the staging and prod contexts
+func stubCompareContexts() {
+	enableStubs()
+	stubLoadKubeConfig = func(path string) (*api.Config, error) {
+		config := mockKubeConfig()
+		config.Contexts["staging"] = &api.Context{Cluster: "test-cluster", AuthInfo: "test-user"}
+		config.Contexts["prod"] = &api.Context{Cluster: "test-cluster", AuthInfo: "test-user"}
+		return config, nil
+	}
+	stubNewClient = func(config *api.Config, contextName string) (*k8s.Client, error) {
+		switch contextName {
+		case "staging":
+			return fakeClientWith(
+				deploymentObject("web", 1, "web:1.1"),
+				deploymentObject("api", 1, "api:2.0"),
+				deploymentObject("preview", 1, "preview:0.1"),
+			), nil
+		case "prod":
+			return fakeClientWith(
+				deploymentObject("web", 5, "web:1.0"),
+				deploymentObject("api", 3, "api:2.0"),
+				deploymentObject("legacy", 2, "legacy:9"),
+			), nil
+		}
+		return nil, fmt.Errorf("unknown context %s", contextName)
+	}
+}
+
+func resetCompareFlags() {
+	compareSource = ""
+	compareTarget = ""
+	compareNamespaces = nil
+	compareResources = nil
+	compareAllRes = false
+	compareIgnore = nil
+	compareFormat = compareFormatText
+	compareOutput = ""
+	compareStrict = false
+}
+
+func TestCompareCmd_Flags(t *testing.T) {
+	tests := []struct {
+		flagName string
+		wantType string
+	}{
+		{"source", "string"},
+		{"target", "string"},
+		{"namespaces", "stringSlice"},
+		{"resources", "stringSlice"},
+		{"all-resources", "bool"},
+		{"ignore", "stringSlice"},
+		{"output-format", "string"},
+		{"output", "string"},
+		{"strict", "bool"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.flagName, func(t *testing.T) {
+			flag := compareCmd.Flag(tt.flagName)
+			require.NotNil(t, flag, "flag %s not found", tt.flagName)
+			assert.Equal(t, tt.wantType, flag.Value.Type())
+		})
+	}
+}
+
+func TestRunCompare_JSON(t *testing.T) {
+	stubCompareContexts()
+	defer disableStubs()
+	defer resetCompareFlags()
+
+	reportPath := filepath.Join(t.TempDir(), "report.json")
+	compareSource = "staging"
+	compareTarget = "prod"
+	compareNamespaces = []string{"default"}
+	compareResources = []string{"deployments"}
+	compareIgnore = []string{"spec.replicas"}
+	compareFormat = compareFormatJSON
+	compareOutput = reportPath
+
+	require.NoError(t, runCompare(compareCmd, []string{}))
+
+	data, err := os.ReadFile(reportPath)
+	require.NoError(t, err)
+	var report compareReport
+	require.NoError(t, json.Unmarshal(data, &report))
+
+	assert.Equal(t, "staging", report.Source)
+	assert.Equal(t, "prod", report.Target)
+	assert.Equal(t, []string{"deployments"}, report.ResourceTypes)
+	assert.Equal(t, compareSummary{Modified: 1, OnlyInSource: 1, OnlyInTarget: 1, Identical: 1}, report.Summary)
+	assert.Equal(t, []string{"default/deployments/preview"}, report.OnlyInSource)
+	assert.Equal(t, []string{"default/deployments/legacy"}, report.OnlyInTarget)
+	require.Len(t, report.Modified, 1)
+	assert.Equal(t, "default/deployments/web", report.Modified[0].Object)
+	assert.Contains(t, report.Modified[0].Diff, "-      - image: web:1.1")
+	assert.NotContains(t, report.Modified[0].Diff, "replicas")
+}
+
+func TestRunCompare_IgnoreEverythingThatDiffers(t *testing.T) {
+	stubCompareContexts()
+	defer disableStubs()
+	defer resetCompareFlags()
+
+	reportPath := filepath.Join(t.TempDir(), "report.txt")
+	compareSource = "staging"
+	compareTarget = "prod"
+	compareNamespaces = []string{"default"}
+	compareResources = []string{"deployments"}
+	compareIgnore = []string{"spec.replicas", "spec.template.spec.containers.*.image"}
+	compareOutput = reportPath
+
+	require.NoError(t, runCompare(compareCmd, []string{}))
+
+	data, err := os.ReadFile(reportPath)
+	require.NoError(t, err)
+	report := string(data)
+	assert.Contains(t, report, "Comparing staging with prod")
+	assert.Contains(t, report, "Only in prod (1):\n  + default/deployments/legacy")
+	assert.Contains(t, report, "Only in staging (1):\n  - default/deployments/preview")
+	assert.Contains(t, report, "Drift: 0 modified, 1 added, 1 removed, 2 unchanged")
+}
+
+func TestRunCompare_HTML(t *testing.T) {
+	stubCompareContexts()
+	defer disableStubs()
+	defer resetCompareFlags()
+
+	reportPath := filepath.Join(t.TempDir(), "report.html")
+	compareSource = "staging"
+	compareTarget = "prod"
+	compareNamespaces = []string{"default"}
+	compareAllRes = true
+	compareFormat = compareFormatHTML
+	compareOutput = reportPath
+
+	// The mock discovery returns pods, deployments and services
+	require.NoError(t, runCompare(compareCmd, []string{}))
+
+	data, err := os.ReadFile(reportPath)
+	require.NoError(t, err)
+	report := string(data)
+	assert.True(t, strings.HasPrefix(report, "<!DOCTYPE html>"))
+	assert.Contains(t, report, "<h1>staging vs prod</h1>")
+	assert.Contains(t, report, "<h3>default/deployments/web</h3>")
+	assert.Contains(t, report, `<span class="del">-      - image: web:1.1</span>`)
+	assert.Contains(t, report, "<li>default/deployments/legacy</li>")
+}
+
+func TestRunCompare_InvalidOptions(t *testing.T) {
+	defer resetCompareFlags()
+
+	tests := []struct {
+		name    string
+		setup   func()
+		wantErr string
+	}{
+		{
+			name:    "no resources",
+			setup:   func() {},
+			wantErr: "either --resources or --all-resources is required",
+		},
+		{
+			name:    "invalid format",
+			setup:   func() { compareAllRes = true; compareFormat = "xml" },
+			wantErr: `invalid output format "xml" (must be text, json or html)`,
+		},
+		{
+			name:    "invalid ignore path",
+			setup:   func() { compareAllRes = true; compareIgnore = []string{"spec..replicas"} },
+			wantErr: `invalid field path "spec..replicas"`,
+		},
+		{
+			name:    "same context",
+			setup:   func() { compareAllRes = true; compareSource = "prod"; compareTarget = "prod" },
+			wantErr: "--source and --target must be different contexts",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetCompareFlags()
+			compareSource = "staging"
+			compareTarget = "prod"
+			tt.setup()
+			assert.EqualError(t, runCompare(compareCmd, []string{}), tt.wantErr)
+		})
+	}
+}
+
+func TestRunCompare_UnreachableContext(t *testing.T) {
+	stubCompareContexts()
+	defer disableStubs()
+	defer resetCompareFlags()
+
+	compareSource = "staging"
+	compareTarget = "missing"
+	compareNamespaces = []string{"default"}
+	compareResources = []string{"deployments"}
+
+	err := runCompare(compareCmd, []string{})
+	assert.ErrorContains(t, err, "failed to create client for context missing")
+}
+
+func TestRunCompare_StrictDiscovery(t *testing.T) {
+	stubCompareContexts()
+	defer disableStubs()
+	defer resetCompareFlags()
+
+	stubDiscoverResources = func(discovery.DiscoveryInterface) ([]k8s.ResourceInfo, error) {
+		return mockDiscoveredResources(), &k8s.PartialDiscoveryError{
+			Failures: []k8s.DiscoveryFailure{{GroupVersion: "metrics.k8s.io/v1beta1", Err: assert.AnError}},
+		}
+	}
+
+	compareSource = "staging"
+	compareTarget = "prod"
+	compareNamespaces = []string{"default"}
+	compareResources = []string{"deployments"}
+	compareStrict = true
+
+	err := runCompare(compareCmd, []string{})
+	assert.ErrorContains(t, err, "failed to discover resources in context staging")
+	assert.Equal(t, exitDiscoveryFailure, exitCode(err))
+}
+
+func TestMergeResourceTypes(t *testing.T) {
+	assert.Equal(t, []string{"deployments", "services", "widgets"}, mergeResourceTypes([]string{"deployments", "services"}, []string{"services", "widgets"}))
+}
+
+func TestNewCompareReport_EmptyListsAreArrays(t *testing.T) {
+	defer resetCompareFlags()
+	compareSource = "staging"
+	compareTarget = "prod"
+
+	report := newCompareReport(&exporter.DiffResult{Unchanged: 3}, []string{"deployments"})
+	data, err := json.Marshal(report)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"modified":[]`)
+	assert.Contains(t, string(data), `"onlyInSource":[]`)
+	assert.Contains(t, string(data), `"identical":3`)
+}
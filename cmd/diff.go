@@ -0,0 +1,232 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/davidschrooten/manifold-k8s/pkg/exporter"
+	"github.com/davidschrooten/manifold-k8s/pkg/k8s"
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+var (
+	diffDir        string
+	diffCtx        string
+	diffNamespaces []string
+	diffResources  []string
+	diffAllRes     bool
+	diffStrict     bool
+)
+
+var diffCmd = &cobra.Command{
+	Use:   "diff",
+	Short: "Compare an exported directory with the live cluster",
+	Long: `Compare a directory written by kubectl-manifests-export with the live cluster.
+
+Live objects are cleaned the same way as during export, so only meaningful changes are shown.
+Modified objects are printed as unified diffs, followed by the objects that only exist in the
+cluster or only in the export. The command exits 1 when drift is found, so it can gate CI, and
+with a code above 1 when the comparison fails.
+
+By default the namespaces and resource types found in the export directory are compared.
+
+Examples:
+  manifold-k8s diff --context prod --dir ./backup
+  manifold-k8s diff -c prod -d ./backup --namespaces payments --resources deployments,configmaps
+  manifold-k8s diff -c prod -d ./backup -n payments --all-resources`,
+	RunE: runDiff,
+}
+
+func init() {
+	rootCmd.AddCommand(diffCmd)
+
+	diffCmd.Flags().StringVarP(&diffDir, "dir", "d", "", "exported directory to compare (required)")
+	diffCmd.Flags().StringVarP(&diffCtx, "context", "c", "", "kubernetes context (required)")
+	diffCmd.Flags().StringSliceVarP(&diffNamespaces, "namespaces", "n", nil, "namespaces to compare (default: --namespace, or the namespaces in the export)")
+	diffCmd.Flags().StringSliceVarP(&diffResources, "resources", "r", nil, "resource types to compare (default: the resource types in the export)")
+	diffCmd.Flags().BoolVarP(&diffAllRes, "all-resources", "a", false, "compare all resource types, reporting everything missing from the export")
+	diffCmd.Flags().BoolVar(&diffStrict, "strict", false, "fail when some API groups cannot be discovered")
+
+	_ = diffCmd.MarkFlagRequired("dir")
+	_ = diffCmd.MarkFlagRequired("context")
+	diffCmd.MarkFlagsMutuallyExclusive("resources", "all-resources")
+}
+
+func runDiff(cmd *cobra.Command, args []string) error {
+	result, err := diffLive(context.Background())
+	if err != nil {
+		// Failures exit above 1, which is kept for drift
+		if exitCode(err) == exitError {
+			err = withExitCode(exitDiffFailed, err)
+		}
+		return err
+	}
+
+	if result.HasDrift() {
+		return withExitCode(exitDrift, fmt.Errorf("drift detected: %s", result.Summary()))
+	}
+	fmt.Printf("✓ No drift: %d object(s) match the export\n", result.Unchanged)
+	return nil
+}
+
+// diffLive compares the export directory with the live cluster and prints the differences
+func diffLive(ctx context.Context) (*exporter.DiffResult, error) {
+	exported, err := exporter.LoadExport(diffDir)
+	if err != nil {
+		return nil, err
+	}
+
+	// Load kubeconfig
+	config, err := loadKubeConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load kubeconfig: %w", err)
+	}
+
+	client, err := newClient(config, diffCtx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create client for context %s: %w", diffCtx, err)
+	}
+
+	fmt.Printf("Using context: %s\n", diffCtx)
+	fmt.Printf("Using identity: %s\n", client.Identity())
+
+	discovered, err := discoverResources(client)
+	if err := checkDiscoveryError(client.Logger(), err, diffStrict); err != nil {
+		return nil, withExitCode(exitDiscoveryFailure, fmt.Errorf("failed to discover resources: %w", err))
+	}
+
+	namespaces := namespacesOrDefault(diffNamespaces)
+	if len(namespaces) == 0 {
+		namespaces = exportedNamespaces(exported)
+	}
+
+	// Resource types missing from the cluster are still compared: their exported objects are removed
+	resourceTypes := diffResources
+	if len(resourceTypes) == 0 {
+		resourceTypes = exportedResourceTypes(exported, namespaces)
+	}
+	var resources []k8s.ResourceInfo
+	if diffAllRes {
+		resources = discovered
+		for _, resource := range discovered {
+			if !slices.Contains(resourceTypes, resource.Name) {
+				resourceTypes = append(resourceTypes, resource.Name)
+			}
+		}
+	} else {
+		var notFound []string
+		resources, notFound = selectRequestedResources(buildResourceMap(discovered), resourceTypes)
+		for _, resName := range notFound {
+			client.Logger().Warn("resource type not found in cluster", "resource", resName)
+		}
+	}
+
+	fmt.Printf("Comparing %d namespace(s) and %d resource type(s) with %s\n\n", len(namespaces), len(resourceTypes), diffDir)
+
+	live, failed := collectManifests(ctx, client, resources, namespaces)
+	exported = scopeManifests(exported, namespaces, resourceTypes, failed)
+
+	result, err := exporter.DiffManifests(exported, live)
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Print(formatDiffResult(result, "cluster", "export"))
+
+	// Pairs that could not be listed were left out, so the comparison is incomplete
+	if err := listFailureError(failed, len(live)); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// exportedNamespaces returns the sorted namespaces of an export
+func exportedNamespaces(manifests map[exporter.ManifestKey]*unstructured.Unstructured) []string {
+	seen := make(map[string]bool)
+	var namespaces []string
+	for key := range manifests {
+		if !seen[key.Namespace] {
+			seen[key.Namespace] = true
+			namespaces = append(namespaces, key.Namespace)
+		}
+	}
+	sort.Strings(namespaces)
+	return namespaces
+}
+
+// exportedResourceTypes returns the sorted resource types exported in the given namespaces
+func exportedResourceTypes(manifests map[exporter.ManifestKey]*unstructured.Unstructured, namespaces []string) []string {
+	inScope := make(map[string]bool, len(namespaces))
+	for _, namespace := range namespaces {
+		inScope[namespace] = true
+	}
+
+	seen := make(map[string]bool)
+	var resourceTypes []string
+	for key := range manifests {
+		if inScope[key.Namespace] && !seen[key.ResourceType] {
+			seen[key.ResourceType] = true
+			resourceTypes = append(resourceTypes, key.ResourceType)
+		}
+	}
+	sort.Strings(resourceTypes)
+	return resourceTypes
+}
+
+// scopeManifests keeps the manifests in the compared namespaces and resource types, dropping
+// resource/namespace pairs that could not be listed since their live state is unknown
+func scopeManifests(manifests map[exporter.ManifestKey]*unstructured.Unstructured, namespaces, resourceTypes []string, failed map[string]error) map[exporter.ManifestKey]*unstructured.Unstructured {
+	inNamespaces := make(map[string]bool, len(namespaces))
+	for _, namespace := range namespaces {
+		inNamespaces[namespace] = true
+	}
+	inTypes := make(map[string]bool, len(resourceTypes))
+	for _, resourceType := range resourceTypes {
+		inTypes[resourceType] = true
+	}
+
+	scoped := make(map[exporter.ManifestKey]*unstructured.Unstructured)
+	for key, obj := range manifests {
+		if inNamespaces[key.Namespace] && inTypes[key.ResourceType] && failed[accessKey(key.Namespace, key.ResourceType)] == nil {
+			scoped[key] = obj
+		}
+	}
+	return scoped
+}
+
+// formatDiffResult renders the diffs of modified objects followed by the added and removed objects
+// added names the side holding objects that are missing from the other, removed the opposite side.
+func formatDiffResult(result *exporter.DiffResult, added, removed string) string {
+	var sb strings.Builder
+
+	for _, diff := range result.Modified {
+		sb.WriteString(diff.Diff)
+		sb.WriteString("\n")
+	}
+
+	if len(result.Added) > 0 {
+		fmt.Fprintf(&sb, "Only in %s (%d):\n", added, len(result.Added))
+		for _, key := range result.Added {
+			fmt.Fprintf(&sb, "  + %s\n", key)
+		}
+		sb.WriteString("\n")
+	}
+
+	if len(result.Removed) > 0 {
+		fmt.Fprintf(&sb, "Only in %s (%d):\n", removed, len(result.Removed))
+		for _, key := range result.Removed {
+			fmt.Fprintf(&sb, "  - %s\n", key)
+		}
+		sb.WriteString("\n")
+	}
+
+	if result.HasDrift() {
+		fmt.Fprintf(&sb, "Drift: %s\n", result.Summary())
+	}
+
+	return sb.String()
+}
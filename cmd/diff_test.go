@@ -0,0 +1,251 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/davidschrooten/manifold-k8s/pkg/exporter"
+	"github.com/davidschrooten/manifold-k8s/pkg/k8s"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+// writeTestExport writes the objects served by the mock client into an export tree
+func writeTestExport(t *testing.T, dir string) {
+	t.Helper()
+	pod := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Pod",
+		"metadata":   map[string]interface{}{"name": "test-pod-1", "namespace": "default"},
+	}}
+	deployment := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "apps/v1",
+		"kind":       "Deployment",
+		"metadata":   map[string]interface{}{"name": "test-deployment-1", "namespace": "default"},
+	}}
+	require.NoError(t, exporter.WriteManifest(pod, exporter.GenerateFilePath(dir, "default", "pods", "test-pod-1")))
+	require.NoError(t, exporter.WriteManifest(deployment, exporter.GenerateFilePath(dir, "default", "deployments", "test-deployment-1")))
+}
+
+func resetDiffFlags() {
+	diffDir = ""
+	diffCtx = ""
+	diffNamespaces = nil
+	diffResources = nil
+	diffAllRes = false
+	diffStrict = false
+}
+
+func TestDiffCmd_Flags(t *testing.T) {
+	tests := []struct {
+		flagName string
+		wantType string
+	}{
+		{"dir", "string"},
+		{"context", "string"},
+		{"namespaces", "stringSlice"},
+		{"resources", "stringSlice"},
+		{"all-resources", "bool"},
+		{"strict", "bool"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.flagName, func(t *testing.T) {
+			flag := diffCmd.Flag(tt.flagName)
+			require.NotNil(t, flag, "flag %s not found", tt.flagName)
+			assert.Equal(t, tt.wantType, flag.Value.Type())
+		})
+	}
+}
+
+func TestDiffCmd_FlagErrorsAreNotDrift(t *testing.T) {
+	defer resetDiffFlags()
+	defer func() {
+		rootCmd.SetArgs(nil)
+		rootCmd.SetOut(nil)
+		rootCmd.SetErr(nil)
+		logger = slog.New(slog.DiscardHandler)
+	}()
+
+	var output bytes.Buffer
+	rootCmd.SetOut(&output)
+	rootCmd.SetErr(&output)
+
+	// cobra rejects these before runDiff; they still exit above 1, which is kept for drift
+	for _, args := range [][]string{{"diff"}, {"diff", "--context", "prod", "--bogus"}} {
+		rootCmd.SetArgs(args)
+		cmd, err := rootCmd.ExecuteC()
+		require.Error(t, err, "args %v", args)
+		assert.Equal(t, exitDiffFailed, commandExitCode(cmd, err), "args %v: %v", args, err)
+	}
+
+	// Drift and the codes set by runDiff are kept
+	assert.Equal(t, exitDrift, commandExitCode(diffCmd, withExitCode(exitDrift, errors.New("drift detected"))))
+	assert.Equal(t, exitPermissionDenied, commandExitCode(diffCmd, withExitCode(exitPermissionDenied, errors.New("forbidden"))))
+	assert.Equal(t, exitError, commandExitCode(exportCmd, errors.New("invalid flags")))
+}
+
+func TestRunDiff_NoDrift(t *testing.T) {
+	enableStubs()
+	defer disableStubs()
+	defer resetDiffFlags()
+
+	tmpDir := t.TempDir()
+	writeTestExport(t, tmpDir)
+
+	viper.Set("kubeconfig", "/fake/path")
+	diffDir = tmpDir
+	diffCtx = "test-context"
+
+	assert.NoError(t, runDiff(diffCmd, []string{}))
+}
+
+func TestRunDiff_Drift(t *testing.T) {
+	enableStubs()
+	defer disableStubs()
+	defer resetDiffFlags()
+
+	tmpDir := t.TempDir()
+	writeTestExport(t, tmpDir)
+
+	// The pod has been changed since the export and a configmap has been deleted
+	podPath := exporter.GenerateFilePath(tmpDir, "default", "pods", "test-pod-1")
+	require.NoError(t, os.WriteFile(podPath, []byte("apiVersion: v1\nkind: Pod\nmetadata:\n  name: test-pod-1\n  namespace: default\n  labels:\n    app: old\n"), 0644))
+	deletedPath := exporter.GenerateFilePath(tmpDir, "default", "pods", "deleted-pod")
+	require.NoError(t, os.WriteFile(deletedPath, []byte("apiVersion: v1\nkind: Pod\nmetadata:\n  name: deleted-pod\n  namespace: default\n"), 0644))
+
+	viper.Set("kubeconfig", "/fake/path")
+	diffDir = tmpDir
+	diffCtx = "test-context"
+
+	err := runDiff(diffCmd, []string{})
+	assert.EqualError(t, err, "drift detected: 1 modified, 0 added, 1 removed, 1 unchanged")
+	assert.Equal(t, exitDrift, exitCode(err))
+}
+
+func TestRunDiff_ListForbidden(t *testing.T) {
+	enableStubs()
+	defer disableStubs()
+	defer resetDiffFlags()
+
+	stubNewClient = func(config *api.Config, contextName string) (*k8s.Client, error) {
+		client := fakeClientWith()
+		client.DynamicClient.(*dynamicfake.FakeDynamicClient).PrependReactor("list", "deployments", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			return true, nil, apierrors.NewForbidden(schema.GroupResource{Group: "apps", Resource: "deployments"}, "", errors.New("denied"))
+		})
+		return client, nil
+	}
+
+	tmpDir := t.TempDir()
+	writeTestExport(t, tmpDir)
+
+	viper.Set("kubeconfig", "/fake/path")
+	diffDir = tmpDir
+	diffCtx = "test-context"
+
+	// A comparison missing a resource type fails with the permission error instead of drift
+	err := runDiff(diffCmd, []string{})
+	assert.EqualError(t, err, "failed to list 1 resource/namespace pair(s)")
+	assert.Equal(t, exitPermissionDenied, exitCode(err))
+}
+
+func TestRunDiff_StrictDiscovery(t *testing.T) {
+	enableStubs()
+	defer disableStubs()
+	defer resetDiffFlags()
+
+	stubDiscoverResources = func(discovery.DiscoveryInterface) ([]k8s.ResourceInfo, error) {
+		return mockDiscoveredResources(), &k8s.PartialDiscoveryError{
+			Failures: []k8s.DiscoveryFailure{{GroupVersion: "metrics.k8s.io/v1beta1", Err: assert.AnError}},
+		}
+	}
+
+	tmpDir := t.TempDir()
+	writeTestExport(t, tmpDir)
+
+	viper.Set("kubeconfig", "/fake/path")
+	diffDir = tmpDir
+	diffCtx = "test-context"
+	diffStrict = true
+
+	err := runDiff(diffCmd, []string{})
+	assert.ErrorContains(t, err, "metrics.k8s.io/v1beta1")
+	assert.Equal(t, exitDiscoveryFailure, exitCode(err))
+}
+
+func TestRunDiff_AllResourcesReportsAdded(t *testing.T) {
+	enableStubs()
+	defer disableStubs()
+	defer resetDiffFlags()
+
+	// Only the pod is exported, so the live deployment is reported as added
+	tmpDir := t.TempDir()
+	writeTestExport(t, tmpDir)
+	require.NoError(t, os.RemoveAll(filepath.Join(tmpDir, "default", "deployments")))
+
+	viper.Set("kubeconfig", "/fake/path")
+	diffDir = tmpDir
+	diffCtx = "test-context"
+	diffAllRes = true
+
+	err := runDiff(diffCmd, []string{})
+	assert.EqualError(t, err, "drift detected: 0 modified, 1 added, 0 removed, 1 unchanged")
+}
+
+func TestRunDiff_MissingDirectory(t *testing.T) {
+	defer resetDiffFlags()
+
+	diffDir = filepath.Join(t.TempDir(), "missing")
+	diffCtx = "test-context"
+
+	// A failed comparison exits above 1 so that it is not taken for drift
+	err := runDiff(diffCmd, []string{})
+	assert.ErrorContains(t, err, "failed to read export directory")
+	assert.Equal(t, exitDiffFailed, exitCode(err))
+}
+
+func TestScopeManifests(t *testing.T) {
+	manifests := map[exporter.ManifestKey]*unstructured.Unstructured{
+		{Namespace: "default", ResourceType: "pods", Name: "a"}:        {},
+		{Namespace: "default", ResourceType: "secrets", Name: "b"}:     {},
+		{Namespace: "kube-system", ResourceType: "pods", Name: "c"}:    {},
+		{Namespace: "default", ResourceType: "deployments", Name: "d"}: {},
+	}
+
+	assert.Equal(t, []string{"default", "kube-system"}, exportedNamespaces(manifests))
+	assert.Equal(t, []string{"deployments", "pods", "secrets"}, exportedResourceTypes(manifests, []string{"default"}))
+
+	failed := map[string]error{accessKey("default", "deployments"): errors.New("request timed out")}
+	scoped := scopeManifests(manifests, []string{"default"}, []string{"pods", "deployments"}, failed)
+	assert.Len(t, scoped, 1)
+	assert.Contains(t, scoped, exporter.ManifestKey{Namespace: "default", ResourceType: "pods", Name: "a"})
+}
+
+func TestFormatDiffResult(t *testing.T) {
+	result := &exporter.DiffResult{
+		Modified: []exporter.ObjectDiff{{Key: exporter.ManifestKey{Namespace: "default", ResourceType: "pods", Name: "a"}, Diff: "--- exported/default/pods/a.yaml\n"}},
+		Added:    []exporter.ManifestKey{{Namespace: "default", ResourceType: "pods", Name: "b"}},
+		Removed:  []exporter.ManifestKey{{Namespace: "default", ResourceType: "pods", Name: "c"}},
+	}
+
+	output := formatDiffResult(result, "cluster", "export")
+	assert.Contains(t, output, "--- exported/default/pods/a.yaml")
+	assert.Contains(t, output, "Only in cluster (1):\n  + default/pods/b")
+	assert.Contains(t, output, "Only in export (1):\n  - default/pods/c")
+	assert.Contains(t, output, "Drift: 1 modified, 1 added, 1 removed, 0 unchanged")
+
+	assert.Empty(t, formatDiffResult(&exporter.DiffResult{Unchanged: 2}, "cluster", "export"))
+}
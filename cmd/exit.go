@@ -0,0 +1,156 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/davidschrooten/manifold-k8s/pkg/k8s"
+	"github.com/spf13/cobra"
+)
+
+// Exit codes of the export commands, so that scripts can tell a partial backup from a failed one
+const (
+	exitOK               = 0
+	exitError            = 1 // the run failed, e.g. invalid flags or no reachable context
+	exitPartialFailure   = 2 // something was exported, but some objects, namespaces or contexts failed
+	exitPermissionDenied = 3 // the API server refused a request of the run
+	exitDiscoveryFailure = 4 // resource types could not be discovered
+	exitNothingExported  = 5 // the run exported nothing, with --fail-on warning
+)
+
+// Exit codes of diff, which like diff(1) and kubectl diff keep 1 for drift, so that a failed
+// comparison, including invalid flags, is not mistaken for one. Permission and discovery errors
+// keep their codes above.
+const (
+	exitDrift      = 1 // the live cluster differs from the export
+	exitDiffFailed = 2 // the comparison failed or is incomplete
+)
+
+// Values of --fail-on, the policy deciding which problems fail a run
+const (
+	failOnWarning = "warning"
+	failOnError   = "error"
+	failOnNever   = "never"
+)
+
+// exitCodeError is an error ending the process with a given exit code
+type exitCodeError struct {
+	code int
+	err  error
+}
+
+func (e *exitCodeError) Error() string {
+	return e.err.Error()
+}
+
+func (e *exitCodeError) Unwrap() error {
+	return e.err
+}
+
+// withExitCode sets the exit code of err
+func withExitCode(code int, err error) error {
+	return &exitCodeError{code: code, err: err}
+}
+
+// exitCode returns the process exit code for the error a command returned
+func exitCode(err error) int {
+	if err == nil {
+		return exitOK
+	}
+	var exitErr *exitCodeError
+	if errors.As(err, &exitErr) {
+		return exitErr.code
+	}
+	return exitError
+}
+
+// commandExitCode returns the process exit code for the error cmd returned
+// Errors of diff without an exit code of their own, such as a missing required flag that cobra
+// reports before runDiff, exit with exitDiffFailed rather than the exitError that means drift.
+func commandExitCode(cmd *cobra.Command, err error) int {
+	var exitErr *exitCodeError
+	if cmd == diffCmd && err != nil && !errors.As(err, &exitErr) {
+		return exitDiffFailed
+	}
+	return exitCode(err)
+}
+
+// validateFailOn checks the value of a --fail-on flag
+func validateFailOn(policy string) error {
+	switch policy {
+	case failOnWarning, failOnError, failOnNever:
+		return nil
+	default:
+		return fmt.Errorf("invalid --fail-on %q (must be %s, %s or %s)", policy, failOnWarning, failOnError, failOnNever)
+	}
+}
+
+// runError aggregates the problems of a whole run into the error it ends with under the
+// --fail-on policy. Failed contexts and errors logged for single objects or namespaces fail the
+// run unless the policy is never; warnings and skipped items fail it only with warning, as does
+// a run that exported nothing, which gets its own exit code.
+func runError(results []contextResult, run *contextReport, policy string) error {
+	if policy == failOnNever {
+		return nil
+	}
+
+	var errs []error
+	var exported, warnings int
+	var failedContexts int
+	reports := []*contextReport{run}
+	for _, result := range results {
+		if result.err != nil {
+			errs = append(errs, result.err)
+			failedContexts++
+		}
+		exported += result.exported
+		reports = append(reports, result.report)
+	}
+	for _, report := range reports {
+		if report == nil {
+			continue
+		}
+		errs = append(errs, report.errs...)
+		warnings += len(report.Warnings) + len(report.Skipped)
+	}
+
+	if len(errs) == 0 {
+		if policy != failOnWarning {
+			return nil
+		}
+		switch {
+		case exported == 0:
+			return withExitCode(exitNothingExported, errors.New("nothing was exported"))
+		case warnings > 0:
+			return withExitCode(exitPartialFailure, fmt.Errorf("%d warning(s) with --fail-on %s", warnings, failOnWarning))
+		}
+		return nil
+	}
+
+	// A failed context keeps its own message; otherwise the errors are counted
+	err := contextResultsError(results)
+	if failedContexts == 0 {
+		err = fmt.Errorf("%d error(s) during the run", len(errs))
+	} else if other := len(errs) - failedContexts; other > 0 {
+		err = fmt.Errorf("%w, and %d other error(s)", err, other)
+	}
+	return withExitCode(failureExitCode(errs, exported), err)
+}
+
+// failureExitCode picks the exit code of a failed run: discovery failures first, then
+// permission errors, then whether anything was exported at all
+func failureExitCode(errs []error, exported int) int {
+	code := exitError
+	if exported > 0 {
+		code = exitPartialFailure
+	}
+	for _, err := range errs {
+		switch c := exitCode(err); {
+		case c == exitDiscoveryFailure:
+			return exitDiscoveryFailure
+		case c == exitPermissionDenied || k8s.IsPermissionDenied(err):
+			code = exitPermissionDenied
+		}
+	}
+	return code
+}
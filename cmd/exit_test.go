@@ -0,0 +1,210 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/davidschrooten/manifold-k8s/pkg/k8s"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+func TestExitCode(t *testing.T) {
+	assert.Equal(t, exitOK, exitCode(nil))
+	assert.Equal(t, exitError, exitCode(errors.New("invalid flags")))
+
+	err := fmt.Errorf("export failed: %w", withExitCode(exitDiscoveryFailure, errors.New("no discovery")))
+	assert.Equal(t, exitDiscoveryFailure, exitCode(err))
+	assert.EqualError(t, err, "export failed: no discovery")
+}
+
+func TestValidateFailOn(t *testing.T) {
+	for _, policy := range []string{failOnWarning, failOnError, failOnNever} {
+		assert.NoError(t, validateFailOn(policy))
+	}
+	assert.EqualError(t, validateFailOn("always"), `invalid --fail-on "always" (must be warning, error or never)`)
+}
+
+func TestRunError(t *testing.T) {
+	forbidden := apierrors.NewForbidden(schema.GroupResource{Resource: "secrets"}, "", errors.New("denied"))
+	reportWith := func(errs ...error) *contextReport {
+		report := newContextReport("ctx")
+		report.errs = errs
+		return report
+	}
+	warned := newContextReport("ctx")
+	warned.Warnings = []string{"resource type widgets not found in cluster"}
+
+	tests := []struct {
+		name     string
+		results  []contextResult
+		run      *contextReport
+		policy   string
+		wantCode int
+		wantErr  string
+	}{
+		{
+			name:    "success",
+			results: []contextResult{{context: "a", exported: 3, report: newContextReport("a")}},
+			policy:  failOnError,
+		},
+		{
+			name:    "nothing exported with error",
+			results: []contextResult{{context: "a", report: newContextReport("a")}},
+			policy:  failOnError,
+		},
+		{
+			name:     "nothing exported with warning",
+			results:  []contextResult{{context: "a", report: newContextReport("a")}},
+			policy:   failOnWarning,
+			wantCode: exitNothingExported,
+			wantErr:  "nothing was exported",
+		},
+		{
+			name:     "object errors",
+			results:  []contextResult{{context: "a", exported: 3, report: reportWith(errors.New("failed to export pods/web"))}},
+			policy:   failOnError,
+			wantCode: exitPartialFailure,
+			wantErr:  "1 error(s) during the run",
+		},
+		{
+			name:     "permission denied",
+			results:  []contextResult{{context: "a", exported: 3, report: reportWith(fmt.Errorf("failed to list secrets in default: %w", forbidden))}},
+			policy:   failOnError,
+			wantCode: exitPermissionDenied,
+			wantErr:  "1 error(s) during the run",
+		},
+		{
+			name: "discovery failure wins",
+			results: []contextResult{
+				{context: "a", err: withExitCode(exitDiscoveryFailure, errors.New("failed to discover resources")), report: newContextReport("a")},
+				{context: "b", exported: 2, report: reportWith(forbidden)},
+			},
+			policy:   failOnError,
+			wantCode: exitDiscoveryFailure,
+			wantErr:  "1 of 2 context(s) failed, and 1 other error(s)",
+		},
+		{
+			name:     "failed context without exports",
+			results:  []contextResult{{context: "a", err: errors.New("connection refused"), report: newContextReport("a")}},
+			policy:   failOnError,
+			wantCode: exitError,
+			wantErr:  "connection refused",
+		},
+		{
+			name:     "run-level errors",
+			results:  []contextResult{{context: "a", exported: 1, report: newContextReport("a")}},
+			run:      reportWith(errors.New("failed to write helmfile.yaml")),
+			policy:   failOnError,
+			wantCode: exitPartialFailure,
+			wantErr:  "1 error(s) during the run",
+		},
+		{
+			name:    "warnings pass with error",
+			results: []contextResult{{context: "a", exported: 1, report: warned}},
+			policy:  failOnError,
+		},
+		{
+			name:     "warnings fail with warning",
+			results:  []contextResult{{context: "a", exported: 1, report: warned}},
+			policy:   failOnWarning,
+			wantCode: exitPartialFailure,
+			wantErr:  "1 warning(s) with --fail-on warning",
+		},
+		{
+			name:    "never",
+			results: []contextResult{{context: "a", err: errors.New("connection refused"), report: reportWith(forbidden)}},
+			policy:  failOnNever,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := runError(tt.results, tt.run, tt.policy)
+			assert.Equal(t, tt.wantCode, exitCode(err))
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRunExport_FailOn(t *testing.T) {
+	enableStubs()
+	defer disableStubs()
+	defer func() {
+		exportFailOn = failOnError
+		exportStrict = false
+	}()
+
+	forbiddenServices := func(services error) func(*api.Config, string) (*k8s.Client, error) {
+		return func(config *api.Config, contextName string) (*k8s.Client, error) {
+			client := fakeClientWith(deploymentObject("web", 1, "web:1.0"))
+			client.DynamicClient.(*dynamicfake.FakeDynamicClient).PrependReactor("list", "services", func(action k8stesting.Action) (bool, runtime.Object, error) {
+				return true, nil, services
+			})
+			return client, nil
+		}
+	}
+	forbidden := apierrors.NewForbidden(schema.GroupResource{Resource: "services"}, "", errors.New("denied"))
+
+	tests := []struct {
+		name       string
+		resources  []string
+		namespaces []string
+		listErr    error
+		discovery  error
+		policy     string
+		wantCode   int
+	}{
+		{name: "success", resources: []string{"deployments"}, policy: failOnError},
+		{name: "forbidden list", resources: []string{"deployments", "services"}, listErr: forbidden, policy: failOnError, wantCode: exitPermissionDenied},
+		{name: "failed list", resources: []string{"deployments", "services"}, listErr: errors.New("etcdserver: request timed out"), policy: failOnError, wantCode: exitPartialFailure},
+		{name: "failed list with never", resources: []string{"deployments", "services"}, listErr: forbidden, policy: failOnNever},
+		{name: "missing type with error", resources: []string{"deployments", "widgets"}, policy: failOnError},
+		{name: "missing type with warning", resources: []string{"deployments", "widgets"}, policy: failOnWarning, wantCode: exitPartialFailure},
+		{name: "empty namespace with error", resources: []string{"deployments"}, namespaces: []string{"empty"}, policy: failOnError},
+		{name: "empty namespace with warning", resources: []string{"deployments"}, namespaces: []string{"empty"}, policy: failOnWarning, wantCode: exitNothingExported},
+		{name: "discovery failure", resources: []string{"deployments"}, discovery: errors.New("the server is unreachable"), policy: failOnError, wantCode: exitDiscoveryFailure},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stubNewClient = forbiddenServices(tt.listErr)
+			stubDiscoverResources = func(discovery.DiscoveryInterface) ([]k8s.ResourceInfo, error) {
+				if tt.discovery != nil {
+					return nil, tt.discovery
+				}
+				return mockDiscoveredResources(), nil
+			}
+
+			viper.Set("kubeconfig", "/fake/path")
+			exportDryRun = false
+			exportOutputDir = t.TempDir()
+			exportCtx = "test-context"
+			exportNamespaces = []string{"default"}
+			if tt.namespaces != nil {
+				exportNamespaces = tt.namespaces
+			}
+			exportResources = tt.resources
+			exportAllRes = false
+			exportFailOn = tt.policy
+
+			err := runExport(exportCmd, []string{})
+			assert.Equal(t, tt.wantCode, exitCode(err), "error: %v", err)
+		})
+	}
+
+	exportFailOn = "always"
+	assert.EqualError(t, runExport(exportCmd, []string{}), `invalid --fail-on "always" (must be warning, error or never)`)
+}
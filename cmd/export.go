@@ -1,19 +1,31 @@
 package cmd
 
 import (
+	"bytes"
 	"context"
 	"fmt"
-	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/davidschrooten/manifold-k8s/pkg/exporter"
+	"github.com/davidschrooten/manifold-k8s/pkg/helm"
 	"github.com/davidschrooten/manifold-k8s/pkg/k8s"
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/client-go/tools/clientcmd/api"
 )
 
+// Output formats of the export command
+const (
+	exportFormatYAML      = "yaml"
+	exportFormatKustomize = "kustomize"
+	exportFormatHelmChart = "helm-chart"
+	exportFormatJSON      = "json" // plain manifests, with the JSON report on stdout as with --report -
+)
+
 var (
 	exportDryRun     bool
 	exportOutputDir  string
@@ -21,6 +33,20 @@ var (
 	exportNamespaces []string
 	exportResources  []string
 	exportAllRes     bool
+	exportPreflight  bool
+	exportOnForbid   string
+	exportStrict     bool
+	exportFailOn     string
+	exportContexts   []string
+	exportAllCtx     bool
+	exportParallel   int
+	exportMapNs      map[string]string
+	exportRewriteDNS bool
+	exportRules      string
+	exportFormat     string
+	exportOverlays   bool
+	exportChartName  string
+	exportReport     string
 )
 
 var exportCmd = &cobra.Command{
@@ -33,7 +59,13 @@ It is designed for scripting and CI/CD pipelines.
 
 Examples:
   manifold-k8s kubectl-manifests-export --context prod --namespaces default,kube-system --resources pods,deployments -o ./output
-  manifold-k8s kubectl-manifests-export --context staging --namespaces myapp --all-resources -o ./backup`,
+  manifold-k8s kubectl-manifests-export --context staging --namespaces myapp --all-resources -o ./backup
+  manifold-k8s kubectl-manifests-export --contexts "prod-*,staging" --namespaces myapp --all-resources -o ./fleet-backup
+  manifold-k8s kubectl-manifests-export --all-contexts --namespaces kube-system -r configmaps -o ./fleet-backup
+  manifold-k8s kubectl-manifests-export -c prod -n payments-prod -a --map-namespace payments-prod=payments-staging --rewrite-dns -o ./staging
+  manifold-k8s kubectl-manifests-export --contexts staging,prod -n myapp -a --output-format kustomize --kustomize-overlays -o ./kustomize
+  manifold-k8s kubectl-manifests-export -c prod -n myapp -a --output-format helm-chart --chart-name myapp -o ./charts/myapp
+  manifold-k8s kubectl-manifests-export -c prod -n myapp -a -o ./backup --report - > report.json`,
 	RunE: runExport,
 }
 
@@ -42,13 +74,27 @@ func init() {
 
 	exportCmd.Flags().BoolVar(&exportDryRun, "dry-run", false, "preview what would be exported without writing files")
 	exportCmd.Flags().StringVarP(&exportOutputDir, "output", "o", "", "output directory (required)")
-	exportCmd.Flags().StringVarP(&exportCtx, "context", "c", "", "kubernetes context (required)")
-	exportCmd.Flags().StringSliceVarP(&exportNamespaces, "namespaces", "n", nil, "namespaces to export (comma-separated, required)")
+	exportCmd.Flags().StringVarP(&exportCtx, "context", "c", "", "kubernetes context (one of --context, --contexts or --all-contexts is required)")
+	exportCmd.Flags().StringSliceVar(&exportContexts, "contexts", nil, "kubernetes contexts to export in parallel: names or globs (comma-separated)")
+	exportCmd.Flags().BoolVar(&exportAllCtx, "all-contexts", false, "export from every context in kubeconfig in parallel")
+	exportCmd.Flags().IntVar(&exportParallel, "parallel", 4, "maximum number of contexts exported at the same time")
+	exportCmd.Flags().StringSliceVarP(&exportNamespaces, "namespaces", "n", nil, "namespaces to export (comma-separated, default: the namespace of the context or --namespace)")
 	exportCmd.Flags().StringSliceVarP(&exportResources, "resources", "r", nil, "resource types to export (comma-separated, e.g. pods,deployments)")
 	exportCmd.Flags().BoolVarP(&exportAllRes, "all-resources", "a", false, "export all resource types")
+	exportCmd.Flags().BoolVar(&exportPreflight, "preflight", false, "check list permissions for every resource/namespace pair before exporting")
+	exportCmd.Flags().StringVar(&exportOnForbid, "on-forbidden", "skip", "what to do when the preflight finds denied pairs: skip or fail")
+	exportCmd.Flags().BoolVar(&exportStrict, "strict", false, "fail when some API groups cannot be discovered")
+	exportCmd.Flags().StringVar(&exportFailOn, "fail-on", failOnError, "problems that fail the run with a non-zero exit code: warning, error or never")
+	exportCmd.Flags().StringToStringVar(&exportMapNs, "map-namespace", nil, "export a namespace under another name (old=new, can be repeated)")
+	exportCmd.Flags().BoolVar(&exportRewriteDNS, "rewrite-dns", false, "also rewrite mapped namespaces in service DNS names in ConfigMaps")
+	exportCmd.Flags().StringVar(&exportRules, "rewrite-rules", "", "YAML file with rules replacing text in the exported manifests")
+	exportCmd.Flags().StringVar(&exportFormat, "output-format", exportFormatYAML, "yaml (plain manifests), kustomize (adds kustomization.yaml files), helm-chart, or json (plain manifests and the JSON report on stdout, like --report -)")
+	exportCmd.Flags().StringVar(&exportChartName, "chart-name", "", "name of the chart written by --output-format helm-chart (default: the output directory name)")
+	exportCmd.Flags().StringVar(&exportReport, "report", "", "also write a JSON report of the run to this file, or to stdout with - (progress then goes to stderr)")
+	exportCmd.Flags().BoolVar(&exportOverlays, "kustomize-overlays", false, "with several contexts, also write a shared base/ and per-context overlays/ with patches for the differences")
 
-	_ = exportCmd.MarkFlagRequired("context")
-	_ = exportCmd.MarkFlagRequired("namespaces")
+	exportCmd.MarkFlagsOneRequired("context", "contexts", "all-contexts")
+	exportCmd.MarkFlagsMutuallyExclusive("context", "contexts", "all-contexts")
 	_ = exportCmd.MarkFlagRequired("output")
 }
 
@@ -58,49 +104,169 @@ func runExport(cmd *cobra.Command, args []string) error {
 	if err := validateExportFlags(exportAllRes, exportResources); err != nil {
 		return err
 	}
+	if err := validateOnForbidden(exportOnForbid); err != nil {
+		return err
+	}
+	if err := validateFailOn(exportFailOn); err != nil {
+		return err
+	}
+	if exportParallel < 1 {
+		return fmt.Errorf("--parallel must be at least 1")
+	}
+	switch exportFormat {
+	case exportFormatYAML, exportFormatKustomize, exportFormatHelmChart, exportFormatJSON:
+	default:
+		return fmt.Errorf("invalid output format %q (must be %s, %s, %s or %s)", exportFormat, exportFormatYAML, exportFormatKustomize, exportFormatHelmChart, exportFormatJSON)
+	}
+	reportPath := exportReport
+	if exportFormat == exportFormatJSON {
+		if reportPath != "" && reportPath != reportStdout {
+			return fmt.Errorf("--output-format %s prints the report on stdout and cannot be combined with --report %s", exportFormatJSON, reportPath)
+		}
+		reportPath = reportStdout
+	}
+	if exportOverlays && exportFormat != exportFormatKustomize {
+		return fmt.Errorf("--kustomize-overlays requires --output-format %s", exportFormatKustomize)
+	}
+	singleContext := exportCtx != "" || (len(exportContexts) == 0 && !exportAllCtx)
+	if exportOverlays && singleContext {
+		return fmt.Errorf("--kustomize-overlays requires --contexts or --all-contexts")
+	}
+	rewriter, err := newRewriter(exportMapNs, exportRewriteDNS, exportRules)
+	if err != nil {
+		return err
+	}
 
-	// Load kubeconfig (use stub if available)
-	kubeconfigPath := viper.GetString("kubeconfig")
-	var err error
-	var config *api.Config
-	if stubLoadKubeConfig != nil {
-		config, err = stubLoadKubeConfig(kubeconfigPath)
-	} else {
-		config, err = k8s.LoadKubeConfig(kubeconfigPath)
+	report := newRunReport("kubectl-manifests-export", exportOutputDir, exportDryRun)
+	runLog := newContextLog("", progressOutput(reportPath))
+	results, err := exportManifests(ctx, rewriter, singleContext, runLog)
+	if err == nil {
+		err = runError(results, runLog.report, exportFailOn)
+	}
+	report.finish(results, runLog.report, err)
+	if reportPath != "" {
+		if reportErr := report.write(reportPath); reportErr != nil && err == nil {
+			err = reportErr
+		}
 	}
+	return err
+}
+
+// exportManifests exports from the context or contexts selected by the flags
+// Steps covering the whole run, such as writing Kustomize overlays, go through runLog. Failed
+// contexts are reported in the results; the error is only set when the run could not complete.
+func exportManifests(ctx context.Context, rewriter *exporter.Rewriter, singleContext bool, runLog *contextLog) ([]contextResult, error) {
+	// Load kubeconfig
+	config, err := loadKubeConfig()
 	if err != nil {
-		return fmt.Errorf("failed to load kubeconfig: %w", err)
+		return nil, fmt.Errorf("failed to load kubeconfig: %w", err)
 	}
 
-	// Create client for specified context (use stub if available)
-	var client *k8s.Client
-	if stubNewClient != nil {
-		client, err = stubNewClient(config, exportCtx)
-	} else {
-		client, err = k8s.NewClient(config, exportCtx)
+	// A single --context keeps the flat layout; several contexts export into <output>/<context>/
+	if singleContext {
+		result := exportManifestsContext(ctx, config, exportCtx, exportOutputDir, rewriter, newContextLog(exportCtx, runLog.out))
+		return []contextResult{result}, nil
 	}
+
+	contexts, err := resolveContexts(config, strings.Join(exportContexts, ","), exportAllCtx)
 	if err != nil {
-		return fmt.Errorf("failed to create client for context %s: %w", exportCtx, err)
+		return nil, err
 	}
+	runLog.printf("Exporting from %d context(s) in parallel: %v\n", len(contexts), contexts)
 
-	fmt.Printf("Using context: %s\n", exportCtx)
+	results := make([]contextResult, len(contexts))
+	var wg sync.WaitGroup
+	var outputMu sync.Mutex
+	limit := make(chan struct{}, exportParallel)
+	for i, contextName := range contexts {
+		wg.Add(1)
+		go func(i int, contextName string) {
+			defer wg.Done()
+			limit <- struct{}{}
+			defer func() { <-limit }()
 
-	// Discover resources (use stub if available)
-	var discoveredResources []k8s.ResourceInfo
-	if stubDiscoverResources != nil {
-		discoveredResources, err = stubDiscoverResources(client.Clientset.Discovery())
-	} else {
-		discoveredResources, err = k8s.DiscoverResources(client.Clientset.Discovery())
+			// Buffer each context's progress so that parallel exports don't interleave; log
+			// records carry their context instead
+			var stdout bytes.Buffer
+			log := newContextLog(contextName, &stdout)
+			results[i] = exportManifestsContext(ctx, config, contextName, filepath.Join(exportOutputDir, contextName), rewriter, log)
+
+			outputMu.Lock()
+			defer outputMu.Unlock()
+			runLog.printf("\n=== Context: %s ===\n", contextName)
+			_, _ = runLog.out.Write(stdout.Bytes())
+		}(i, contextName)
 	}
+	wg.Wait()
+
+	runLog.printf("%s", formatContextResults(results, "manifest(s)"))
+
+	if exportOverlays && !exportDryRun {
+		if err := writeKustomizeOverlays(exportOutputDir, results, runLog); err != nil {
+			return results, err
+		}
+	}
+	return results, nil
+}
+
+// writeKustomizeOverlays builds a shared base and per-context overlays from the exports of the
+// contexts that succeeded
+func writeKustomizeOverlays(outputDir string, results []contextResult, runLog *contextLog) error {
+	var contexts []string
+	var trees []map[exporter.ManifestKey]*unstructured.Unstructured
+	for _, result := range results {
+		if result.err != nil || result.exported == 0 {
+			continue
+		}
+		tree, err := exporter.LoadExport(filepath.Join(outputDir, result.context))
+		if err != nil {
+			return err
+		}
+		contexts = append(contexts, result.context)
+		trees = append(trees, tree)
+	}
+
+	if len(contexts) < 2 {
+		runLog.warnf("skipping Kustomize overlays, fewer than two contexts exported manifests")
+		return nil
+	}
+	if err := exporter.WriteOverlays(outputDir, contexts, trees); err != nil {
+		return fmt.Errorf("failed to write Kustomize overlays: %w", err)
+	}
+	runLog.printf("✓ Wrote Kustomize base and %d overlay(s) to %s\n", len(contexts), outputDir)
+	return nil
+}
+
+// exportManifestsContext exports the selected resources from one context into baseDir, rewriting
+// them with rewriter when it is set. Progress, warnings and the run report go through log.
+func exportManifestsContext(ctx context.Context, config *api.Config, contextName, baseDir string, rewriter *exporter.Rewriter, log *contextLog) contextResult {
+	result := contextResult{context: contextName}
+	fail := func(err error) contextResult {
+		result.err = err
+		return log.done(result)
+	}
+
+	// Create client for specified context (use stub if available)
+	client, err := newClient(config, contextName)
 	if err != nil {
-		return fmt.Errorf("failed to discover resources: %w", err)
+		return fail(fmt.Errorf("failed to create client for context %s: %w", contextName, err))
+	}
+	result.identity = client.Identity()
+
+	log.printf("Using context: %s\n", contextName)
+	log.printf("Using identity: %s\n", result.identity)
+
+	// Discover resources (use stub if available)
+	discoveredResources, err := discoverResources(client)
+	if err := checkDiscoveryErrorWith(log.warnf, err, exportStrict); err != nil {
+		return fail(withExitCode(exitDiscoveryFailure, fmt.Errorf("failed to discover resources: %w", err)))
 	}
 
 	// Filter resources based on flags
 	var selectedResources []k8s.ResourceInfo
 	if exportAllRes {
 		selectedResources = discoveredResources
-		fmt.Printf("Exporting all resource types (%d types)\n", len(selectedResources))
+		log.printf("Exporting all resource types (%d types)\n", len(selectedResources))
 	} else {
 		// Build map and select requested resources
 		resourceMap := buildResourceMap(discoveredResources)
@@ -109,31 +275,73 @@ func runExport(cmd *cobra.Command, args []string) error {
 
 		// Warn about not found resources
 		for _, resName := range notFound {
-			fmt.Fprintf(os.Stderr, "Warning: resource type %s not found in cluster\n", resName)
+			log.warnf("resource type %s not found in cluster", resName)
+			log.skip(resName, "resource type not found in cluster")
 		}
 
 		if len(selectedResources) == 0 {
-			return fmt.Errorf("no valid resource types found")
+			return fail(fmt.Errorf("no valid resource types found"))
 		}
-		fmt.Printf("Exporting %d resource type(s): %v\n", len(selectedResources), exportResources)
+		log.printf("Exporting %d resource type(s): %v\n", len(selectedResources), exportResources)
 	}
 
-	fmt.Printf("Exporting from %d namespace(s): %v\n", len(exportNamespaces), exportNamespaces)
+	// Without --namespaces the namespace of the context is exported, or the one set with --namespace
+	namespaces := exportNamespaces
+	if len(namespaces) == 0 {
+		namespaces = []string{client.Namespace}
+	}
+	log.printf("Exporting from %d namespace(s): %v\n", len(namespaces), namespaces)
+	log.namespaces(namespaces)
 
-	// Create exporter
-	exp := exporter.NewExporter(exportOutputDir)
+	// Check permissions before exporting (use stub if available)
+	var denied map[string]bool
+	if exportPreflight {
+		log.printf("\nChecking permissions...\n")
+		var checks []k8s.AccessCheck
+		if stubCheckListAccess != nil {
+			checks, err = stubCheckListAccess(ctx, client, selectedResources, namespaces)
+		} else {
+			checks, err = k8s.CheckListAccess(ctx, client, selectedResources, namespaces)
+		}
+		if err != nil {
+			return fail(fmt.Errorf("preflight check failed: %w", err))
+		}
+
+		log.printf("%s", formatAccessMatrix(checks, namespaces))
+		denied = deniedAccess(checks)
+		if len(denied) > 0 {
+			if exportOnForbid == "fail" {
+				return fail(withExitCode(exitPermissionDenied, fmt.Errorf("access denied for %d resource/namespace pair(s)", len(denied))))
+			}
+			log.warnf("skipping %d denied resource/namespace pair(s)", len(denied))
+			for _, pair := range sortedSet(denied) {
+				log.skip(pair, "list access denied")
+			}
+		}
+	}
+
+	// Create exporter; a chart keeps the manifests in its templates directory
+	exportDir := baseDir
+	if exportFormat == exportFormatHelmChart {
+		exportDir = filepath.Join(baseDir, exporter.ChartTemplatesDir)
+	}
+	exp := exporter.NewExporter(exportDir)
+	exp.Rewriter = rewriter
+	exp.Logger = log.logger
 
 	// Fetch and export resources
-	fmt.Println("\nExporting manifests...")
-	for _, namespace := range exportNamespaces {
+	log.printf("\nExporting manifests...\n")
+	var wouldExport int
+	for _, namespace := range namespaces {
 		for _, resource := range selectedResources {
-			if !shouldProcessResource(resource, namespace) {
+			if !shouldProcessResource(resource, namespace) || denied[accessKey(namespace, resource.Name)] {
 				continue
 			}
 
 			gvr := resource.GroupVersionResource()
 
 			// List resources
+			start := time.Now()
 			var resourceList *unstructured.UnstructuredList
 			if resource.Namespaced {
 				resourceList, err = client.DynamicClient.Resource(gvr).Namespace(namespace).List(ctx, metav1.ListOptions{})
@@ -142,30 +350,59 @@ func runExport(cmd *cobra.Command, args []string) error {
 			}
 
 			if err != nil {
-				fmt.Fprintf(os.Stderr, "Warning: failed to list %s in %s: %v\n", resource.Name, namespace, err)
+				log.errorf("failed to list %s in %s: %w", resource.Name, namespace, err)
 				continue
 			}
+			log.logger.Debug("listed resources", "resource", resource.Name, "namespace", namespace, "items", len(resourceList.Items), "duration", time.Since(start))
 
 			// Export each resource
 			for _, item := range resourceList.Items {
 				if exportDryRun {
-					fmt.Println(formatOutputMessage(true, namespace, resource.Name, item.GetName()))
+					log.printf("%s\n", formatOutputMessage(true, namespace, resource.Name, item.GetName()))
+					log.exported(resource.Name)
+					wouldExport++
 					continue
 				}
 
 				if err := exp.ExportResource(ctx, &item, gvr, namespace); err != nil {
-					fmt.Fprintf(os.Stderr, "Warning: failed to export %s/%s: %v\n", resource.Name, item.GetName(), err)
+					log.errorf("failed to export %s/%s: %w", resource.Name, item.GetName(), err)
 					continue
 				}
-				fmt.Println(formatOutputMessage(false, namespace, resource.Name, item.GetName()))
+				log.printf("%s\n", formatOutputMessage(false, namespace, resource.Name, item.GetName()))
+				log.exported(resource.Name, exp.ExportedFiles[len(exp.ExportedFiles)-1])
+			}
+		}
+	}
+
+	result.exported = exp.ExportedCount
+	if exportDryRun {
+		result.exported = wouldExport
+	}
+
+	if !exportDryRun && result.exported > 0 {
+		switch exportFormat {
+		case exportFormatKustomize:
+			if err := exporter.WriteKustomizations(baseDir); err != nil {
+				return fail(fmt.Errorf("failed to write kustomization files: %w", err))
+			}
+		case exportFormatHelmChart:
+			chartName := exportChartName
+			if chartName == "" {
+				chartName = filepath.Base(filepath.Clean(baseDir))
 			}
+			metadata := helm.ChartMetadata{Name: chartName, Description: fmt.Sprintf("Manifests exported from context %s", contextName)}
+			if err := exporter.WriteHelmChart(baseDir, metadata); err != nil {
+				return fail(fmt.Errorf("failed to write Helm chart: %w", err))
+			}
+			log.printf("Wrote Helm chart %s to %s\n", chartName, baseDir)
 		}
 	}
 
 	// Print summary
 	if !exportDryRun {
-		fmt.Printf("\n%s\n", exp.Summary())
+		log.printf("\n%s\n", exp.Summary())
+		log.printf("Identity: %s\n", result.identity)
 	}
 
-	return nil
+	return log.done(result)
 }
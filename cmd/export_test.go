@@ -2,12 +2,18 @@ package cmd
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
 	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/davidschrooten/manifold-k8s/pkg/k8s"
 	"github.com/spf13/viper"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"k8s.io/client-go/discovery"
 	"k8s.io/client-go/tools/clientcmd/api"
 )
@@ -83,6 +89,14 @@ func TestExportCmd_Flags(t *testing.T) {
 		{"namespaces flag", "namespaces", "stringSlice"},
 		{"resources flag", "resources", "stringSlice"},
 		{"all-resources flag", "all-resources", "bool"},
+		{"contexts flag", "contexts", "stringSlice"},
+		{"all-contexts flag", "all-contexts", "bool"},
+		{"parallel flag", "parallel", "int"},
+		{"output-format flag", "output-format", "string"},
+		{"kustomize-overlays flag", "kustomize-overlays", "bool"},
+		{"chart-name flag", "chart-name", "string"},
+		{"report flag", "report", "string"},
+		{"fail-on flag", "fail-on", "string"},
 	}
 
 	for _, tt := range tests {
@@ -346,26 +360,18 @@ func TestRunExport_NoValidResources(t *testing.T) {
 	exportResources = []string{"nonexistent"}
 	exportAllRes = false
 
-	// Capture stderr
-	old := os.Stderr
-	r, w, _ := os.Pipe()
-	os.Stderr = w
+	// Capture the log
+	var logs bytes.Buffer
+	logger = slog.New(slog.NewTextHandler(&logs, nil))
+	defer func() { logger = slog.New(slog.DiscardHandler) }()
 
 	// Run
 	err := runExport(exportCmd, []string{})
 
-	// Restore stderr
-	_ = w.Close()
-	os.Stderr = old
-
-	var buf bytes.Buffer
-	_, _ = buf.ReadFrom(r)
-	stderr := buf.String()
-
 	// Assert
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "no valid resource types found")
-	assert.Contains(t, stderr, "Warning: resource type nonexistent not found in cluster")
+	assert.Contains(t, logs.String(), `level=WARN msg="resource type nonexistent not found in cluster" context=test-context`)
 }
 
 func TestRunExport_WithOutputFiles(t *testing.T) {
@@ -398,3 +404,534 @@ func TestRunExport_WithOutputFiles(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Greater(t, len(entries), 0, "Expected output directory to have content")
 }
+
+func TestRunExport_DefaultNamespace(t *testing.T) {
+	enableStubs()
+	defer disableStubs()
+	defer func() { exportReport = "" }()
+
+	// The client resolves the namespace of the context, or the one set with --namespace
+	stubNewClient = func(config *api.Config, context string) (*k8s.Client, error) {
+		client := mockK8sClient()
+		client.Namespace = "payments"
+		return client, nil
+	}
+
+	tmpDir := t.TempDir()
+	viper.Set("kubeconfig", "/fake/path")
+	exportDryRun = false
+	exportOutputDir = filepath.Join(tmpDir, "out")
+	exportCtx = "test-context"
+	exportNamespaces = nil
+	exportResources = []string{"pods"}
+	exportAllRes = false
+	exportReport = filepath.Join(tmpDir, "report.json")
+
+	require.NoError(t, runExport(exportCmd, []string{}))
+
+	data, err := os.ReadFile(exportReport)
+	require.NoError(t, err)
+	var report runReport
+	require.NoError(t, json.Unmarshal(data, &report))
+	require.Len(t, report.Contexts, 1)
+	assert.Equal(t, []string{"payments"}, report.Contexts[0].Namespaces)
+	assert.DirExists(t, filepath.Join(tmpDir, "out", "payments", "pods"))
+}
+
+func TestRunExport_PreflightSkipsDenied(t *testing.T) {
+	// Setup
+	enableStubs()
+	defer disableStubs()
+	defer func() {
+		exportPreflight = false
+		exportOnForbid = "skip"
+	}()
+
+	stubCheckListAccess = func(ctx context.Context, client *k8s.Client, resources []k8s.ResourceInfo, namespaces []string) ([]k8s.AccessCheck, error) {
+		var checks []k8s.AccessCheck
+		for _, ns := range namespaces {
+			for _, res := range resources {
+				checks = append(checks, k8s.AccessCheck{Resource: res, Namespace: ns, Allowed: res.Name != "pods"})
+			}
+		}
+		return checks, nil
+	}
+
+	tmpDir := t.TempDir()
+	viper.Set("kubeconfig", "/fake/path")
+
+	exportDryRun = false
+	exportOutputDir = tmpDir
+	exportCtx = "test-context"
+	exportNamespaces = []string{"default"}
+	exportResources = []string{"pods", "deployments"}
+	exportAllRes = false
+	exportPreflight = true
+	exportOnForbid = "skip"
+
+	err := runExport(exportCmd, []string{})
+	assert.NoError(t, err)
+
+	// Pods were denied and skipped, deployments were exported
+	_, err = os.Stat(filepath.Join(tmpDir, "default", "pods"))
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Stat(filepath.Join(tmpDir, "default", "deployments", "test-deployment-1.yaml"))
+	assert.NoError(t, err)
+}
+
+func TestRunExport_PreflightFailOnForbidden(t *testing.T) {
+	// Setup
+	enableStubs()
+	defer disableStubs()
+	defer func() {
+		exportPreflight = false
+		exportOnForbid = "skip"
+	}()
+
+	stubCheckListAccess = func(ctx context.Context, client *k8s.Client, resources []k8s.ResourceInfo, namespaces []string) ([]k8s.AccessCheck, error) {
+		return []k8s.AccessCheck{{Resource: resources[0], Namespace: namespaces[0], Allowed: false, Reason: "forbidden"}}, nil
+	}
+
+	tmpDir := t.TempDir()
+	viper.Set("kubeconfig", "/fake/path")
+
+	exportDryRun = false
+	exportOutputDir = tmpDir
+	exportCtx = "test-context"
+	exportNamespaces = []string{"default"}
+	exportResources = []string{"pods"}
+	exportAllRes = false
+	exportPreflight = true
+	exportOnForbid = "fail"
+
+	err := runExport(exportCmd, []string{})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "access denied for 1 resource/namespace pair(s)")
+
+	// Nothing should have been exported
+	entries, _ := os.ReadDir(tmpDir)
+	assert.Equal(t, 0, len(entries))
+}
+
+func TestRunExport_InvalidOnForbidden(t *testing.T) {
+	defer func() { exportOnForbid = "skip" }()
+
+	exportAllRes = true
+	exportOnForbid = "ignore"
+
+	err := runExport(exportCmd, []string{})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid --on-forbidden value")
+}
+
+func TestRunExport_PartialDiscovery(t *testing.T) {
+	// Setup
+	enableStubs()
+	defer disableStubs()
+	defer func() { exportStrict = false }()
+
+	stubDiscoverResources = func(discovery.DiscoveryInterface) ([]k8s.ResourceInfo, error) {
+		return mockDiscoveredResources(), &k8s.PartialDiscoveryError{
+			Failures: []k8s.DiscoveryFailure{{GroupVersion: "metrics.k8s.io/v1beta1", Err: assert.AnError}},
+		}
+	}
+
+	viper.Set("kubeconfig", "/fake/path")
+
+	exportDryRun = true
+	exportOutputDir = t.TempDir()
+	exportCtx = "test-context"
+	exportNamespaces = []string{"default"}
+	exportResources = []string{"pods"}
+	exportAllRes = false
+
+	// Partial failures are only warnings by default
+	exportStrict = false
+	err := runExport(exportCmd, []string{})
+	assert.NoError(t, err)
+
+	// Strict mode turns them into an error
+	exportStrict = true
+	err = runExport(exportCmd, []string{})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "metrics.k8s.io/v1beta1")
+}
+
+func TestRunExport_MultipleContexts(t *testing.T) {
+	enableStubs()
+	defer disableStubs()
+	defer func() {
+		exportCtx = ""
+		exportContexts = nil
+		exportParallel = 4
+	}()
+
+	stubLoadKubeConfig = func(path string) (*api.Config, error) {
+		config := mockKubeConfig()
+		for _, name := range []string{"prod-eu", "prod-us", "staging"} {
+			config.Contexts[name] = &api.Context{Cluster: "test-cluster", AuthInfo: "test-user"}
+		}
+		return config, nil
+	}
+	stubNewClient = func(config *api.Config, contextName string) (*k8s.Client, error) {
+		if contextName == "prod-us" {
+			return nil, fmt.Errorf("dial tcp: connection refused")
+		}
+		return mockK8sClient(), nil
+	}
+
+	tmpDir := t.TempDir()
+	viper.Set("kubeconfig", "/fake/path")
+	exportDryRun = false
+	exportOutputDir = tmpDir
+	exportCtx = ""
+	exportContexts = []string{"prod-*", "staging"}
+	exportNamespaces = []string{"default"}
+	exportResources = []string{"pods"}
+	exportAllRes = false
+	exportParallel = 2
+
+	// Capture stdout
+	old := os.Stdout
+	r, w, _ := os.Pipe()
+	os.Stdout = w
+
+	err := runExport(exportCmd, []string{})
+
+	// Restore stdout
+	_ = w.Close()
+	os.Stdout = old
+
+	var buf bytes.Buffer
+	_, _ = buf.ReadFrom(r)
+	stdout := buf.String()
+
+	assert.EqualError(t, err, "1 of 3 context(s) failed")
+
+	// The reachable contexts are exported into their own directories
+	for _, contextName := range []string{"prod-eu", "staging"} {
+		entries, err := os.ReadDir(filepath.Join(tmpDir, contextName, "default"))
+		assert.NoError(t, err, "context %s", contextName)
+		assert.NotEmpty(t, entries, "context %s", contextName)
+	}
+	_, err = os.Stat(filepath.Join(tmpDir, "prod-us"))
+	assert.True(t, os.IsNotExist(err), "nothing should be written for the failed context")
+
+	assert.Contains(t, stdout, "=== Context: staging ===")
+	assert.Contains(t, stdout, "CONTEXT")
+	assert.Contains(t, stdout, "failed: failed to create client for context prod-us")
+}
+
+func TestRunExport_InvalidParallel(t *testing.T) {
+	defer func() { exportParallel = 4 }()
+
+	exportAllRes = true
+	exportOnForbid = "skip"
+	exportParallel = 0
+	defer func() { exportAllRes = false }()
+
+	err := runExport(exportCmd, []string{})
+	assert.EqualError(t, err, "--parallel must be at least 1")
+}
+
+func TestRunExport_MapNamespace(t *testing.T) {
+	enableStubs()
+	defer disableStubs()
+	defer func() { exportMapNs = nil }()
+
+	tmpDir := t.TempDir()
+	viper.Set("kubeconfig", "/fake/path")
+	exportDryRun = false
+	exportOutputDir = tmpDir
+	exportCtx = "test-context"
+	exportNamespaces = []string{"default"}
+	exportResources = []string{"pods"}
+	exportAllRes = false
+	exportMapNs = map[string]string{"default": "staging"}
+
+	err := runExport(exportCmd, []string{})
+	assert.NoError(t, err)
+
+	data, err := os.ReadFile(filepath.Join(tmpDir, "staging", "pods", "test-pod-1.yaml"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), "namespace: staging")
+	_, err = os.Stat(filepath.Join(tmpDir, "default"))
+	assert.True(t, os.IsNotExist(err), "nothing should be written under the original namespace")
+}
+
+func TestRunExport_InvalidRewriteRules(t *testing.T) {
+	defer func() { exportRules = "" }()
+
+	exportAllRes = true
+	exportOnForbid = "skip"
+	exportRules = filepath.Join(t.TempDir(), "missing.yaml")
+	defer func() { exportAllRes = false }()
+
+	err := runExport(exportCmd, []string{})
+	assert.ErrorContains(t, err, "failed to read rewrite rules")
+}
+
+func TestRunExport_Kustomize(t *testing.T) {
+	enableStubs()
+	defer disableStubs()
+	defer func() { exportReport = "" }()
+
+	tmpDir := t.TempDir()
+	viper.Set("kubeconfig", "/fake/path")
+	exportDryRun = false
+	exportOutputDir = tmpDir
+	exportCtx = "test-context"
+	exportNamespaces = []string{"default"}
+	exportResources = []string{"pods", "deployments"}
+	exportAllRes = false
+	exportFormat = exportFormatKustomize
+
+	require.NoError(t, runExport(exportCmd, []string{}))
+
+	data, err := os.ReadFile(filepath.Join(tmpDir, "default", "kustomization.yaml"))
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "namespace: default")
+	assert.Contains(t, string(data), "- deployments/test-deployment-1.yaml\n- pods/test-pod-1.yaml\n")
+
+	data, err = os.ReadFile(filepath.Join(tmpDir, "kustomization.yaml"))
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "resources:\n- default\n")
+}
+
+func TestRunExport_KustomizeOverlays(t *testing.T) {
+	stubCompareContexts()
+	defer disableStubs()
+	defer func() {
+		exportContexts = nil
+		exportFormat = exportFormatYAML
+		exportOverlays = false
+	}()
+
+	tmpDir := t.TempDir()
+	viper.Set("kubeconfig", "/fake/path")
+	exportDryRun = false
+	exportOutputDir = tmpDir
+	exportCtx = ""
+	exportContexts = []string{"staging", "prod"}
+	exportNamespaces = []string{"default"}
+	exportResources = []string{"deployments"}
+	exportAllRes = false
+	exportFormat = exportFormatKustomize
+	exportOverlays = true
+
+	require.NoError(t, runExport(exportCmd, []string{}))
+
+	// The base holds the deployments of both contexts, taken from the first one
+	base, err := os.ReadFile(filepath.Join(tmpDir, "base", "kustomization.yaml"))
+	require.NoError(t, err)
+	assert.Equal(t, "apiVersion: kustomize.config.k8s.io/v1beta1\nkind: Kustomization\nresources:\n- default/deployments/api.yaml\n- default/deployments/web.yaml\n", string(base))
+
+	// Objects of a single context are added by its overlay
+	_, err = os.Stat(filepath.Join(tmpDir, "overlays", "staging", "resources", "default", "deployments", "preview.yaml"))
+	assert.NoError(t, err)
+	_, err = os.Stat(filepath.Join(tmpDir, "overlays", "prod", "resources", "default", "deployments", "legacy.yaml"))
+	assert.NoError(t, err)
+
+	// Differing fields become patches in the other overlays
+	overlay, err := os.ReadFile(filepath.Join(tmpDir, "overlays", "prod", "kustomization.yaml"))
+	require.NoError(t, err)
+	assert.Contains(t, string(overlay), "- ../../base\n- resources/default/deployments/legacy.yaml\n")
+	assert.Contains(t, string(overlay), "path: patches/default-deployments-web.yaml")
+
+	patch, err := os.ReadFile(filepath.Join(tmpDir, "overlays", "prod", "patches", "default-deployments-web.yaml"))
+	require.NoError(t, err)
+	assert.Equal(t, "- op: replace\n  path: /spec/replicas\n  value: 5\n- op: replace\n  path: /spec/template/spec/containers/0/image\n  value: web:1.0\n", string(patch))
+
+	staging, err := os.ReadFile(filepath.Join(tmpDir, "overlays", "staging", "kustomization.yaml"))
+	require.NoError(t, err)
+	assert.NotContains(t, string(staging), "patches:")
+}
+
+func TestRunExport_InvalidOutputFormat(t *testing.T) {
+	defer func() {
+		exportFormat = exportFormatYAML
+		exportOverlays = false
+		exportReport = ""
+	}()
+
+	exportCtx = "test-context"
+	exportResources = []string{"pods"}
+	exportAllRes = false
+
+	exportFormat = "helm"
+	assert.EqualError(t, runExport(exportCmd, []string{}), `invalid output format "helm" (must be yaml, kustomize, helm-chart or json)`)
+
+	exportFormat = exportFormatYAML
+	exportOverlays = true
+	assert.EqualError(t, runExport(exportCmd, []string{}), "--kustomize-overlays requires --output-format kustomize")
+
+	exportOverlays = false
+	exportFormat = exportFormatJSON
+	exportReport = "report.json"
+	assert.EqualError(t, runExport(exportCmd, []string{}), "--output-format json prints the report on stdout and cannot be combined with --report report.json")
+}
+
+func TestRunExport_HelmChart(t *testing.T) {
+	stubCompareContexts()
+	defer disableStubs()
+	defer func() {
+		exportFormat = exportFormatYAML
+		exportChartName = ""
+	}()
+
+	tmpDir := t.TempDir()
+	viper.Set("kubeconfig", "/fake/path")
+	exportDryRun = false
+	exportOutputDir = filepath.Join(tmpDir, "payments")
+	exportCtx = "prod"
+	exportNamespaces = []string{"default"}
+	exportResources = []string{"deployments"}
+	exportAllRes = false
+	exportFormat = exportFormatHelmChart
+
+	require.NoError(t, runExport(exportCmd, []string{}))
+
+	chart, err := os.ReadFile(filepath.Join(tmpDir, "payments", "Chart.yaml"))
+	require.NoError(t, err)
+	assert.Contains(t, string(chart), "name: payments\n")
+	assert.Contains(t, string(chart), "description: Manifests exported from context prod\n")
+
+	values, err := os.ReadFile(filepath.Join(tmpDir, "payments", "values.yaml"))
+	require.NoError(t, err)
+	assert.Contains(t, string(values), "  web:\n    containers:\n      web:\n        image:\n          repository: web\n          tag: \"1.0\"\n    replicas: 5\n")
+
+	template, err := os.ReadFile(filepath.Join(tmpDir, "payments", "templates", "default", "deployments", "web.yaml"))
+	require.NoError(t, err)
+	assert.Contains(t, string(template), "replicas: {{ .Values.deployments.web.replicas }}")
+	assert.Contains(t, string(template), `image: "{{ .Values.deployments.web.containers.web.image.repository }}:{{ .Values.deployments.web.containers.web.image.tag }}"`)
+
+	// The chart name can be set explicitly
+	exportChartName = "web-platform"
+	require.NoError(t, runExport(exportCmd, []string{}))
+	chart, err = os.ReadFile(filepath.Join(tmpDir, "payments", "Chart.yaml"))
+	require.NoError(t, err)
+	assert.Contains(t, string(chart), "name: web-platform\n")
+}
+
+func TestRunExport_JSONReport(t *testing.T) {
+	tests := map[string]struct {
+		format string
+		report string
+	}{
+		"report flag":   {format: exportFormatYAML, report: reportStdout},
+		"output format": {format: exportFormatJSON},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			testRunExportJSONReport(t, tt.format, tt.report)
+		})
+	}
+}
+
+func testRunExportJSONReport(t *testing.T, format, reportPath string) {
+	enableStubs()
+	defer disableStubs()
+	defer func() {
+		exportFormat = exportFormatYAML
+		exportReport = ""
+	}()
+
+	tmpDir := t.TempDir()
+	viper.Set("kubeconfig", "/fake/path")
+	exportDryRun = false
+	exportOutputDir = tmpDir
+	exportCtx = "test-context"
+	exportNamespaces = []string{"default"}
+	exportResources = []string{"pods", "deployments", "nonexistent"}
+	exportAllRes = false
+	exportFormat = format
+	exportReport = reportPath
+
+	// Capture stdout
+	old := os.Stdout
+	r, w, _ := os.Pipe()
+	os.Stdout = w
+
+	err := runExport(exportCmd, []string{})
+
+	// Restore stdout
+	_ = w.Close()
+	os.Stdout = old
+
+	var buf bytes.Buffer
+	_, _ = buf.ReadFrom(r)
+	require.NoError(t, err)
+
+	// Progress goes to stderr, so stdout holds the report only
+	var report runReport
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &report), "stdout:\n%s", buf.String())
+
+	assert.Equal(t, "kubectl-manifests-export", report.Command)
+	assert.True(t, report.Success)
+	require.Len(t, report.Contexts, 1)
+	ctxReport := report.Contexts[0]
+	assert.Equal(t, "test-context", ctxReport.Context)
+	assert.Equal(t, []string{"default"}, ctxReport.Namespaces)
+	assert.Equal(t, map[string]int{"pods": 1, "deployments": 1}, ctxReport.Counts)
+	assert.ElementsMatch(t, []string{
+		filepath.Join(tmpDir, "default", "pods", "test-pod-1.yaml"),
+		filepath.Join(tmpDir, "default", "deployments", "test-deployment-1.yaml"),
+	}, ctxReport.Files)
+	assert.Equal(t, []skippedItem{{Item: "nonexistent", Reason: "resource type not found in cluster"}}, ctxReport.Skipped)
+	assert.Equal(t, []string{"resource type nonexistent not found in cluster"}, ctxReport.Warnings)
+	assert.Empty(t, ctxReport.Errors)
+	assert.Equal(t, 2, report.Totals.Exported)
+	assert.Equal(t, 1, report.Totals.Warnings)
+	assert.False(t, report.FinishedAt.Before(report.StartedAt))
+}
+
+func TestRunExport_ReportOnFailure(t *testing.T) {
+	enableStubs()
+	defer disableStubs()
+	defer func() {
+		exportContexts = nil
+		exportReport = ""
+	}()
+
+	stubLoadKubeConfig = func(path string) (*api.Config, error) {
+		config := mockKubeConfig()
+		config.Contexts["prod"] = &api.Context{Cluster: "test-cluster", AuthInfo: "test-user"}
+		config.Contexts["staging"] = &api.Context{Cluster: "test-cluster", AuthInfo: "test-user"}
+		return config, nil
+	}
+	stubNewClient = func(config *api.Config, contextName string) (*k8s.Client, error) {
+		if contextName == "prod" {
+			return nil, fmt.Errorf("dial tcp: connection refused")
+		}
+		return mockK8sClient(), nil
+	}
+
+	tmpDir := t.TempDir()
+	viper.Set("kubeconfig", "/fake/path")
+	exportDryRun = false
+	exportOutputDir = filepath.Join(tmpDir, "out")
+	exportCtx = ""
+	exportContexts = []string{"prod", "staging"}
+	exportNamespaces = []string{"default"}
+	exportResources = []string{"pods"}
+	exportAllRes = false
+	exportReport = filepath.Join(tmpDir, "reports", "report.json")
+
+	assert.EqualError(t, runExport(exportCmd, []string{}), "1 of 2 context(s) failed")
+
+	// The report is written even though the run failed
+	data, err := os.ReadFile(exportReport)
+	require.NoError(t, err)
+	var report runReport
+	require.NoError(t, json.Unmarshal(data, &report))
+
+	assert.False(t, report.Success)
+	assert.Equal(t, exitPartialFailure, report.ExitCode)
+	assert.Equal(t, "1 of 2 context(s) failed", report.Error)
+	assert.Equal(t, 2, report.Totals.Contexts)
+	assert.Equal(t, 1, report.Totals.FailedContexts)
+	require.Len(t, report.Contexts, 2)
+	assert.Equal(t, "prod", report.Contexts[0].Context)
+	assert.Equal(t, []string{"failed to create client for context prod: dial tcp: connection refused"}, report.Contexts[0].Errors)
+	assert.Equal(t, 1, report.Contexts[1].Exported)
+}
@@ -168,6 +168,10 @@ func disableStubs() {
 	stubNewClient = nil
 	stubDiscoverResources = nil
 	stubGetNamespaces = nil
+	stubCheckListAccess = nil
 	stubListHelmReleases = nil
 	stubGetHelmValues = nil
+	stubGetHelmUserValues = nil
+	stubGetHelmRelease = nil
+	stubGetHelmHistory = nil
 }
@@ -4,18 +4,19 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/davidschrooten/manifold-k8s/pkg/helm"
 	"github.com/davidschrooten/manifold-k8s/pkg/k8s"
 	"github.com/davidschrooten/manifold-k8s/pkg/selector"
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
-	"k8s.io/client-go/tools/clientcmd/api"
 )
 
 var (
 	helmValuesDryRun    bool
 	helmValuesOutputDir string
+	helmValuesMode      string
+	helmValuesHistory   int
 )
 
 var helmValuesCmd = &cobra.Command{
@@ -27,13 +28,7 @@ var helmValuesCmd = &cobra.Command{
 - Helm release(s)
 - Target directory
 
-This command requires the helm CLI to be installed and available in PATH.`,
-	PreRunE: func(cmd *cobra.Command, args []string) error {
-		if !helm.IsHelmInstalled() {
-			return fmt.Errorf("helm CLI is not installed or not in PATH. Please install helm: https://helm.sh/docs/intro/install/")
-		}
-		return nil
-	},
+Releases are read directly from Helm's release Secrets; the helm CLI is not required.`,
 	RunE: runHelmValuesInteractive,
 }
 
@@ -42,20 +37,22 @@ func init() {
 
 	helmValuesCmd.Flags().BoolVar(&helmValuesDryRun, "dry-run", false, "preview what would be downloaded without writing files")
 	helmValuesCmd.Flags().StringVarP(&helmValuesOutputDir, "output", "o", "", "output directory (will be prompted if not provided)")
+	helmValuesCmd.Flags().StringVar(&helmValuesMode, "values", helm.ValuesComputed, "values to export: user, computed or both")
+	helmValuesCmd.Flags().IntVar(&helmValuesHistory, "history", 0, "also export values and metadata of the last N revisions of each release")
 }
 
 // runHelmValuesInteractive is excluded from coverage as it requires user interaction
 // coverage:ignore
 func runHelmValuesInteractive(cmd *cobra.Command, args []string) error {
-	// Load kubeconfig (use stub if available)
-	kubeconfigPath := viper.GetString("kubeconfig")
-	var err error
-	var config *api.Config
-	if stubLoadKubeConfig != nil {
-		config, err = stubLoadKubeConfig(kubeconfigPath)
-	} else {
-		config, err = k8s.LoadKubeConfig(kubeconfigPath)
+	if err := helm.ValidateValuesMode(helmValuesMode); err != nil {
+		return err
+	}
+	if helmValuesHistory < 0 {
+		return fmt.Errorf("--history must not be negative")
 	}
+
+	// Load kubeconfig
+	config, err := loadKubeConfig()
 	if err != nil {
 		return fmt.Errorf("failed to load kubeconfig: %w", err)
 	}
@@ -75,15 +72,11 @@ func runHelmValuesInteractive(cmd *cobra.Command, args []string) error {
 		fmt.Printf("\n=== Processing context: %s ===\n", contextName)
 
 		// Create client for this context
-		var client *k8s.Client
-		if stubNewClient != nil {
-			client, err = stubNewClient(config, contextName)
-		} else {
-			client, err = k8s.NewClient(config, contextName)
-		}
+		client, err := newClient(config, contextName)
 		if err != nil {
 			return fmt.Errorf("failed to create client for context %s: %w", contextName, err)
 		}
+		fmt.Printf("Using identity: %s\n", client.Identity())
 
 		// Get namespaces
 		ctx := cmd.Context()
@@ -119,14 +112,9 @@ func runHelmValuesInteractive(cmd *cobra.Command, args []string) error {
 			fmt.Printf("\n--- Namespace: %s ---\n", namespace)
 
 			// List Helm releases in this namespace
-			var releases []helm.Release
-			if stubListHelmReleases != nil {
-				releases, err = stubListHelmReleases(namespace)
-			} else {
-				releases, err = helm.ListReleasesWithContext(namespace, contextName)
-			}
+			releases, err := listHelmReleases(ctx, client, namespace, nil)
 			if err != nil {
-				fmt.Fprintf(os.Stderr, "Warning: failed to list Helm releases in %s: %v\n", namespace, err)
+				client.Logger().Warn("failed to list Helm releases", "namespace", namespace, "error", err)
 				continue
 			}
 
@@ -144,32 +132,18 @@ func runHelmValuesInteractive(cmd *cobra.Command, args []string) error {
 					continue
 				}
 
-				// Get values
-				var values string
-				if stubGetHelmValues != nil {
-					values, err = stubGetHelmValues(release.Name, namespace)
-				} else {
-					values, err = helm.GetValuesWithContext(release.Name, namespace, contextName)
-				}
+				nsDir := filepath.Join(outputDir, contextName, namespace)
+				files, err := exportReleaseValues(ctx, client, namespace, release.Name, nsDir, helmValuesMode)
 				if err != nil {
-					fmt.Fprintf(os.Stderr, "Warning: failed to get values for %s: %v\n", release.Name, err)
+					client.Logger().Warn("failed to export Helm values", "namespace", namespace, "release", release.Name, "error", err)
 					continue
 				}
 
-				// Write to file
-				nsDir := filepath.Join(outputDir, contextName, namespace)
-				if err := os.MkdirAll(nsDir, 0755); err != nil {
-					fmt.Fprintf(os.Stderr, "Warning: failed to create directory %s: %v\n", nsDir, err)
-					continue
-				}
+				fmt.Printf("Exported: %s/%s -> %s\n", namespace, release.Name, strings.Join(files, ", "))
 
-				filename := filepath.Join(nsDir, fmt.Sprintf("%s-values.yaml", release.Name))
-				if err := os.WriteFile(filename, []byte(values), 0644); err != nil {
-					fmt.Fprintf(os.Stderr, "Warning: failed to write %s: %v\n", filename, err)
-					continue
+				if helmValuesHistory > 0 {
+					exportReleaseHistory(ctx, client, namespace, release.Name, filepath.Join(nsDir, release.Name), helmValuesMode, helmValuesHistory, newContextLog(contextName, os.Stdout))
 				}
-
-				fmt.Printf("Exported: %s/%s -> %s\n", namespace, release.Name, filename)
 			}
 		}
 	}
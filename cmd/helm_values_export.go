@@ -1,14 +1,17 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 
 	"github.com/davidschrooten/manifold-k8s/pkg/helm"
 	"github.com/davidschrooten/manifold-k8s/pkg/k8s"
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/tools/clientcmd/api"
 )
 
@@ -19,6 +22,22 @@ var (
 	helmExportNamespaces []string
 	helmExportReleases   []string
 	helmExportAll        bool
+	helmExportInclude    []string
+	helmExportValues     string
+	helmExportHistory    int
+	helmExportGitOps     string
+	helmExportGitValues  string
+	helmExportChartRepos map[string]string
+	helmExportGitRepo    string
+	helmExportHelmfile   bool
+	helmExportAllNs      bool
+	helmExportStatus     []string
+	helmExportChart      string
+	helmExportChartVer   string
+	helmExportNameRegex  string
+	helmExportAllCtx     bool
+	helmExportReport     string
+	helmExportFailOn     string
 )
 
 var helmValuesExportCmd = &cobra.Command{
@@ -29,17 +48,22 @@ var helmValuesExportCmd = &cobra.Command{
 This command requires all parameters to be provided via flags and does not prompt for input.
 It is designed for scripting and CI/CD pipelines.
 
-Requires the helm CLI to be installed and available in PATH.
+Releases are read directly from Helm's release Secrets; the helm CLI is not required.
 
 Examples:
   manifold-k8s helm-values-export --context prod --namespaces default --releases myapp -o ./output
-  manifold-k8s helm-values-export --context staging --namespaces app1,app2 --all -o ./helm-backup`,
-	PreRunE: func(cmd *cobra.Command, args []string) error {
-		if !helm.IsHelmInstalled() {
-			return fmt.Errorf("helm CLI is not installed or not in PATH. Please install helm: https://helm.sh/docs/intro/install/")
-		}
-		return nil
-	},
+  manifold-k8s helm-values-export --context staging --namespaces app1,app2 --all -o ./helm-backup
+  manifold-k8s helm-values-export -c prod --all-namespaces --all --status deployed,failed,pending-upgrade -o ./helm-backup
+  manifold-k8s helm-values-export -c prod -A --all --chart ingress-nginx --chart-version "< 4.0" -o ./upgrade-plan
+  manifold-k8s helm-values-export -c "prod-*,staging" -A --all -o ./helm-backup
+  manifold-k8s helm-values-export --all-contexts -A --all -o ./helm-backup
+  manifold-k8s helm-values-export -c prod -n default --all --include manifest,hooks,notes,metadata -o ./helm-backup
+  manifold-k8s helm-values-export -c prod -n default --all --values both -o ./helm-backup
+  manifold-k8s helm-values-export -c prod -n default -r myapp --history 5 -o ./helm-backup
+  manifold-k8s helm-values-export -c prod -n default --all --values user --gitops-format flux \
+    --chart-repo ingress-nginx=https://kubernetes.github.io/ingress-nginx -o ./gitops
+  manifold-k8s helm-values-export -c prod -n default --all --values user --helmfile -o ./helm-backup
+  manifold-k8s helm-values-export -c prod -A --all -o ./helm-backup --report helm-report.json`,
 	RunE: runHelmValuesExport,
 }
 
@@ -48,69 +72,201 @@ func init() {
 
 	helmValuesExportCmd.Flags().BoolVar(&helmExportDryRun, "dry-run", false, "preview what would be exported without writing files")
 	helmValuesExportCmd.Flags().StringVarP(&helmExportOutputDir, "output", "o", "", "output directory (required)")
-	helmValuesExportCmd.Flags().StringVarP(&helmExportCtx, "context", "c", "", "kubernetes context (required)")
-	helmValuesExportCmd.Flags().StringSliceVarP(&helmExportNamespaces, "namespaces", "n", nil, "namespaces to export (comma-separated, required)")
+	helmValuesExportCmd.Flags().StringVarP(&helmExportCtx, "context", "c", "", "kubernetes context(s): comma-separated names or globs (required unless --all-contexts)")
+	helmValuesExportCmd.Flags().BoolVar(&helmExportAllCtx, "all-contexts", false, "export from every context in kubeconfig")
+	helmValuesExportCmd.Flags().StringSliceVarP(&helmExportNamespaces, "namespaces", "n", nil, "namespaces to export (comma-separated, required unless --all-namespaces)")
+	helmValuesExportCmd.Flags().BoolVarP(&helmExportAllNs, "all-namespaces", "A", false, "export releases from all namespaces, listed in a single call")
+	helmValuesExportCmd.Flags().StringSliceVar(&helmExportStatus, "status", nil, "only export releases with these statuses (comma-separated, default deployed,failed)")
 	helmValuesExportCmd.Flags().StringSliceVarP(&helmExportReleases, "releases", "r", nil, "helm releases to export (comma-separated)")
 	helmValuesExportCmd.Flags().BoolVarP(&helmExportAll, "all", "a", false, "export all helm releases")
+	helmValuesExportCmd.Flags().StringVar(&helmExportChart, "chart", "", "only export releases whose chart name matches this glob (e.g. ingress-*)")
+	helmValuesExportCmd.Flags().StringVar(&helmExportChartVer, "chart-version", "", "only export releases whose chart version satisfies this semver constraint (e.g. \"< 4.0\")")
+	helmValuesExportCmd.Flags().StringVar(&helmExportNameRegex, "release-regex", "", "only export releases whose name matches this regular expression")
+	helmValuesExportCmd.Flags().StringVar(&helmExportValues, "values", helm.ValuesComputed, "values to export: user, computed or both")
+	helmValuesExportCmd.Flags().IntVar(&helmExportHistory, "history", 0, "also export values and metadata of the last N revisions of each release")
+	helmValuesExportCmd.Flags().StringVar(&helmExportGitOps, "gitops-format", "", "also generate GitOps manifests for each release: argocd or flux")
+	helmValuesExportCmd.Flags().StringVar(&helmExportGitValues, "gitops-values", helm.GitOpsValuesInline, "how GitOps manifests carry values: inline or ref")
+	helmValuesExportCmd.Flags().StringToStringVar(&helmExportChartRepos, "chart-repo", nil, "chart repository URLs for GitOps manifests and helmfile.yaml (chart=url, comma-separated)")
+	helmValuesExportCmd.Flags().StringVar(&helmExportGitRepo, "gitops-git-repo", "", "git repository the export is committed to, for Argo CD values references")
+	helmValuesExportCmd.Flags().BoolVar(&helmExportHelmfile, "helmfile", false, "also write a helmfile.yaml describing the exported releases")
+	helmValuesExportCmd.Flags().StringSliceVar(&helmExportInclude, "include", nil, "release parts to export besides values: manifest, hooks, notes, metadata (comma-separated)")
+	helmValuesExportCmd.Flags().StringVar(&helmExportReport, "report", "", "also write a JSON report of the run to this file, or to stdout with - (progress then goes to stderr)")
+	helmValuesExportCmd.Flags().StringVar(&helmExportFailOn, "fail-on", failOnError, "problems that fail the run with a non-zero exit code: warning, error or never")
 
-	_ = helmValuesExportCmd.MarkFlagRequired("context")
-	_ = helmValuesExportCmd.MarkFlagRequired("namespaces")
+	helmValuesExportCmd.MarkFlagsOneRequired("context", "all-contexts")
+	helmValuesExportCmd.MarkFlagsMutuallyExclusive("context", "all-contexts")
+	helmValuesExportCmd.MarkFlagsOneRequired("namespaces", "all-namespaces")
+	helmValuesExportCmd.MarkFlagsMutuallyExclusive("namespaces", "all-namespaces")
 	_ = helmValuesExportCmd.MarkFlagRequired("output")
 }
 
 func runHelmValuesExport(cmd *cobra.Command, args []string) error {
+	ctx := context.Background()
 	// Validate flags
 	if !helmExportAll && len(helmExportReleases) == 0 {
 		return fmt.Errorf("must specify either --releases or --all")
 	}
-
-	// Load kubeconfig
-	kubeconfigPath := viper.GetString("kubeconfig")
-	var err error
-	var config *api.Config
-	if stubLoadKubeConfig != nil {
-		config, err = stubLoadKubeConfig(kubeconfigPath)
-	} else {
-		config, err = k8s.LoadKubeConfig(kubeconfigPath)
+	if err := helm.ValidateStatuses(helmExportStatus); err != nil {
+		return err
 	}
+	filter, err := helm.NewFilter(helmExportChart, helmExportChartVer, helmExportNameRegex)
 	if err != nil {
-		return fmt.Errorf("failed to load kubeconfig: %w", err)
+		return err
+	}
+	if err := helm.ValidateValuesMode(helmExportValues); err != nil {
+		return err
+	}
+	if err := helm.ValidateParts(helmExportInclude); err != nil {
+		return err
+	}
+	if helmExportHistory < 0 {
+		return fmt.Errorf("--history must not be negative")
+	}
+	gitOpsOpts := helm.GitOpsOptions{
+		Format:     helmExportGitOps,
+		ValuesMode: helmExportGitValues,
+		ChartRepos: helmExportChartRepos,
+		GitRepo:    helmExportGitRepo,
+	}
+	if helmExportGitOps != "" {
+		if err := gitOpsOpts.Validate(); err != nil {
+			return err
+		}
+	}
+	if len(helmExportNamespaces) == 0 && !helmExportAllNs {
+		return fmt.Errorf("must specify either --namespaces or --all-namespaces")
 	}
 
-	// Verify context exists
-	// Create client to validate context (not used for Helm operations)
-	if stubNewClient != nil {
-		_, err = stubNewClient(config, helmExportCtx)
-	} else {
-		_, err = k8s.NewClient(config, helmExportCtx)
+	if helmExportCtx == "" && !helmExportAllCtx {
+		return fmt.Errorf("must specify either --context or --all-contexts")
+	}
+	if err := validateFailOn(helmExportFailOn); err != nil {
+		return err
 	}
+
+	report := newRunReport("helm-values-export", helmExportOutputDir, helmExportDryRun)
+	runLog := newContextLog("", progressOutput(helmExportReport))
+	results, err := exportHelmReleases(ctx, filter, gitOpsOpts, runLog)
+	if err == nil {
+		err = runError(results, runLog.report, helmExportFailOn)
+	}
+	report.finish(results, runLog.report, err)
+	if helmExportReport != "" {
+		if reportErr := report.write(helmExportReport); reportErr != nil && err == nil {
+			err = reportErr
+		}
+	}
+	return err
+}
+
+// exportHelmReleases exports from the contexts selected by the flags, one after another
+// Steps covering the whole run, such as writing helmfile.yaml, go through runLog. Failed
+// contexts are reported in the results; the error is only set when the run could not complete.
+func exportHelmReleases(ctx context.Context, filter *helm.Filter, gitOpsOpts helm.GitOpsOptions, runLog *contextLog) ([]contextResult, error) {
+	// Load kubeconfig
+	config, err := loadKubeConfig()
 	if err != nil {
-		return fmt.Errorf("failed to create client for context %s: %w", helmExportCtx, err)
+		return nil, fmt.Errorf("failed to load kubeconfig: %w", err)
 	}
 
-	fmt.Printf("Using context: %s\n", helmExportCtx)
-	fmt.Printf("Exporting from %d namespace(s): %v\n", len(helmExportNamespaces), helmExportNamespaces)
+	contexts, err := resolveContexts(config, helmExportCtx, helmExportAllCtx)
+	if err != nil {
+		return nil, err
+	}
+	if len(contexts) > 1 {
+		runLog.printf("Exporting from %d context(s): %v\n", len(contexts), contexts)
+	}
+
+	// Export each context in turn; a failing context does not stop the others
+	var results []contextResult
+	var helmfileReleases []helm.HelmfileRelease
+	for _, contextName := range contexts {
+		if len(contexts) > 1 {
+			runLog.printf("\n=== Context: %s ===\n", contextName)
+		}
+		result, releases := exportHelmContext(ctx, config, contextName, filter, gitOpsOpts, newContextLog(contextName, runLog.out))
+		results = append(results, result)
+		helmfileReleases = append(helmfileReleases, releases...)
+	}
+
+	if helmExportHelmfile && !helmExportDryRun {
+		writeHelmfile(helmfileReleases, runLog)
+	}
 
 	var exportedCount int
+	for _, result := range results {
+		exportedCount += result.exported
+	}
 
-	// Process each namespace
-	for _, namespace := range helmExportNamespaces {
-		fmt.Printf("\n--- Namespace: %s ---\n", namespace)
+	if !helmExportDryRun {
+		runLog.printf("\n✓ Exported %d Helm release value(s) to %s\n", exportedCount, helmExportOutputDir)
+	}
+	runLog.printf("%s", formatContextResults(results, "release(s)"))
 
-		// List Helm releases in this namespace
-		var releases []helm.Release
-		if stubListHelmReleases != nil {
-			releases, err = stubListHelmReleases(namespace)
-		} else {
-			releases, err = helm.ListReleasesWithContext(namespace, helmExportCtx)
-		}
+	return results, nil
+}
+
+// exportHelmContext exports the Helm releases selected by the flags from one context
+// into <output>/<context>/<namespace>/. The context fails when no client can be created
+// or no release could be listed, e.g. because the cluster is unreachable.
+func exportHelmContext(ctx context.Context, config *api.Config, contextName string, filter *helm.Filter, gitOpsOpts helm.GitOpsOptions, log *contextLog) (contextResult, []helm.HelmfileRelease) {
+	result := contextResult{context: contextName}
+	var helmfileReleases []helm.HelmfileRelease
+
+	// Create client for this context
+	client, err := newClient(config, contextName)
+	if err != nil {
+		result.err = fmt.Errorf("failed to create client for context %s: %w", contextName, err)
+		return log.done(result), nil
+	}
+	result.identity = client.Identity()
+
+	log.printf("Using context: %s\n", contextName)
+	log.printf("Using identity: %s\n", result.identity)
+
+	// With --all-namespaces, list releases cluster-wide once and group them by namespace
+	namespaces := helmExportNamespaces
+	releasesByNamespace := make(map[string][]helm.Release)
+	if helmExportAllNs {
+		releases, err := listHelmReleases(ctx, client, metav1.NamespaceAll, helmExportStatus)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Warning: failed to list Helm releases in %s: %v\n", namespace, err)
-			continue
+			result.err = fmt.Errorf("failed to list Helm releases in all namespaces: %w", err)
+			return log.done(result), nil
 		}
+		namespaces = nil
+		for _, release := range releases {
+			if _, seen := releasesByNamespace[release.Namespace]; !seen {
+				namespaces = append(namespaces, release.Namespace)
+			}
+			releasesByNamespace[release.Namespace] = append(releasesByNamespace[release.Namespace], release)
+		}
+		sort.Strings(namespaces)
+		log.printf("Found %d Helm release(s) in %d namespace(s)\n", len(releases), len(namespaces))
+	} else {
+		log.printf("Exporting from %d namespace(s): %v\n", len(helmExportNamespaces), helmExportNamespaces)
+	}
+	log.namespaces(namespaces)
+
+	var listErr error
+	var listFailures int
 
+	// Process each namespace
+	for _, namespace := range namespaces {
+		log.printf("\n--- Namespace: %s ---\n", namespace)
+
+		// List Helm releases in this namespace, unless already listed cluster-wide
+		releases := releasesByNamespace[namespace]
+		if !helmExportAllNs {
+			releases, err = listHelmReleases(ctx, client, namespace, helmExportStatus)
+			if err != nil {
+				log.errorf("failed to list Helm releases in %s: %w", namespace, err)
+				listErr = err
+				listFailures++
+				continue
+			}
+		}
 		if len(releases) == 0 {
-			fmt.Printf("No Helm releases found in namespace %s\n", namespace)
+			log.printf("No Helm releases found in namespace %s\n", namespace)
 			continue
 		}
 
@@ -118,7 +274,7 @@ func runHelmValuesExport(cmd *cobra.Command, args []string) error {
 		var releasesToExport []helm.Release
 		if helmExportAll {
 			releasesToExport = releases
-			fmt.Printf("Exporting all %d Helm release(s)\n", len(releases))
+			log.printf("Exporting all %d Helm release(s)\n", len(releases))
 		} else {
 			// Build a map of requested releases
 			requestedMap := make(map[string]bool)
@@ -134,53 +290,365 @@ func runHelmValuesExport(cmd *cobra.Command, args []string) error {
 			}
 
 			if len(releasesToExport) == 0 {
-				fmt.Printf("None of the requested releases found in namespace %s\n", namespace)
+				log.printf("None of the requested releases found in namespace %s\n", namespace)
 				continue
 			}
 
-			fmt.Printf("Exporting %d Helm release(s): %v\n", len(releasesToExport), helmExportReleases)
+			log.printf("Exporting %d Helm release(s): %v\n", len(releasesToExport), helmExportReleases)
+		}
+
+		// Narrow down by chart, chart version and release name
+		if !filter.IsEmpty() {
+			releasesToExport = helm.FilterReleases(releasesToExport, filter)
+			if len(releasesToExport) == 0 {
+				log.printf("No releases in namespace %s match the filters\n", namespace)
+				continue
+			}
+			log.printf("%d Helm release(s) match the filters\n", len(releasesToExport))
 		}
 
 		// Export values for each release
 		for _, release := range releasesToExport {
 			if helmExportDryRun {
-				fmt.Printf("[DRY-RUN] Would export: %s/%s (%s)\n", namespace, release.Name, release.Chart)
+				log.printf("[DRY-RUN] Would export: %s/%s (%s)\n", namespace, release.Name, release.Chart)
+				if len(helmExportInclude) > 0 {
+					log.printf("[DRY-RUN]   with: %s\n", strings.Join(helmExportInclude, ", "))
+				}
+				if helmExportGitOps != "" {
+					log.printf("[DRY-RUN]   with %s manifests\n", helmExportGitOps)
+				}
+				if helmExportHistory > 0 {
+					log.printf("[DRY-RUN]   with history of the last %d revision(s)\n", helmExportHistory)
+				}
+				log.exported("releases")
+				result.exported++
 				continue
 			}
 
-			// Get values
-			var values string
-			if stubGetHelmValues != nil {
-				values, err = stubGetHelmValues(release.Name, namespace)
-			} else {
-				values, err = helm.GetValuesWithContext(release.Name, namespace, helmExportCtx)
-			}
+			nsDir := filepath.Join(helmExportOutputDir, contextName, namespace)
+			files, err := exportReleaseValues(ctx, client, namespace, release.Name, nsDir, helmExportValues)
 			if err != nil {
-				fmt.Fprintf(os.Stderr, "Warning: failed to get values for %s: %v\n", release.Name, err)
+				log.errorf("%w", err)
 				continue
 			}
 
-			// Write to file
-			nsDir := filepath.Join(helmExportOutputDir, helmExportCtx, namespace)
-			if err := os.MkdirAll(nsDir, 0755); err != nil {
-				fmt.Fprintf(os.Stderr, "Warning: failed to create directory %s: %v\n", nsDir, err)
+			log.printf("Exported: %s/%s -> %s\n", namespace, release.Name, strings.Join(files, ", "))
+			log.exported("releases", files...)
+			result.exported++
+
+			if len(helmExportInclude) > 0 {
+				exportReleaseParts(ctx, client, namespace, release, filepath.Join(nsDir, release.Name), log)
+			}
+			if helmExportHelmfile || helmExportGitOps != "" {
+				valuesFile, err := userValuesFile(ctx, client, namespace, release.Name, nsDir, files, log)
+				if err != nil {
+					log.errorf("%w", err)
+				} else {
+					if helmExportHelmfile {
+						helmfileReleases = append(helmfileReleases, helm.HelmfileRelease{
+							Release:     helm.Release{Name: release.Name, Namespace: namespace, ChartName: release.ChartName, ChartVersion: release.ChartVersion},
+							KubeContext: contextName,
+							ValuesFiles: []string{outputRelativePath(valuesFile)},
+						})
+					}
+					if helmExportGitOps != "" {
+						release.Namespace = namespace
+						exportGitOps(release, valuesFile, filepath.Join(nsDir, release.Name), gitOpsOpts, log)
+					}
+				}
+			}
+			if helmExportHistory > 0 {
+				exportReleaseHistory(ctx, client, namespace, release.Name, filepath.Join(nsDir, release.Name), helmExportValues, helmExportHistory, log)
+			}
+		}
+	}
+
+	// A context where no namespace could be listed is treated as unreachable
+	if listFailures > 0 && listFailures == len(namespaces) {
+		result.err = fmt.Errorf("failed to list Helm releases in any namespace of context %s: %w", contextName, listErr)
+	}
+
+	return log.done(result), helmfileReleases
+}
+
+// listHelmReleases lists the Helm releases with the given statuses in a namespace,
+// or in all namespaces when namespace is empty
+func listHelmReleases(ctx context.Context, client *k8s.Client, namespace string, statuses []string) ([]helm.Release, error) {
+	if stubListHelmReleases != nil {
+		return stubListHelmReleases(namespace)
+	}
+	return helm.ListReleasesByStatus(ctx, client, namespace, statuses)
+}
+
+// exportReleaseValues writes the values of a release into nsDir and returns the files written
+// The user or computed values go to <release>-values.yaml; both writes values.user.yaml and
+// values.computed.yaml side by side in the release directory, user values first.
+func exportReleaseValues(ctx context.Context, client *k8s.Client, namespace, releaseName, nsDir, mode string) ([]string, error) {
+	type valuesFile struct {
+		user bool
+		path string
+	}
+
+	files := []valuesFile{{user: mode == helm.ValuesUser, path: filepath.Join(nsDir, releaseName+"-values.yaml")}}
+	if mode == helm.ValuesBoth {
+		releaseDir := filepath.Join(nsDir, releaseName)
+		files = []valuesFile{
+			{user: true, path: filepath.Join(releaseDir, "values.user.yaml")},
+			{user: false, path: filepath.Join(releaseDir, "values.computed.yaml")},
+		}
+	}
+
+	var written []string
+	for _, file := range files {
+		if err := writeReleaseValues(ctx, client, namespace, releaseName, file.path, file.user); err != nil {
+			return written, err
+		}
+		written = append(written, file.path)
+	}
+
+	return written, nil
+}
+
+// userValuesFile returns the file of user-supplied values that GitOps manifests and
+// helmfile.yaml are built from, among the files exported for a release. When only the
+// computed values were exported, the user values are written to values.user.yaml in the
+// release directory: generated manifests should not pin every default of the installed chart
+// version, or a chart upgrade would keep its stale defaults.
+func userValuesFile(ctx context.Context, client *k8s.Client, namespace, releaseName, nsDir string, files []string, log *contextLog) (string, error) {
+	if helmExportValues != helm.ValuesComputed {
+		return files[0], nil
+	}
+
+	path := filepath.Join(nsDir, releaseName, "values.user.yaml")
+	if err := writeReleaseValues(ctx, client, namespace, releaseName, path, true); err != nil {
+		return "", err
+	}
+	log.wrote(path)
+	return path, nil
+}
+
+// writeReleaseValues writes the user or computed values of a release to path
+func writeReleaseValues(ctx context.Context, client *k8s.Client, namespace, releaseName, path string, user bool) error {
+	var values string
+	var err error
+	switch {
+	case user && stubGetHelmUserValues != nil:
+		values, err = stubGetHelmUserValues(releaseName, namespace)
+	case user:
+		values, err = helm.GetUserValues(ctx, client, releaseName, namespace)
+	case stubGetHelmValues != nil:
+		values, err = stubGetHelmValues(releaseName, namespace)
+	default:
+		values, err = helm.GetValues(ctx, client, releaseName, namespace)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get values for %s: %w", releaseName, err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create directory %s: %w", filepath.Dir(path), err)
+	}
+	if err := os.WriteFile(path, []byte(values), 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return nil
+}
+
+// exportReleaseParts writes the requested release artefacts into the release directory
+// Failures are reported as warnings so the values export itself is not lost.
+func exportReleaseParts(ctx context.Context, client *k8s.Client, namespace string, release helm.Release, releaseDir string, log *contextLog) {
+	var details *helm.ReleaseDetails
+	var err error
+	if stubGetHelmRelease != nil {
+		details, err = stubGetHelmRelease(release.Name, namespace)
+	} else {
+		details, err = helm.GetRelease(ctx, client, release.Name, namespace)
+	}
+	if err != nil {
+		log.errorf("failed to get release %s: %w", release.Name, err)
+		return
+	}
+
+	if err := os.MkdirAll(releaseDir, 0755); err != nil {
+		log.errorf("failed to create directory %s: %w", releaseDir, err)
+		return
+	}
+
+	for _, part := range helmExportInclude {
+		content, err := details.Artefact(part)
+		if err != nil {
+			log.errorf("failed to render %s for %s: %w", part, release.Name, err)
+			continue
+		}
+		if len(content) == 0 {
+			log.printf("  No %s for release %s\n", part, release.Name)
+			log.skip(namespace+"/"+release.Name+"/"+part, "release has no "+part)
+			continue
+		}
+
+		filename := filepath.Join(releaseDir, helm.ArtefactFile(part))
+		if err := os.WriteFile(filename, content, 0644); err != nil {
+			log.errorf("failed to write %s: %w", filename, err)
+			continue
+		}
+		log.printf("  Exported %s -> %s\n", part, filename)
+		log.exported(part, filename)
+	}
+}
+
+// exportReleaseHistory writes the values and metadata of the last max revisions of a release
+// into <release>/rev-<n>/, plus a CHANGELOG.md of the values keys changed between revisions
+func exportReleaseHistory(ctx context.Context, client *k8s.Client, namespace, releaseName, releaseDir, mode string, max int, log *contextLog) {
+	var history []*helm.ReleaseDetails
+	var err error
+	if stubGetHelmHistory != nil {
+		history, err = stubGetHelmHistory(releaseName, namespace, max)
+	} else {
+		history, err = helm.GetHistory(ctx, client, releaseName, namespace, max)
+	}
+	if err != nil {
+		log.errorf("failed to get history of %s: %w", releaseName, err)
+		return
+	}
+
+	type valuesFile struct {
+		user bool
+		name string
+	}
+	userFile := valuesFile{user: true, name: "values.user.yaml"}
+	computedFile := valuesFile{user: false, name: "values.computed.yaml"}
+
+	valuesFiles := []valuesFile{computedFile}
+	switch mode {
+	case helm.ValuesUser:
+		valuesFiles = []valuesFile{userFile}
+	case helm.ValuesBoth:
+		valuesFiles = []valuesFile{userFile, computedFile}
+	}
+
+	for _, revision := range history {
+		revDir := filepath.Join(releaseDir, "rev-"+revision.Revision)
+		if err := os.MkdirAll(revDir, 0755); err != nil {
+			log.errorf("failed to create directory %s: %w", revDir, err)
+			return
+		}
+
+		files := make(map[string][]byte)
+		for _, file := range valuesFiles {
+			values, err := revision.ValuesYAML(file.user)
+			if err != nil {
+				log.errorf("%w", err)
 				continue
 			}
+			files[file.name] = []byte(values)
+		}
+		metadata, err := revision.Artefact(helm.PartMetadata)
+		if err != nil {
+			log.errorf("%w", err)
+		} else {
+			files[helm.ArtefactFile(helm.PartMetadata)] = metadata
+		}
 
-			filename := filepath.Join(nsDir, fmt.Sprintf("%s-values.yaml", release.Name))
-			if err := os.WriteFile(filename, []byte(values), 0644); err != nil {
-				fmt.Fprintf(os.Stderr, "Warning: failed to write %s: %v\n", filename, err)
+		for name, content := range files {
+			filename := filepath.Join(revDir, name)
+			if err := os.WriteFile(filename, content, 0644); err != nil {
+				log.errorf("failed to write %s: %w", filename, err)
 				continue
 			}
+			log.wrote(filename)
+		}
+	}
+
+	changelog := helm.ValuesChangelog(releaseName, history, mode == helm.ValuesUser)
+	filename := filepath.Join(releaseDir, "CHANGELOG.md")
+	if err := os.WriteFile(filename, []byte(changelog), 0644); err != nil {
+		log.errorf("failed to write %s: %w", filename, err)
+		return
+	}
+	log.wrote(filename)
+	log.printf("  Exported history of %d revision(s) -> %s\n", len(history), releaseDir)
+}
+
+// outputRelativePath returns a path relative to the output directory, with forward slashes
+func outputRelativePath(path string) string {
+	relative, err := filepath.Rel(helmExportOutputDir, path)
+	if err != nil {
+		relative = path
+	}
+	return filepath.ToSlash(relative)
+}
 
-			fmt.Printf("Exported: %s/%s -> %s\n", namespace, release.Name, filename)
-			exportedCount++
+// exportGitOps writes Argo CD or Flux manifests for a release into its release directory,
+// using the exported values file for the values
+func exportGitOps(release helm.Release, valuesFile, releaseDir string, opts helm.GitOpsOptions, log *contextLog) {
+	values, err := os.ReadFile(valuesFile)
+	if err != nil {
+		log.errorf("failed to read %s: %w", valuesFile, err)
+		return
+	}
+
+	files, err := helm.GenerateGitOps(helm.GitOpsSource{
+		Release:    release,
+		Values:     string(values),
+		ValuesPath: outputRelativePath(valuesFile),
+	}, opts)
+	if err != nil {
+		log.errorf("failed to generate %s manifests for %s: %w", opts.Format, release.Name, err)
+		return
+	}
+	if _, known := opts.RepoURL(release.ChartName); !known {
+		log.warnf("no repository known for chart %s of %s; set --chart-repo %s=<url> or replace %s",
+			release.ChartName, release.Name, release.ChartName, helm.PlaceholderRepoURL)
+	}
+
+	if err := os.MkdirAll(releaseDir, 0755); err != nil {
+		log.errorf("failed to create directory %s: %w", releaseDir, err)
+		return
+	}
+
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		filename := filepath.Join(releaseDir, name)
+		if err := os.WriteFile(filename, files[name], 0644); err != nil {
+			log.errorf("failed to write %s: %w", filename, err)
+			continue
 		}
+		log.printf("  Generated %s -> %s\n", opts.Format, filename)
+		log.wrote(filename)
 	}
+}
 
-	if !helmExportDryRun {
-		fmt.Printf("\n✓ Exported %d Helm release value(s) to %s\n", exportedCount, helmExportOutputDir)
+// writeHelmfile writes a helmfile.yaml for the exported releases into the output directory
+func writeHelmfile(releases []helm.HelmfileRelease, log *contextLog) {
+	unknown := make(map[string]bool)
+	for _, r := range releases {
+		if _, known := helm.ChartRepoURL(helmExportChartRepos, r.Release.ChartName); !known && !unknown[r.Release.ChartName] {
+			unknown[r.Release.ChartName] = true
+			log.warnf("no repository known for chart %s; set --chart-repo %s=<url> or replace %s in helmfile.yaml",
+				r.Release.ChartName, r.Release.ChartName, helm.PlaceholderRepoURL)
+		}
 	}
 
-	return nil
+	data, err := helm.GenerateHelmfile(releases, helmExportChartRepos)
+	if err != nil {
+		log.errorf("%w", err)
+		return
+	}
+
+	if err := os.MkdirAll(helmExportOutputDir, 0755); err != nil {
+		log.errorf("failed to create directory %s: %w", helmExportOutputDir, err)
+		return
+	}
+	filename := filepath.Join(helmExportOutputDir, "helmfile.yaml")
+	if err := os.WriteFile(filename, data, 0644); err != nil {
+		log.errorf("failed to write %s: %w", filename, err)
+		return
+	}
+	log.printf("Wrote helmfile for %d release(s) -> %s\n", len(releases), filename)
+	log.wrote(filename)
 }
@@ -1,7 +1,12 @@
 package cmd
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/davidschrooten/manifold-k8s/pkg/helm"
@@ -36,6 +41,7 @@ func TestHelmValuesCmd_Flags(t *testing.T) {
 	}{
 		{"dry-run flag", "dry-run", "bool"},
 		{"output flag", "output", "string"},
+		{"values flag", "values", "string"},
 	}
 
 	for _, tt := range tests {
@@ -62,7 +68,7 @@ func TestHelmValuesExportCmd(t *testing.T) {
 	}
 
 	// Test that command has required flags
-	requiredFlags := []string{"context", "namespaces", "output"}
+	requiredFlags := []string{"output"}
 	for _, flag := range requiredFlags {
 		f := helmValuesExportCmd.Flag(flag)
 		if f == nil {
@@ -92,6 +98,22 @@ func TestHelmValuesExportCmd_Flags(t *testing.T) {
 		{"namespaces flag", "namespaces", "stringSlice"},
 		{"releases flag", "releases", "stringSlice"},
 		{"all flag", "all", "bool"},
+		{"values flag", "values", "string"},
+		{"include flag", "include", "stringSlice"},
+		{"history flag", "history", "int"},
+		{"gitops-format flag", "gitops-format", "string"},
+		{"gitops-values flag", "gitops-values", "string"},
+		{"chart-repo flag", "chart-repo", "stringToString"},
+		{"gitops-git-repo flag", "gitops-git-repo", "string"},
+		{"helmfile flag", "helmfile", "bool"},
+		{"all-namespaces flag", "all-namespaces", "bool"},
+		{"status flag", "status", "stringSlice"},
+		{"chart flag", "chart", "string"},
+		{"chart-version flag", "chart-version", "string"},
+		{"release-regex flag", "release-regex", "string"},
+		{"all-contexts flag", "all-contexts", "bool"},
+		{"report flag", "report", "string"},
+		{"fail-on flag", "fail-on", "string"},
 	}
 
 	for _, tt := range tests {
@@ -110,7 +132,7 @@ func TestHelmValuesExportCmd_Flags(t *testing.T) {
 
 func TestHelmValuesExportCmd_RequiredFlagsMarked(t *testing.T) {
 	// Test that required flags are properly marked
-	requiredFlags := []string{"context", "namespaces", "output"}
+	requiredFlags := []string{"output"}
 	for _, flagName := range requiredFlags {
 		flag := helmValuesExportCmd.Flag(flagName)
 		if flag == nil {
@@ -321,9 +343,16 @@ func TestRunHelmValuesExport_NoReleasesFound(t *testing.T) {
 	helmExportCtx = "test-context"
 	helmExportOutputDir = tempDir
 
+	// Finding no release is fine by default, and only fails with --fail-on warning
+	if err := runHelmValuesExport(nil, nil); err != nil {
+		t.Fatalf("runHelmValuesExport() error = %v", err)
+	}
+
+	helmExportFailOn = failOnWarning
+	defer func() { helmExportFailOn = failOnError }()
 	err := runHelmValuesExport(nil, nil)
-	if err != nil {
-		t.Fatalf("runHelmValuesExport failed: %v", err)
+	if code := exitCode(err); code != exitNothingExported {
+		t.Fatalf("runHelmValuesExport() error = %v, exit code %d, want %d", err, code, exitNothingExported)
 	}
 }
 
@@ -423,3 +452,768 @@ func TestRunHelmValuesExport_DryRun(t *testing.T) {
 		t.Fatalf("runHelmValuesExport failed: %v", err)
 	}
 }
+
+func TestRunHelmValuesExport_Include(t *testing.T) {
+	defer disableStubs()
+	defer func() {
+		helmExportAll = false
+		helmExportNamespaces = nil
+		helmExportCtx = ""
+		helmExportOutputDir = ""
+		helmExportInclude = nil
+	}()
+
+	stubLoadKubeConfig = func(path string) (*api.Config, error) {
+		return mockKubeConfig(), nil
+	}
+	stubNewClient = func(config *api.Config, context string) (*k8s.Client, error) {
+		return mockK8sClient(), nil
+	}
+	stubListHelmReleases = func(namespace string) ([]helm.Release, error) {
+		return []helm.Release{{Name: "myapp", Namespace: namespace, Chart: "myapp-1.0.0"}}, nil
+	}
+	stubGetHelmValues = func(releaseName, namespace string) (string, error) {
+		return "replicaCount: 3\n", nil
+	}
+	stubGetHelmRelease = func(releaseName, namespace string) (*helm.ReleaseDetails, error) {
+		return &helm.ReleaseDetails{
+			Release:  helm.Release{Name: releaseName, Namespace: namespace, Revision: "2"},
+			Manifest: "kind: Service\n",
+			Metadata: helm.ChartMetadata{Name: "myapp", Version: "1.0.0"},
+		}, nil
+	}
+
+	tempDir := t.TempDir()
+	helmExportAll = true
+	helmExportNamespaces = []string{"default"}
+	helmExportCtx = "test-context"
+	helmExportOutputDir = tempDir
+	helmExportInclude = []string{"manifest", "notes", "metadata"}
+
+	if err := runHelmValuesExport(nil, nil); err != nil {
+		t.Fatalf("runHelmValuesExport failed: %v", err)
+	}
+
+	nsDir := filepath.Join(tempDir, "test-context", "default")
+	if _, err := os.Stat(filepath.Join(nsDir, "myapp-values.yaml")); err != nil {
+		t.Errorf("values file not written: %v", err)
+	}
+	manifest, err := os.ReadFile(filepath.Join(nsDir, "myapp", "manifest.yaml"))
+	if err != nil || string(manifest) != "kind: Service\n" {
+		t.Errorf("manifest.yaml = %q, %v", manifest, err)
+	}
+	if _, err := os.Stat(filepath.Join(nsDir, "myapp", "metadata.yaml")); err != nil {
+		t.Errorf("metadata.yaml not written: %v", err)
+	}
+	// The release has no notes, so no NOTES.txt is written
+	if _, err := os.Stat(filepath.Join(nsDir, "myapp", "NOTES.txt")); !os.IsNotExist(err) {
+		t.Errorf("NOTES.txt should not be written for a release without notes, stat error = %v", err)
+	}
+}
+
+func TestRunHelmValuesExport_InvalidInclude(t *testing.T) {
+	defer func() {
+		helmExportAll = false
+		helmExportInclude = nil
+	}()
+
+	helmExportAll = true
+	helmExportInclude = []string{"manifest", "secrets"}
+
+	err := runHelmValuesExport(nil, nil)
+	if err == nil || !strings.Contains(err.Error(), "invalid release part") {
+		t.Errorf("runHelmValuesExport() error = %v, want invalid release part", err)
+	}
+}
+
+func TestRunHelmValuesExport_ValuesModes(t *testing.T) {
+	tests := []struct {
+		mode  string
+		files map[string]string
+	}{
+		{
+			mode:  "computed",
+			files: map[string]string{"myapp-values.yaml": "replicaCount: 3\nimage: nginx\n"},
+		},
+		{
+			mode:  "user",
+			files: map[string]string{"myapp-values.yaml": "replicaCount: 3\n"},
+		},
+		{
+			mode: "both",
+			files: map[string]string{
+				filepath.Join("myapp", "values.user.yaml"):     "replicaCount: 3\n",
+				filepath.Join("myapp", "values.computed.yaml"): "replicaCount: 3\nimage: nginx\n",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			defer disableStubs()
+			defer func() {
+				helmExportAll = false
+				helmExportNamespaces = nil
+				helmExportCtx = ""
+				helmExportOutputDir = ""
+				helmExportValues = "computed"
+			}()
+
+			stubLoadKubeConfig = func(path string) (*api.Config, error) {
+				return mockKubeConfig(), nil
+			}
+			stubNewClient = func(config *api.Config, context string) (*k8s.Client, error) {
+				return mockK8sClient(), nil
+			}
+			stubListHelmReleases = func(namespace string) ([]helm.Release, error) {
+				return []helm.Release{{Name: "myapp", Namespace: namespace, Chart: "myapp-1.0.0"}}, nil
+			}
+			stubGetHelmValues = func(releaseName, namespace string) (string, error) {
+				return "replicaCount: 3\nimage: nginx\n", nil
+			}
+			stubGetHelmUserValues = func(releaseName, namespace string) (string, error) {
+				return "replicaCount: 3\n", nil
+			}
+
+			tempDir := t.TempDir()
+			helmExportAll = true
+			helmExportNamespaces = []string{"default"}
+			helmExportCtx = "test-context"
+			helmExportOutputDir = tempDir
+			helmExportValues = tt.mode
+
+			if err := runHelmValuesExport(nil, nil); err != nil {
+				t.Fatalf("runHelmValuesExport failed: %v", err)
+			}
+
+			nsDir := filepath.Join(tempDir, "test-context", "default")
+			for file, want := range tt.files {
+				got, err := os.ReadFile(filepath.Join(nsDir, file))
+				if err != nil {
+					t.Errorf("%s not written: %v", file, err)
+					continue
+				}
+				if string(got) != want {
+					t.Errorf("%s = %q, want %q", file, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestRunHelmValuesExport_InvalidValuesMode(t *testing.T) {
+	defer func() {
+		helmExportAll = false
+		helmExportValues = "computed"
+	}()
+
+	helmExportAll = true
+	helmExportValues = "defaults"
+
+	err := runHelmValuesExport(nil, nil)
+	if err == nil || !strings.Contains(err.Error(), "invalid values mode") {
+		t.Errorf("runHelmValuesExport() error = %v, want invalid values mode", err)
+	}
+}
+
+func TestRunHelmValuesExport_History(t *testing.T) {
+	defer disableStubs()
+	defer func() {
+		helmExportAll = false
+		helmExportNamespaces = nil
+		helmExportCtx = ""
+		helmExportOutputDir = ""
+		helmExportValues = "computed"
+		helmExportHistory = 0
+	}()
+
+	stubLoadKubeConfig = func(path string) (*api.Config, error) {
+		return mockKubeConfig(), nil
+	}
+	stubNewClient = func(config *api.Config, context string) (*k8s.Client, error) {
+		return mockK8sClient(), nil
+	}
+	stubListHelmReleases = func(namespace string) ([]helm.Release, error) {
+		return []helm.Release{{Name: "myapp", Namespace: namespace, Chart: "myapp-1.0.0"}}, nil
+	}
+	stubGetHelmValues = func(releaseName, namespace string) (string, error) {
+		return "replicaCount: 3\n", nil
+	}
+	stubGetHelmUserValues = stubGetHelmValues
+	var requestedMax int
+	stubGetHelmHistory = func(releaseName, namespace string, max int) ([]*helm.ReleaseDetails, error) {
+		requestedMax = max
+		return []*helm.ReleaseDetails{
+			{Release: helm.Release{Name: releaseName, Revision: "4"}, UserValues: map[string]interface{}{"replicaCount": 2}},
+			{Release: helm.Release{Name: releaseName, Revision: "5"}, UserValues: map[string]interface{}{"replicaCount": 3}},
+		}, nil
+	}
+
+	tempDir := t.TempDir()
+	helmExportAll = true
+	helmExportNamespaces = []string{"default"}
+	helmExportCtx = "test-context"
+	helmExportOutputDir = tempDir
+	helmExportValues = "both"
+	helmExportHistory = 2
+
+	if err := runHelmValuesExport(nil, nil); err != nil {
+		t.Fatalf("runHelmValuesExport failed: %v", err)
+	}
+	if requestedMax != 2 {
+		t.Errorf("history requested %d revisions, want 2", requestedMax)
+	}
+
+	releaseDir := filepath.Join(tempDir, "test-context", "default", "myapp")
+	for _, rev := range []string{"rev-4", "rev-5"} {
+		for _, file := range []string{"values.user.yaml", "values.computed.yaml", "metadata.yaml"} {
+			if _, err := os.Stat(filepath.Join(releaseDir, rev, file)); err != nil {
+				t.Errorf("%s/%s not written: %v", rev, file, err)
+			}
+		}
+	}
+
+	user, err := os.ReadFile(filepath.Join(releaseDir, "rev-4", "values.user.yaml"))
+	if err != nil || string(user) != "replicaCount: 2\n" {
+		t.Errorf("rev-4/values.user.yaml = %q, %v", user, err)
+	}
+
+	changelog, err := os.ReadFile(filepath.Join(releaseDir, "CHANGELOG.md"))
+	if err != nil {
+		t.Fatalf("CHANGELOG.md not written: %v", err)
+	}
+	if !strings.Contains(string(changelog), "## Revision 5 (from 4)") || !strings.Contains(string(changelog), "- Changed: `replicaCount`") {
+		t.Errorf("CHANGELOG.md =\n%s", changelog)
+	}
+}
+
+func TestRunHelmValuesExport_NegativeHistory(t *testing.T) {
+	defer func() {
+		helmExportAll = false
+		helmExportHistory = 0
+	}()
+
+	helmExportAll = true
+	helmExportHistory = -1
+
+	if err := runHelmValuesExport(nil, nil); err == nil {
+		t.Error("runHelmValuesExport() expected error for negative --history, got nil")
+	}
+}
+
+func TestRunHelmValuesExport_GitOps(t *testing.T) {
+	defer disableStubs()
+	defer func() {
+		helmExportAll = false
+		helmExportNamespaces = nil
+		helmExportCtx = ""
+		helmExportOutputDir = ""
+		helmExportGitOps = ""
+		helmExportGitValues = "inline"
+		helmExportChartRepos = nil
+		helmExportGitRepo = ""
+	}()
+
+	stubLoadKubeConfig = func(path string) (*api.Config, error) {
+		return mockKubeConfig(), nil
+	}
+	stubNewClient = func(config *api.Config, context string) (*k8s.Client, error) {
+		return mockK8sClient(), nil
+	}
+	stubListHelmReleases = func(namespace string) ([]helm.Release, error) {
+		return []helm.Release{{Name: "myapp", Chart: "myapp-1.0.0", ChartName: "myapp", ChartVersion: "1.0.0"}}, nil
+	}
+	stubGetHelmValues = func(releaseName, namespace string) (string, error) {
+		return "replicaCount: 3\nimage:\n  pullPolicy: IfNotPresent\n", nil
+	}
+	stubGetHelmUserValues = func(releaseName, namespace string) (string, error) {
+		return "replicaCount: 3\n", nil
+	}
+
+	tests := []struct {
+		format string
+		files  []string
+	}{
+		{"argocd", []string{"application.yaml"}},
+		{"flux", []string{"helmrelease.yaml", "helmrepository.yaml"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			tempDir := t.TempDir()
+			helmExportAll = true
+			helmExportNamespaces = []string{"default"}
+			helmExportCtx = "test-context"
+			helmExportOutputDir = tempDir
+			helmExportGitOps = tt.format
+			helmExportChartRepos = map[string]string{"myapp": "https://charts.example.org"}
+
+			if err := runHelmValuesExport(nil, nil); err != nil {
+				t.Fatalf("runHelmValuesExport failed: %v", err)
+			}
+
+			releaseDir := filepath.Join(tempDir, "test-context", "default", "myapp")
+			for _, file := range tt.files {
+				data, err := os.ReadFile(filepath.Join(releaseDir, file))
+				if err != nil {
+					t.Errorf("%s not written: %v", file, err)
+					continue
+				}
+				if file != "helmrepository.yaml" && !strings.Contains(string(data), "namespace: default") {
+					t.Errorf("%s does not target the release namespace:\n%s", file, data)
+				}
+				// Chart defaults from the computed values are left out
+				if strings.Contains(string(data), "pullPolicy") {
+					t.Errorf("%s should only carry the user-supplied values:\n%s", file, data)
+				}
+			}
+		})
+	}
+}
+
+func TestRunHelmValuesExport_InvalidGitOpsFormat(t *testing.T) {
+	defer func() {
+		helmExportAll = false
+		helmExportGitOps = ""
+	}()
+
+	helmExportAll = true
+	helmExportGitOps = "fleet"
+
+	err := runHelmValuesExport(nil, nil)
+	if err == nil || !strings.Contains(err.Error(), "invalid GitOps format") {
+		t.Errorf("runHelmValuesExport() error = %v, want invalid GitOps format", err)
+	}
+}
+
+func TestRunHelmValuesExport_Helmfile(t *testing.T) {
+	defer disableStubs()
+	defer func() {
+		helmExportAll = false
+		helmExportNamespaces = nil
+		helmExportCtx = ""
+		helmExportOutputDir = ""
+		helmExportHelmfile = false
+		helmExportChartRepos = nil
+	}()
+
+	stubLoadKubeConfig = func(path string) (*api.Config, error) {
+		return mockKubeConfig(), nil
+	}
+	stubNewClient = func(config *api.Config, context string) (*k8s.Client, error) {
+		return mockK8sClient(), nil
+	}
+	stubListHelmReleases = func(namespace string) ([]helm.Release, error) {
+		return []helm.Release{{Name: "myapp", Chart: "myapp-1.0.0", ChartName: "myapp", ChartVersion: "1.0.0"}}, nil
+	}
+	stubGetHelmValues = func(releaseName, namespace string) (string, error) {
+		return "replicaCount: 3\n", nil
+	}
+	stubGetHelmUserValues = func(releaseName, namespace string) (string, error) {
+		return "replicaCount: 3\n", nil
+	}
+
+	tempDir := t.TempDir()
+	helmExportAll = true
+	helmExportNamespaces = []string{"default", "staging"}
+	helmExportCtx = "test-context"
+	helmExportOutputDir = tempDir
+	helmExportHelmfile = true
+	helmExportChartRepos = map[string]string{"myapp": "https://charts.example.org"}
+
+	if err := runHelmValuesExport(nil, nil); err != nil {
+		t.Fatalf("runHelmValuesExport failed: %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(tempDir, "helmfile.yaml"))
+	if err != nil {
+		t.Fatalf("helmfile.yaml not written: %v", err)
+	}
+	for _, want := range []string{
+		"kubeContext: test-context",
+		"- test-context/default/myapp/values.user.yaml",
+		"- test-context/staging/myapp/values.user.yaml",
+		"chart: charts-example-org/myapp",
+		"url: https://charts.example.org",
+	} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("helmfile.yaml missing %q:\n%s", want, data)
+		}
+	}
+}
+
+func TestRunHelmValuesExport_AllNamespaces(t *testing.T) {
+	defer disableStubs()
+	defer func() {
+		helmExportAll = false
+		helmExportAllNs = false
+		helmExportCtx = ""
+		helmExportOutputDir = ""
+	}()
+
+	stubLoadKubeConfig = func(path string) (*api.Config, error) {
+		return mockKubeConfig(), nil
+	}
+	stubNewClient = func(config *api.Config, context string) (*k8s.Client, error) {
+		return mockK8sClient(), nil
+	}
+	var listed []string
+	stubListHelmReleases = func(namespace string) ([]helm.Release, error) {
+		listed = append(listed, namespace)
+		return []helm.Release{
+			{Name: "api", Namespace: "payments", Chart: "api-1.0.0"},
+			{Name: "web", Namespace: "default", Chart: "web-1.0.0"},
+			{Name: "worker", Namespace: "payments", Chart: "worker-1.0.0"},
+		}, nil
+	}
+	stubGetHelmValues = func(releaseName, namespace string) (string, error) {
+		return "namespace: " + namespace + "\n", nil
+	}
+
+	tempDir := t.TempDir()
+	helmExportAll = true
+	helmExportAllNs = true
+	helmExportCtx = "test-context"
+	helmExportOutputDir = tempDir
+
+	if err := runHelmValuesExport(nil, nil); err != nil {
+		t.Fatalf("runHelmValuesExport failed: %v", err)
+	}
+
+	// Releases are listed cluster-wide in a single call
+	if len(listed) != 1 || listed[0] != "" {
+		t.Errorf("releases listed for namespaces %q, want one cluster-wide call", listed)
+	}
+
+	for _, file := range []string{
+		filepath.Join("default", "web-values.yaml"),
+		filepath.Join("payments", "api-values.yaml"),
+		filepath.Join("payments", "worker-values.yaml"),
+	} {
+		data, err := os.ReadFile(filepath.Join(tempDir, "test-context", file))
+		if err != nil {
+			t.Errorf("%s not written: %v", file, err)
+			continue
+		}
+		if want := "namespace: " + filepath.Dir(file) + "\n"; string(data) != want {
+			t.Errorf("%s = %q, want values from its own namespace", file, data)
+		}
+	}
+}
+
+func TestRunHelmValuesExport_NamespacesRequired(t *testing.T) {
+	defer func() {
+		helmExportAll = false
+	}()
+
+	helmExportAll = true
+
+	err := runHelmValuesExport(nil, nil)
+	if err == nil || !strings.Contains(err.Error(), "--all-namespaces") {
+		t.Errorf("runHelmValuesExport() error = %v, want --namespaces or --all-namespaces", err)
+	}
+}
+
+func TestRunHelmValuesExport_InvalidStatus(t *testing.T) {
+	defer func() {
+		helmExportAll = false
+		helmExportAllNs = false
+		helmExportStatus = nil
+	}()
+
+	helmExportAll = true
+	helmExportAllNs = true
+	helmExportStatus = []string{"deployed", "running"}
+
+	err := runHelmValuesExport(nil, nil)
+	if err == nil || !strings.Contains(err.Error(), "invalid release status") {
+		t.Errorf("runHelmValuesExport() error = %v, want invalid release status", err)
+	}
+}
+
+func TestRunHelmValuesExport_Filters(t *testing.T) {
+	defer disableStubs()
+	defer func() {
+		helmExportAll = false
+		helmExportNamespaces = nil
+		helmExportCtx = ""
+		helmExportOutputDir = ""
+		helmExportChart = ""
+		helmExportChartVer = ""
+		helmExportNameRegex = ""
+	}()
+
+	stubLoadKubeConfig = func(path string) (*api.Config, error) {
+		return mockKubeConfig(), nil
+	}
+	stubNewClient = func(config *api.Config, context string) (*k8s.Client, error) {
+		return mockK8sClient(), nil
+	}
+	stubListHelmReleases = func(namespace string) ([]helm.Release, error) {
+		return []helm.Release{
+			{Name: "edge", ChartName: "ingress-nginx", ChartVersion: "3.41.0"},
+			{Name: "edge-v2", ChartName: "ingress-nginx", ChartVersion: "4.10.1"},
+			{Name: "internal", ChartName: "ingress-nginx", ChartVersion: "3.2.0"},
+			{Name: "web", ChartName: "podinfo", ChartVersion: "1.0.0"},
+		}, nil
+	}
+	stubGetHelmValues = func(releaseName, namespace string) (string, error) {
+		return "{}\n", nil
+	}
+
+	tempDir := t.TempDir()
+	helmExportAll = true
+	helmExportNamespaces = []string{"default"}
+	helmExportCtx = "test-context"
+	helmExportOutputDir = tempDir
+	helmExportChart = "ingress-*"
+	helmExportChartVer = "< 4.0"
+	helmExportNameRegex = "^edge"
+
+	if err := runHelmValuesExport(nil, nil); err != nil {
+		t.Fatalf("runHelmValuesExport failed: %v", err)
+	}
+
+	entries, err := os.ReadDir(filepath.Join(tempDir, "test-context", "default"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Name() != "edge-values.yaml" {
+		var names []string
+		for _, entry := range entries {
+			names = append(names, entry.Name())
+		}
+		t.Errorf("exported %v, want only edge-values.yaml", names)
+	}
+}
+
+func TestRunHelmValuesExport_InvalidFilter(t *testing.T) {
+	defer func() {
+		helmExportAll = false
+		helmExportChartVer = ""
+	}()
+
+	helmExportAll = true
+	helmExportChartVer = "newer than 4"
+
+	err := runHelmValuesExport(nil, nil)
+	if err == nil || !strings.Contains(err.Error(), "invalid chart version constraint") {
+		t.Errorf("runHelmValuesExport() error = %v, want invalid chart version constraint", err)
+	}
+}
+
+func TestRunHelmValuesExport_MultipleContexts(t *testing.T) {
+	defer disableStubs()
+	defer func() {
+		helmExportAll = false
+		helmExportNamespaces = nil
+		helmExportCtx = ""
+		helmExportAllCtx = false
+		helmExportOutputDir = ""
+		helmExportHelmfile = false
+	}()
+
+	stubLoadKubeConfig = func(path string) (*api.Config, error) {
+		config := mockKubeConfig()
+		for _, name := range []string{"prod-eu", "prod-us", "staging"} {
+			config.Contexts[name] = &api.Context{Cluster: "test-cluster", AuthInfo: "test-user"}
+		}
+		return config, nil
+	}
+	stubNewClient = func(config *api.Config, contextName string) (*k8s.Client, error) {
+		if contextName == "prod-us" {
+			return nil, fmt.Errorf("dial tcp: connection refused")
+		}
+		return mockK8sClient(), nil
+	}
+	stubListHelmReleases = func(namespace string) ([]helm.Release, error) {
+		return []helm.Release{{Name: "myapp", Chart: "myapp-1.0.0", ChartName: "myapp"}}, nil
+	}
+	stubGetHelmValues = func(releaseName, namespace string) (string, error) {
+		return "replicaCount: 3\n", nil
+	}
+	stubGetHelmUserValues = func(releaseName, namespace string) (string, error) {
+		return "replicaCount: 3\n", nil
+	}
+
+	tempDir := t.TempDir()
+	helmExportAll = true
+	helmExportNamespaces = []string{"default"}
+	helmExportCtx = "prod-*,staging"
+	helmExportOutputDir = tempDir
+	helmExportHelmfile = true
+
+	err := runHelmValuesExport(nil, nil)
+	if err == nil || err.Error() != "1 of 3 context(s) failed" {
+		t.Errorf("runHelmValuesExport() error = %v, want 1 of 3 context(s) failed", err)
+	}
+
+	// The reachable contexts are still exported
+	for _, contextName := range []string{"prod-eu", "staging"} {
+		if _, err := os.Stat(filepath.Join(tempDir, contextName, "default", "myapp-values.yaml")); err != nil {
+			t.Errorf("values for context %s not written: %v", contextName, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(tempDir, "prod-us")); !os.IsNotExist(err) {
+		t.Errorf("nothing should be written for the failed context, stat error = %v", err)
+	}
+
+	helmfile, err := os.ReadFile(filepath.Join(tempDir, "helmfile.yaml"))
+	if err != nil {
+		t.Fatalf("helmfile.yaml not written: %v", err)
+	}
+	if !strings.Contains(string(helmfile), "kubeContext: prod-eu") || !strings.Contains(string(helmfile), "kubeContext: staging") {
+		t.Errorf("helmfile.yaml should list both exported contexts:\n%s", helmfile)
+	}
+}
+
+func TestRunHelmValuesExport_AllContextsUnreachableNamespaces(t *testing.T) {
+	defer disableStubs()
+	defer func() {
+		helmExportAll = false
+		helmExportNamespaces = nil
+		helmExportAllCtx = false
+		helmExportOutputDir = ""
+	}()
+
+	stubLoadKubeConfig = func(path string) (*api.Config, error) {
+		return mockKubeConfig(), nil
+	}
+	stubNewClient = func(config *api.Config, contextName string) (*k8s.Client, error) {
+		return mockK8sClient(), nil
+	}
+	stubListHelmReleases = func(namespace string) ([]helm.Release, error) {
+		return nil, fmt.Errorf("the server is unreachable")
+	}
+
+	helmExportAll = true
+	helmExportNamespaces = []string{"default", "apps"}
+	helmExportAllCtx = true
+	helmExportOutputDir = t.TempDir()
+
+	err := runHelmValuesExport(nil, nil)
+	if err == nil || !strings.Contains(err.Error(), "failed to list Helm releases in any namespace of context test-context") {
+		t.Errorf("runHelmValuesExport() error = %v, want the context reported as failed", err)
+	}
+}
+
+func TestRunHelmValuesExport_Report(t *testing.T) {
+	enableStubs()
+	defer disableStubs()
+	defer func() {
+		helmExportAll = false
+		helmExportNamespaces = nil
+		helmExportCtx = ""
+		helmExportOutputDir = ""
+		helmExportInclude = nil
+		helmExportReport = ""
+	}()
+
+	stubListHelmReleases = func(namespace string) ([]helm.Release, error) {
+		if namespace == "broken" {
+			return nil, fmt.Errorf("secrets is forbidden")
+		}
+		return []helm.Release{{Name: "myapp", Namespace: namespace, Chart: "myapp-1.0.0"}}, nil
+	}
+	stubGetHelmValues = func(releaseName, namespace string) (string, error) {
+		return "replicaCount: 3\n", nil
+	}
+	stubGetHelmRelease = func(releaseName, namespace string) (*helm.ReleaseDetails, error) {
+		return &helm.ReleaseDetails{Manifest: "kind: ConfigMap\n"}, nil
+	}
+
+	tempDir := t.TempDir()
+	helmExportAll = true
+	helmExportNamespaces = []string{"default", "broken"}
+	helmExportCtx = "test-context"
+	helmExportOutputDir = filepath.Join(tempDir, "out")
+	helmExportInclude = []string{helm.PartManifest, helm.PartNotes}
+	helmExportReport = filepath.Join(tempDir, "report.json")
+
+	// The failed namespace makes the run a partial failure
+	if err := runHelmValuesExport(nil, nil); exitCode(err) != exitPartialFailure {
+		t.Fatalf("runHelmValuesExport() error = %v, want a partial failure", err)
+	}
+
+	data, err := os.ReadFile(helmExportReport)
+	if err != nil {
+		t.Fatalf("report not written: %v", err)
+	}
+	var report runReport
+	if err := json.Unmarshal(data, &report); err != nil {
+		t.Fatalf("report is not valid JSON: %v", err)
+	}
+
+	if report.Command != "helm-values-export" || report.Success || report.ExitCode != exitPartialFailure || len(report.Contexts) != 1 {
+		t.Fatalf("unexpected report: %s", data)
+	}
+	ctxReport := report.Contexts[0]
+	if ctxReport.Context != "test-context" || ctxReport.Exported != 1 {
+		t.Errorf("context = %s, exported = %d", ctxReport.Context, ctxReport.Exported)
+	}
+	if ctxReport.Counts["releases"] != 1 || ctxReport.Counts[helm.PartManifest] != 1 {
+		t.Errorf("counts = %v", ctxReport.Counts)
+	}
+	if len(ctxReport.Files) != 2 {
+		t.Errorf("files = %v, want the values and the manifest", ctxReport.Files)
+	}
+	if len(ctxReport.Errors) != 1 || !strings.Contains(ctxReport.Errors[0], "failed to list Helm releases in broken") {
+		t.Errorf("errors = %v", ctxReport.Errors)
+	}
+	if len(ctxReport.Skipped) != 1 || ctxReport.Skipped[0].Item != "default/myapp/notes" {
+		t.Errorf("skipped = %v", ctxReport.Skipped)
+	}
+	if want := []string{"broken", "default"}; fmt.Sprint(ctxReport.Namespaces) != fmt.Sprint(want) {
+		t.Errorf("namespaces = %v, want %v", ctxReport.Namespaces, want)
+	}
+	if report.Totals.Errors != 1 || report.Totals.Exported != 1 {
+		t.Errorf("totals = %+v", report.Totals)
+	}
+}
+
+func TestRunHelmValuesExport_StdoutReport(t *testing.T) {
+	enableStubs()
+	defer disableStubs()
+	defer func() {
+		helmExportAll = false
+		helmExportNamespaces = nil
+		helmExportCtx = ""
+		helmExportOutputDir = ""
+		helmExportReport = ""
+	}()
+
+	stubListHelmReleases = func(namespace string) ([]helm.Release, error) {
+		return []helm.Release{{Name: "myapp", Namespace: namespace, Chart: "myapp-1.0.0"}}, nil
+	}
+	stubGetHelmValues = func(releaseName, namespace string) (string, error) {
+		return "replicaCount: 3\n", nil
+	}
+
+	helmExportAll = true
+	helmExportNamespaces = []string{"default"}
+	helmExportCtx = "test-context"
+	helmExportOutputDir = t.TempDir()
+	helmExportReport = reportStdout
+
+	old := os.Stdout
+	r, w, _ := os.Pipe()
+	os.Stdout = w
+	err := runHelmValuesExport(nil, nil)
+	_ = w.Close()
+	os.Stdout = old
+
+	var buf bytes.Buffer
+	_, _ = buf.ReadFrom(r)
+	if err != nil {
+		t.Fatalf("runHelmValuesExport() error = %v", err)
+	}
+
+	// Progress goes to stderr, so stdout holds the report only
+	var report runReport
+	if err := json.Unmarshal(buf.Bytes(), &report); err != nil {
+		t.Fatalf("stdout is not a JSON report: %v\n%s", err, buf.String())
+	}
+	if report.Command != "helm-values-export" || !report.Success || report.Totals.Exported != 1 {
+		t.Errorf("unexpected report: %s", buf.String())
+	}
+}
@@ -1,11 +1,268 @@
 package cmd
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"log/slog"
+	"strings"
+	"text/tabwriter"
+	"time"
 
+	"github.com/davidschrooten/manifold-k8s/pkg/exporter"
 	"github.com/davidschrooten/manifold-k8s/pkg/k8s"
+	"github.com/spf13/viper"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/tools/clientcmd/api"
 )
 
+// loadKubeConfig loads the kubeconfig from the configured path (uses stub if available)
+func loadKubeConfig() (*api.Config, error) {
+	kubeconfigPath := viper.GetString("kubeconfig")
+	if stubLoadKubeConfig != nil {
+		return stubLoadKubeConfig(kubeconfigPath)
+	}
+	return k8s.LoadKubeConfig(kubeconfigPath)
+}
+
+// resolveContexts returns the contexts selected by a comma-separated list of context names
+// and globs, or every kubeconfig context when all is set
+func resolveContexts(config *api.Config, contextFlag string, all bool) ([]string, error) {
+	if all {
+		contexts := k8s.GetContexts(config)
+		if len(contexts) == 0 {
+			return nil, fmt.Errorf("no contexts found in kubeconfig")
+		}
+		return contexts, nil
+	}
+
+	var patterns []string
+	for _, pattern := range strings.Split(contextFlag, ",") {
+		if pattern = strings.TrimSpace(pattern); pattern != "" {
+			patterns = append(patterns, pattern)
+		}
+	}
+	if len(patterns) == 0 {
+		return nil, fmt.Errorf("no context specified")
+	}
+	return k8s.MatchContexts(config, patterns)
+}
+
+// contextResult is the outcome of exporting from one kube context
+type contextResult struct {
+	context  string
+	identity string
+	exported int
+	err      error
+	report   *contextReport
+}
+
+// formatContextResults renders one line per context with its identity and export count or failure
+func formatContextResults(results []contextResult, noun string) string {
+	var b strings.Builder
+	w := tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "\nCONTEXT\tIDENTITY\tRESULT")
+	for _, result := range results {
+		identity := result.identity
+		if identity == "" {
+			identity = "-"
+		}
+		status := fmt.Sprintf("exported %d %s", result.exported, noun)
+		if result.err != nil {
+			status = "failed: " + result.err.Error()
+		}
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\n", result.context, identity, status)
+	}
+	_ = w.Flush()
+	return b.String()
+}
+
+// contextResultsError returns the error of a single context as is, or a summary of how many
+// of several contexts failed
+func contextResultsError(results []contextResult) error {
+	var failed int
+	for _, result := range results {
+		if result.err != nil {
+			failed++
+		}
+	}
+
+	switch {
+	case failed == 0:
+		return nil
+	case len(results) == 1:
+		return results[0].err
+	default:
+		return fmt.Errorf("%d of %d context(s) failed", failed, len(results))
+	}
+}
+
+// namespacesOrDefault returns namespaces, or the namespace set with --namespace when none were given
+func namespacesOrDefault(namespaces []string) []string {
+	if len(namespaces) == 0 {
+		if namespace := viper.GetString("namespace"); namespace != "" {
+			return []string{namespace}
+		}
+	}
+	return namespaces
+}
+
+// clientOptions returns the kubeconfig overrides set via the global flags
+func clientOptions() k8s.ClientOptions {
+	return k8s.ClientOptions{
+		Cluster:   viper.GetString("cluster"),
+		AuthInfo:  viper.GetString("user"),
+		Namespace: viper.GetString("namespace"),
+
+		ImpersonateUser:   viper.GetString("as"),
+		ImpersonateGroups: viper.GetStringSlice("as-group"),
+		ImpersonateUID:    viper.GetString("as-uid"),
+
+		TraceHTTP: viper.GetBool("trace-http"),
+	}
+}
+
+// discoveryClient returns the discovery client for a context, backed by the on-disk cache
+// Falls back to the uncached client if the cache cannot be used.
+func discoveryClient(client *k8s.Client) discovery.DiscoveryInterface {
+	if client.RESTConfig == nil {
+		return client.Clientset.Discovery()
+	}
+
+	cacheDir := viper.GetString("cache-dir")
+	if cacheDir == "" {
+		cacheDir = k8s.DefaultCacheDir()
+	}
+
+	cached, err := k8s.NewCachedDiscoveryClient(client.RESTConfig, cacheDir, viper.GetDuration("discovery-cache-ttl"))
+	if err != nil {
+		client.Logger().Warn("discovery cache unavailable, using live discovery", "error", err)
+		return client.Clientset.Discovery()
+	}
+
+	if viper.GetBool("refresh-discovery") {
+		cached.Invalidate()
+	}
+	return cached
+}
+
+// checkDiscoveryError reports API groups that could not be discovered
+// Partial failures are logged as warnings and only returned as an error in strict mode.
+func checkDiscoveryError(log *slog.Logger, err error, strict bool) error {
+	return checkDiscoveryErrorWith(func(format string, args ...interface{}) {
+		log.Warn(fmt.Sprintf(format, args...))
+	}, err, strict)
+}
+
+// checkDiscoveryErrorWith is checkDiscoveryError with the warnings passed to warnf
+func checkDiscoveryErrorWith(warnf func(format string, args ...interface{}), err error, strict bool) error {
+	var partialErr *k8s.PartialDiscoveryError
+	if !errors.As(err, &partialErr) {
+		return err
+	}
+
+	for _, failure := range partialErr.Failures {
+		warnf("failed to discover API group %s: %v", failure.GroupVersion, failure.Err)
+	}
+	if strict {
+		return err
+	}
+	warnf("resource types from %d API group-version(s) are missing from this export (use --strict to fail)", len(partialErr.Failures))
+	return nil
+}
+
+// discoverResources discovers the resource types of the client's cluster (uses stub if available)
+func discoverResources(client *k8s.Client) ([]k8s.ResourceInfo, error) {
+	start := time.Now()
+	var resources []k8s.ResourceInfo
+	var err error
+	if stubDiscoverResources != nil {
+		resources, err = stubDiscoverResources(discoveryClient(client))
+	} else {
+		resources, err = k8s.DiscoverResources(discoveryClient(client))
+	}
+	client.Logger().Info("discovered resource types", "types", len(resources), "duration", time.Since(start))
+	return resources, err
+}
+
+// collectManifests lists the given resource types in every namespace, keyed like an export tree
+// Resource/namespace pairs that cannot be listed are logged and returned as failed, with the
+// error of their list call.
+func collectManifests(ctx context.Context, client *k8s.Client, resources []k8s.ResourceInfo, namespaces []string) (map[exporter.ManifestKey]*unstructured.Unstructured, map[string]error) {
+	manifests := make(map[exporter.ManifestKey]*unstructured.Unstructured)
+	failed := make(map[string]error)
+
+	for _, namespace := range namespaces {
+		for _, resource := range resources {
+			if !shouldProcessResource(resource, namespace) {
+				continue
+			}
+
+			list, err := client.DynamicClient.Resource(resource.GroupVersionResource()).Namespace(namespace).List(ctx, metav1.ListOptions{})
+			if err != nil {
+				client.Logger().Error("failed to list resources", "resource", resource.Name, "namespace", namespace, "error", err)
+				failed[accessKey(namespace, resource.Name)] = err
+				continue
+			}
+
+			for i := range list.Items {
+				item := &list.Items[i]
+				manifests[exporter.ManifestKey{Namespace: namespace, ResourceType: resource.Name, Name: item.GetName()}] = item
+			}
+		}
+	}
+
+	return manifests, failed
+}
+
+// listFailureError returns the error of a comparison that could not list some resource/namespace
+// pairs, with the exit code of their list errors, or nil when every pair was listed
+func listFailureError(failed map[string]error, compared int) error {
+	if len(failed) == 0 {
+		return nil
+	}
+	errs := make([]error, 0, len(failed))
+	for _, err := range failed {
+		errs = append(errs, err)
+	}
+	return withExitCode(failureExitCode(errs, compared), fmt.Errorf("failed to list %d resource/namespace pair(s)", len(failed)))
+}
+
+// newRewriter builds the rewriter for namespace mappings and a rewrite rules file, or nil when there is nothing to rewrite
+func newRewriter(namespaces map[string]string, rewriteDNS bool, rulesFile string) (*exporter.Rewriter, error) {
+	for from, to := range namespaces {
+		if from == "" || to == "" {
+			return nil, fmt.Errorf("invalid namespace mapping %q=%q (expected old=new)", from, to)
+		}
+	}
+
+	rewriter := &exporter.Rewriter{Namespaces: namespaces, RewriteDNS: rewriteDNS}
+	if rulesFile != "" {
+		rules, err := exporter.LoadRewriteRules(rulesFile)
+		if err != nil {
+			return nil, err
+		}
+		rewriter.Rules = rules
+	}
+
+	if rewriter.IsEmpty() {
+		return nil, nil
+	}
+	return rewriter, nil
+}
+
+// newClient creates a client for the given context with the global overrides applied (uses stub if available)
+func newClient(config *api.Config, contextName string) (*k8s.Client, error) {
+	if stubNewClient != nil {
+		return stubNewClient(config, contextName)
+	}
+	opts := clientOptions()
+	opts.Logger = contextLogger(contextName)
+	return k8s.NewClientWithOptions(config, contextName, opts)
+}
+
 // validateExportFlags validates export command flags
 func validateExportFlags(allRes bool, resources []string) error {
 	if !allRes && len(resources) == 0 {
@@ -55,3 +312,61 @@ func formatOutputMessage(dryRun bool, namespace, resourceType, resourceName stri
 	}
 	return fmt.Sprintf("Exported: %s/%s/%s", namespace, resourceType, resourceName)
 }
+
+// validateOnForbidden validates the --on-forbidden policy
+func validateOnForbidden(policy string) error {
+	if policy != "skip" && policy != "fail" {
+		return fmt.Errorf("invalid --on-forbidden value %q (must be skip or fail)", policy)
+	}
+	return nil
+}
+
+// accessKey returns the lookup key for a resource/namespace pair
+func accessKey(namespace, resourceName string) string {
+	return namespace + "/" + resourceName
+}
+
+// deniedAccess returns the set of resource/namespace pairs that were denied
+func deniedAccess(checks []k8s.AccessCheck) map[string]bool {
+	denied := make(map[string]bool)
+	for _, check := range checks {
+		if !check.Allowed {
+			denied[accessKey(check.Namespace, check.Resource.Name)] = true
+		}
+	}
+	return denied
+}
+
+// formatAccessMatrix renders access checks as a resource by namespace table
+func formatAccessMatrix(checks []k8s.AccessCheck, namespaces []string) string {
+	var resources []string
+	seen := make(map[string]bool)
+	results := make(map[string]string)
+	for _, check := range checks {
+		if !seen[check.Resource.Name] {
+			seen[check.Resource.Name] = true
+			resources = append(resources, check.Resource.Name)
+		}
+		result := "yes"
+		if !check.Allowed {
+			result = "no"
+		}
+		results[accessKey(check.Namespace, check.Resource.Name)] = result
+	}
+
+	var sb strings.Builder
+	w := tabwriter.NewWriter(&sb, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintf(w, "RESOURCE\t%s\n", strings.Join(namespaces, "\t"))
+	for _, resource := range resources {
+		row := make([]string, len(namespaces))
+		for i, namespace := range namespaces {
+			row[i] = results[accessKey(namespace, resource)]
+			if row[i] == "" {
+				row[i] = "-"
+			}
+		}
+		_, _ = fmt.Fprintf(w, "%s\t%s\n", resource, strings.Join(row, "\t"))
+	}
+	_ = w.Flush()
+	return sb.String()
+}
@@ -1,9 +1,14 @@
 package cmd
 
 import (
+	"fmt"
+	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/davidschrooten/manifold-k8s/pkg/k8s"
+	"github.com/spf13/viper"
+	"k8s.io/client-go/tools/clientcmd/api"
 )
 
 func TestValidateExportFlags(t *testing.T) {
@@ -243,6 +248,85 @@ func TestFormatOutputMessage(t *testing.T) {
 	}
 }
 
+func TestClientOptions(t *testing.T) {
+	viper.Set("cluster", "prod-cluster")
+	viper.Set("user", "auditor")
+	viper.Set("namespace", "payments")
+	viper.Set("as", "system:serviceaccount:payments:backup")
+	viper.Set("as-group", []string{"auditors"})
+	viper.Set("as-uid", "1234")
+	defer func() {
+		viper.Set("cluster", "")
+		viper.Set("user", "")
+		viper.Set("namespace", "")
+		viper.Set("as", "")
+		viper.Set("as-group", nil)
+		viper.Set("as-uid", "")
+	}()
+
+	opts := clientOptions()
+	want := k8s.ClientOptions{
+		Cluster:           "prod-cluster",
+		AuthInfo:          "auditor",
+		Namespace:         "payments",
+		ImpersonateUser:   "system:serviceaccount:payments:backup",
+		ImpersonateGroups: []string{"auditors"},
+		ImpersonateUID:    "1234",
+	}
+	if !reflect.DeepEqual(opts, want) {
+		t.Errorf("clientOptions() = %+v, want %+v", opts, want)
+	}
+}
+
+func TestFormatAccessMatrix(t *testing.T) {
+	pods := k8s.ResourceInfo{Name: "pods", Namespaced: true}
+	secrets := k8s.ResourceInfo{Name: "secrets", Namespaced: true}
+	checks := []k8s.AccessCheck{
+		{Resource: pods, Namespace: "default", Allowed: true},
+		{Resource: secrets, Namespace: "default", Allowed: false},
+		{Resource: pods, Namespace: "kube-system", Allowed: false},
+	}
+
+	got := formatAccessMatrix(checks, []string{"default", "kube-system"})
+	want := "RESOURCE  default  kube-system\n" +
+		"pods      yes      no\n" +
+		"secrets   no       -\n"
+	if got != want {
+		t.Errorf("formatAccessMatrix() =\n%s\nwant\n%s", got, want)
+	}
+
+	denied := deniedAccess(checks)
+	if len(denied) != 2 || !denied["default/secrets"] || !denied["kube-system/pods"] {
+		t.Errorf("deniedAccess() = %v", denied)
+	}
+}
+
+func TestValidateOnForbidden(t *testing.T) {
+	for _, policy := range []string{"skip", "fail"} {
+		if err := validateOnForbidden(policy); err != nil {
+			t.Errorf("validateOnForbidden(%s) error = %v", policy, err)
+		}
+	}
+	if err := validateOnForbidden("ignore"); err == nil {
+		t.Error("validateOnForbidden(ignore) expected error, got nil")
+	}
+}
+
+func TestNamespacesOrDefault(t *testing.T) {
+	if got := namespacesOrDefault(nil); got != nil {
+		t.Errorf("namespacesOrDefault(nil) = %v, want nil", got)
+	}
+
+	viper.Set("namespace", "payments")
+	defer viper.Set("namespace", "")
+	if got := namespacesOrDefault(nil); !reflect.DeepEqual(got, []string{"payments"}) {
+		t.Errorf("namespacesOrDefault(nil) = %v, want [payments]", got)
+	}
+	if got := namespacesOrDefault([]string{"web"}); !reflect.DeepEqual(got, []string{"web"}) {
+		t.Errorf("namespacesOrDefault([web]) = %v, want [web]", got)
+	}
+}
+
 // Benchmark tests
 func BenchmarkBuildResourceMap(b *testing.B) {
 	resources := make([]k8s.ResourceInfo, 100)
@@ -273,3 +357,87 @@ func BenchmarkSelectRequestedResources(b *testing.B) {
 		selectRequestedResources(resourceMap, requested)
 	}
 }
+
+func TestResolveContexts(t *testing.T) {
+	config := mockKubeConfig()
+	config.Contexts["prod-eu"] = &api.Context{Cluster: "test-cluster"}
+	config.Contexts["prod-us"] = &api.Context{Cluster: "test-cluster"}
+
+	tests := []struct {
+		name    string
+		flag    string
+		all     bool
+		want    []string
+		wantErr bool
+	}{
+		{name: "single context", flag: "test-context", want: []string{"test-context"}},
+		{name: "list and glob", flag: "test-context, prod-*", want: []string{"test-context", "prod-eu", "prod-us"}},
+		{name: "all contexts", all: true, want: []string{"prod-eu", "prod-us", "test-context"}},
+		{name: "glob without match", flag: "qa-*", wantErr: true},
+		{name: "empty list", flag: " , ", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := resolveContexts(config, tt.flag, tt.all)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("resolveContexts() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("resolveContexts() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatContextResults(t *testing.T) {
+	results := []contextResult{
+		{context: "prod", identity: "kubeconfig credentials", exported: 4},
+		{context: "staging", err: fmt.Errorf("connection refused")},
+	}
+
+	got := formatContextResults(results, "release(s)")
+	for _, want := range []string{
+		"CONTEXT  IDENTITY                RESULT",
+		"prod     kubeconfig credentials  exported 4 release(s)",
+		"staging  -                       failed: connection refused",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("formatContextResults() missing %q:\n%s", want, got)
+		}
+	}
+}
+
+func TestContextResultsError(t *testing.T) {
+	contextErr := fmt.Errorf("connection refused")
+
+	if err := contextResultsError([]contextResult{{context: "a"}, {context: "b"}}); err != nil {
+		t.Errorf("contextResultsError() = %v, want nil when every context succeeded", err)
+	}
+	if err := contextResultsError([]contextResult{{context: "a", err: contextErr}}); err != contextErr {
+		t.Errorf("contextResultsError() = %v, want the error of the only context", err)
+	}
+	err := contextResultsError([]contextResult{{context: "a", err: contextErr}, {context: "b"}, {context: "c", err: contextErr}})
+	if err == nil || err.Error() != "2 of 3 context(s) failed" {
+		t.Errorf("contextResultsError() = %v, want 2 of 3 context(s) failed", err)
+	}
+}
+
+func TestNewRewriter(t *testing.T) {
+	rewriter, err := newRewriter(nil, true, "")
+	if err != nil || rewriter != nil {
+		t.Errorf("newRewriter() = %v, %v; want nil when there is nothing to rewrite", rewriter, err)
+	}
+
+	rewriter, err = newRewriter(map[string]string{"prod": "staging"}, true, "")
+	if err != nil {
+		t.Fatalf("newRewriter() error = %v", err)
+	}
+	if rewriter.MapNamespace("prod") != "staging" || !rewriter.RewriteDNS {
+		t.Errorf("newRewriter() = %+v", rewriter)
+	}
+
+	if _, err := newRewriter(map[string]string{"prod": ""}, false, ""); err == nil {
+		t.Error("newRewriter() expected error for an empty mapping")
+	}
+}
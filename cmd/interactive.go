@@ -3,21 +3,19 @@ package cmd
 import (
 	"context"
 	"fmt"
-	"os"
 
 	"github.com/davidschrooten/manifold-k8s/pkg/exporter"
 	"github.com/davidschrooten/manifold-k8s/pkg/k8s"
 	"github.com/davidschrooten/manifold-k8s/pkg/selector"
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
-	"k8s.io/client-go/tools/clientcmd/api"
 )
 
 var (
 	interactiveDryRun    bool
 	interactiveOutputDir string
+	interactiveStrict    bool
 )
 
 var interactiveCmd = &cobra.Command{
@@ -38,6 +36,7 @@ func init() {
 
 	interactiveCmd.Flags().BoolVar(&interactiveDryRun, "dry-run", false, "preview what would be downloaded without writing files")
 	interactiveCmd.Flags().StringVarP(&interactiveOutputDir, "output", "o", "", "output directory (will be prompted if not provided)")
+	interactiveCmd.Flags().BoolVar(&interactiveStrict, "strict", false, "fail when some API groups cannot be discovered")
 }
 
 // runInteractive is excluded from coverage as it requires user interaction
@@ -45,15 +44,8 @@ func init() {
 func runInteractive(cmd *cobra.Command, args []string) error {
 	ctx := context.Background()
 
-	// Load kubeconfig (use stub if available)
-	kubeconfigPath := viper.GetString("kubeconfig")
-	var err error
-	var config *api.Config
-	if stubLoadKubeConfig != nil {
-		config, err = stubLoadKubeConfig(kubeconfigPath)
-	} else {
-		config, err = k8s.LoadKubeConfig(kubeconfigPath)
-	}
+	// Load kubeconfig
+	config, err := loadKubeConfig()
 	if err != nil {
 		return fmt.Errorf("failed to load kubeconfig: %w", err)
 	}
@@ -73,15 +65,11 @@ func runInteractive(cmd *cobra.Command, args []string) error {
 		fmt.Printf("\n=== Processing context: %s ===\n", contextName)
 
 		// Create client for this context (use stub if available)
-		var client *k8s.Client
-		if stubNewClient != nil {
-			client, err = stubNewClient(config, contextName)
-		} else {
-			client, err = k8s.NewClient(config, contextName)
-		}
+		client, err := newClient(config, contextName)
 		if err != nil {
 			return fmt.Errorf("failed to create client for context %s: %w", contextName, err)
 		}
+		fmt.Printf("Using identity: %s\n", client.Identity())
 
 		// Get namespaces (use stub if available)
 		var namespaces []string
@@ -105,12 +93,12 @@ func runInteractive(cmd *cobra.Command, args []string) error {
 		fmt.Println("\nDiscovering available resources...")
 		var resources []k8s.ResourceInfo
 		if stubDiscoverResources != nil {
-			resources, err = stubDiscoverResources(client.Clientset.Discovery())
+			resources, err = stubDiscoverResources(discoveryClient(client))
 		} else {
-			resources, err = k8s.DiscoverResources(client.Clientset.Discovery())
+			resources, err = k8s.DiscoverResources(discoveryClient(client))
 		}
-		if err != nil {
-			return fmt.Errorf("failed to discover resources: %w", err)
+		if err := checkDiscoveryError(client.Logger(), err, interactiveStrict); err != nil {
+			return withExitCode(exitDiscoveryFailure, fmt.Errorf("failed to discover resources: %w", err))
 		}
 
 		// Select resource type(s)
@@ -152,7 +140,7 @@ func runInteractive(cmd *cobra.Command, args []string) error {
 				}
 
 				if err != nil {
-					fmt.Fprintf(os.Stderr, "Warning: failed to list %s in %s: %v\n", resource.Name, namespace, err)
+					client.Logger().Warn("failed to list resources", "resource", resource.Name, "namespace", namespace, "error", err)
 					continue
 				}
 
@@ -164,7 +152,7 @@ func runInteractive(cmd *cobra.Command, args []string) error {
 					}
 
 					if err := exp.ExportResource(ctx, &item, gvr, namespace); err != nil {
-						fmt.Fprintf(os.Stderr, "Warning: failed to export %s/%s: %v\n", resource.Name, item.GetName(), err)
+						client.Logger().Warn("failed to export object", "resource", resource.Name, "namespace", namespace, "name", item.GetName(), "error", err)
 						continue
 					}
 					fmt.Println(formatOutputMessage(false, namespace, resource.Name, item.GetName()))
@@ -175,6 +163,7 @@ func runInteractive(cmd *cobra.Command, args []string) error {
 		// Print summary
 		if !interactiveDryRun {
 			fmt.Printf("\n%s\n", exp.Summary())
+			fmt.Printf("Identity: %s\n", client.Identity())
 		}
 	}
 
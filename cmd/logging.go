@@ -0,0 +1,71 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"k8s.io/klog/v2"
+)
+
+// Formats of --log-format
+const (
+	logFormatText = "text"
+	logFormatJSON = "json"
+)
+
+// logger receives the diagnostics of a run on stderr
+// It discards them until setupLogging has read the logging flags, e.g. in tests.
+var logger = slog.New(slog.DiscardHandler)
+
+// setupLogging configures logger from the global flags before a command runs and routes the
+// logs of client-go through it
+func setupLogging(cmd *cobra.Command, args []string) error {
+	l, err := newLogger(os.Stderr, viper.GetString("log-format"), viper.GetInt("verbose"), viper.GetBool("quiet"), viper.GetBool("trace-http"))
+	if err != nil {
+		return err
+	}
+	logger = l
+	klog.SetSlogLogger(l)
+	return nil
+}
+
+// newLogger returns a logger writing records in format to w
+// Warnings and errors are logged by default, -v adds info and -vv debug records; --quiet
+// leaves only errors. Tracing HTTP requests needs debug records, so it implies -vv.
+func newLogger(w io.Writer, format string, verbosity int, quiet, traceHTTP bool) (*slog.Logger, error) {
+	if quiet && (verbosity > 0 || traceHTTP) {
+		return nil, fmt.Errorf("--quiet cannot be combined with --verbose or --trace-http")
+	}
+
+	level := slog.LevelWarn
+	switch {
+	case quiet:
+		level = slog.LevelError
+	case verbosity >= 2 || traceHTTP:
+		level = slog.LevelDebug
+	case verbosity == 1:
+		level = slog.LevelInfo
+	}
+
+	opts := &slog.HandlerOptions{Level: level}
+	switch format {
+	case logFormatText:
+		return slog.New(slog.NewTextHandler(w, opts)), nil
+	case logFormatJSON:
+		return slog.New(slog.NewJSONHandler(w, opts)), nil
+	default:
+		return nil, fmt.Errorf("invalid log format %q (must be %s or %s)", format, logFormatText, logFormatJSON)
+	}
+}
+
+// contextLogger returns the logger for the work on one context
+func contextLogger(contextName string) *slog.Logger {
+	if contextName == "" {
+		return logger
+	}
+	return logger.With("context", contextName)
+}
@@ -0,0 +1,111 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewLogger_Levels(t *testing.T) {
+	tests := []struct {
+		name      string
+		verbosity int
+		quiet     bool
+		traceHTTP bool
+		want      slog.Level
+	}{
+		{name: "default", want: slog.LevelWarn},
+		{name: "verbose", verbosity: 1, want: slog.LevelInfo},
+		{name: "very verbose", verbosity: 2, want: slog.LevelDebug},
+		{name: "quiet", quiet: true, want: slog.LevelError},
+		{name: "trace http", traceHTTP: true, want: slog.LevelDebug},
+	}
+
+	ctx := t.Context()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l, err := newLogger(&bytes.Buffer{}, logFormatText, tt.verbosity, tt.quiet, tt.traceHTTP)
+			require.NoError(t, err)
+			assert.True(t, l.Enabled(ctx, tt.want))
+			assert.False(t, l.Enabled(ctx, tt.want-1))
+		})
+	}
+}
+
+func TestNewLogger_Formats(t *testing.T) {
+	var out bytes.Buffer
+	l, err := newLogger(&out, logFormatJSON, 0, false, false)
+	require.NoError(t, err)
+	l.Warn("discovery cache unavailable", "context", "prod")
+
+	var record map[string]interface{}
+	require.NoError(t, json.Unmarshal(out.Bytes(), &record))
+	assert.Equal(t, "WARN", record["level"])
+	assert.Equal(t, "discovery cache unavailable", record["msg"])
+	assert.Equal(t, "prod", record["context"])
+
+	_, err = newLogger(&out, "xml", 0, false, false)
+	assert.EqualError(t, err, `invalid log format "xml" (must be text or json)`)
+	_, err = newLogger(&out, logFormatText, 1, true, false)
+	assert.EqualError(t, err, "--quiet cannot be combined with --verbose or --trace-http")
+}
+
+func TestContextLog_Quiet(t *testing.T) {
+	viper.Set("quiet", true)
+	defer viper.Set("quiet", false)
+
+	var out, logs bytes.Buffer
+	l, err := newLogger(&logs, logFormatText, 0, true, false)
+	require.NoError(t, err)
+	logger = l
+	defer func() { logger = slog.New(slog.DiscardHandler) }()
+
+	log := newContextLog("prod", &out)
+	log.printf("Exporting manifests...\n")
+	log.warnf("resource type widgets not found in cluster")
+	log.errorf("failed to list pods in default: %w", assert.AnError)
+
+	assert.Empty(t, out.String())
+	assert.NotContains(t, logs.String(), "widgets")
+	assert.Contains(t, logs.String(), `level=ERROR msg="failed to list pods in default: `+assert.AnError.Error()+`" context=prod`)
+	assert.Len(t, log.report.Warnings, 1, "quiet warnings are still reported")
+}
+
+func TestContextLog_JSON(t *testing.T) {
+	var out, logs bytes.Buffer
+	l, err := newLogger(&logs, logFormatJSON, 0, false, false)
+	require.NoError(t, err)
+	logger = l
+	defer func() { logger = slog.New(slog.DiscardHandler) }()
+
+	log := newContextLog("prod", &out)
+	log.warnf("resource type widgets not found in cluster")
+	log.errorf("failed to list pods in default: %w", assert.AnError)
+	log.done(contextResult{context: "prod", err: assert.AnError})
+
+	// Every diagnostic is a JSON record, so the log stays machine-readable
+	lines := bytes.Split(bytes.TrimSpace(logs.Bytes()), []byte("\n"))
+	require.Len(t, lines, 3)
+	var levels []string
+	for _, line := range lines {
+		var record map[string]interface{}
+		require.NoError(t, json.Unmarshal(line, &record), "record: %s", line)
+		assert.Equal(t, "prod", record["context"])
+		levels = append(levels, record["level"].(string))
+	}
+	assert.Equal(t, []string{"WARN", "ERROR", "ERROR"}, levels)
+	assert.Empty(t, out.String())
+}
+
+func TestRootCmd_LoggingFlags(t *testing.T) {
+	for _, name := range []string{"verbose", "quiet", "log-format", "trace-http"} {
+		assert.NotNil(t, rootCmd.PersistentFlags().Lookup(name), "flag %s", name)
+	}
+	assert.Equal(t, "v", rootCmd.PersistentFlags().Lookup("verbose").Shorthand)
+	assert.Equal(t, "q", rootCmd.PersistentFlags().Lookup("quiet").Shorthand)
+}
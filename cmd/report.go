@@ -0,0 +1,267 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// reportStdout is the --report value printing the report on stdout
+const reportStdout = "-"
+
+// runReport is the machine-readable result of an export run, written with --report
+type runReport struct {
+	Command         string           `json:"command"`
+	OutputDir       string           `json:"outputDir"`
+	DryRun          bool             `json:"dryRun"`
+	Success         bool             `json:"success"`
+	ExitCode        int              `json:"exitCode"`
+	Error           string           `json:"error,omitempty"`
+	StartedAt       time.Time        `json:"startedAt"`
+	FinishedAt      time.Time        `json:"finishedAt"`
+	DurationSeconds float64          `json:"durationSeconds"`
+	Totals          reportTotals     `json:"totals"`
+	Contexts        []*contextReport `json:"contexts"`
+	Files           []string         `json:"files"`    // written for the whole run, e.g. helmfile.yaml
+	Warnings        []string         `json:"warnings"` // about the whole run rather than one context
+	Errors          []string         `json:"errors"`
+}
+
+// reportTotals sums the context reports of a run
+type reportTotals struct {
+	Contexts       int            `json:"contexts"`
+	FailedContexts int            `json:"failedContexts"`
+	Exported       int            `json:"exported"`
+	Counts         map[string]int `json:"counts"`
+	Files          int            `json:"files"`
+	Warnings       int            `json:"warnings"`
+	Skipped        int            `json:"skipped"`
+	Errors         int            `json:"errors"`
+}
+
+// contextReport is what happened in one context of a run
+type contextReport struct {
+	Context         string         `json:"context"`
+	Identity        string         `json:"identity,omitempty"`
+	Namespaces      []string       `json:"namespaces"`
+	Exported        int            `json:"exported"`
+	Counts          map[string]int `json:"counts"` // exported objects per resource type, or releases and parts for Helm
+	Files           []string       `json:"files"`
+	Warnings        []string       `json:"warnings"`
+	Skipped         []skippedItem  `json:"skipped"`
+	Errors          []string       `json:"errors"`
+	StartedAt       time.Time      `json:"startedAt"`
+	DurationSeconds float64        `json:"durationSeconds"`
+
+	errs []error // the errors behind Errors, classified for the exit code
+}
+
+// skippedItem is something left out of an export, with the reason why
+type skippedItem struct {
+	Item   string `json:"item"`
+	Reason string `json:"reason"`
+}
+
+// newRunReport starts the report of a run
+func newRunReport(command, outputDir string, dryRun bool) *runReport {
+	return &runReport{
+		Command:   command,
+		OutputDir: outputDir,
+		DryRun:    dryRun,
+		StartedAt: time.Now(),
+		Contexts:  []*contextReport{},
+		Files:     []string{},
+		Warnings:  []string{},
+		Errors:    []string{},
+	}
+}
+
+// finish completes the report with the context results, what was logged for the whole run when
+// run is set, and the outcome of the run
+func (r *runReport) finish(results []contextResult, run *contextReport, err error) {
+	r.FinishedAt = time.Now()
+	r.DurationSeconds = r.FinishedAt.Sub(r.StartedAt).Seconds()
+	r.Success = err == nil
+	r.ExitCode = exitCode(err)
+	if err != nil {
+		r.Error = err.Error()
+	}
+
+	r.Totals = reportTotals{Counts: map[string]int{}}
+	if run != nil {
+		r.Files = append(r.Files, run.Files...)
+		r.Warnings = append(r.Warnings, run.Warnings...)
+		r.Errors = append(r.Errors, run.Errors...)
+		r.Totals.Files += len(run.Files)
+		r.Totals.Warnings += len(run.Warnings)
+		r.Totals.Errors += len(run.Errors)
+	}
+	for _, result := range results {
+		report := result.report
+		if report == nil {
+			report = newContextReport(result.context)
+		}
+		report.Identity = result.identity
+		report.Exported = result.exported
+		if result.err != nil {
+			report.Errors = append(report.Errors, result.err.Error())
+			r.Totals.FailedContexts++
+		}
+
+		r.Contexts = append(r.Contexts, report)
+		r.Totals.Contexts++
+		r.Totals.Exported += report.Exported
+		for kind, count := range report.Counts {
+			r.Totals.Counts[kind] += count
+		}
+		r.Totals.Files += len(report.Files)
+		r.Totals.Warnings += len(report.Warnings)
+		r.Totals.Skipped += len(report.Skipped)
+		r.Totals.Errors += len(report.Errors)
+	}
+}
+
+// write writes the report as JSON to path, or to stdout when path is reportStdout
+func (r *runReport) write(path string) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal report: %w", err)
+	}
+	data = append(data, '\n')
+
+	if path == reportStdout {
+		if _, err := os.Stdout.Write(data); err != nil {
+			return fmt.Errorf("failed to write report: %w", err)
+		}
+		return nil
+	}
+	if dir := filepath.Dir(path); dir != "." {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("failed to create directory %s: %w", dir, err)
+		}
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write report %s: %w", path, err)
+	}
+	return nil
+}
+
+// progressOutput returns where the progress of a run goes: stdout, unless the report is
+// printed there
+func progressOutput(reportPath string) io.Writer {
+	if reportPath == reportStdout {
+		return os.Stderr
+	}
+	return os.Stdout
+}
+
+// newContextReport starts the report of one context
+func newContextReport(contextName string) *contextReport {
+	return &contextReport{
+		Context:    contextName,
+		Namespaces: []string{},
+		Counts:     map[string]int{},
+		Files:      []string{},
+		Warnings:   []string{},
+		Skipped:    []skippedItem{},
+		Errors:     []string{},
+		StartedAt:  time.Now(),
+	}
+}
+
+// contextLog prints the progress of one context and records it in the context's report
+// Progress goes to out, so parallel contexts can buffer it and the JSON report can keep stdout
+// to itself; --quiet hides it. Warnings and errors go to logger, tagged with the context.
+type contextLog struct {
+	out    io.Writer
+	report *contextReport
+	logger *slog.Logger
+	quiet  bool
+}
+
+// newContextLog returns the log of one context
+func newContextLog(contextName string, out io.Writer) *contextLog {
+	return &contextLog{
+		out:    out,
+		report: newContextReport(contextName),
+		logger: contextLogger(contextName),
+		quiet:  viper.GetBool("quiet"),
+	}
+}
+
+// printf prints progress
+func (l *contextLog) printf(format string, args ...interface{}) {
+	if !l.quiet {
+		fmt.Fprintf(l.out, format, args...)
+	}
+}
+
+// warnf logs and records a warning
+func (l *contextLog) warnf(format string, args ...interface{}) {
+	message := fmt.Sprintf(format, args...)
+	l.report.Warnings = append(l.report.Warnings, message)
+	l.logger.Warn(message)
+}
+
+// errorf logs and records an error that did not stop the export, such as a failed list call
+// The format wraps the underlying error with %w so that the exit code can classify it.
+func (l *contextLog) errorf(format string, args ...interface{}) {
+	err := fmt.Errorf(format, args...)
+	l.report.errs = append(l.report.errs, err)
+	l.report.Errors = append(l.report.Errors, err.Error())
+	l.logger.Error(err.Error())
+}
+
+// skip records an item left out of the export
+func (l *contextLog) skip(item, reason string) {
+	l.report.Skipped = append(l.report.Skipped, skippedItem{Item: item, Reason: reason})
+}
+
+// exported records an exported object of the given kind and the files written for it
+func (l *contextLog) exported(kind string, files ...string) {
+	l.report.Counts[kind]++
+	l.report.Files = append(l.report.Files, files...)
+}
+
+// wrote records files written besides the exported objects
+func (l *contextLog) wrote(files ...string) {
+	l.report.Files = append(l.report.Files, files...)
+}
+
+// namespaces records the namespaces exported from
+func (l *contextLog) namespaces(namespaces []string) {
+	l.report.Namespaces = append([]string{}, namespaces...)
+	sort.Strings(l.report.Namespaces)
+}
+
+// done completes the timing of the context and attaches its report to result
+func (l *contextLog) done(result contextResult) contextResult {
+	duration := time.Since(l.report.StartedAt)
+	l.report.DurationSeconds = duration.Seconds()
+	result.report = l.report
+
+	attrs := []any{"exported", result.exported, "warnings", len(l.report.Warnings), "errors", len(l.report.errs), "duration", duration}
+	if result.err != nil {
+		l.logger.Error("context failed", append(attrs, "error", result.err)...)
+		return result
+	}
+	l.logger.Info("finished context", attrs...)
+	return result
+}
+
+// sortedSet returns the members of a set in order
+func sortedSet(set map[string]bool) []string {
+	members := make([]string, 0, len(set))
+	for member := range set {
+		members = append(members, member)
+	}
+	sort.Strings(members)
+	return members
+}
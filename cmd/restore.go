@@ -0,0 +1,231 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/davidschrooten/manifold-k8s/pkg/exporter"
+	"github.com/davidschrooten/manifold-k8s/pkg/k8s"
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// Dry-run modes of the restore command
+const (
+	restoreDryRunNone   = "none"
+	restoreDryRunClient = "client"
+	restoreDryRunServer = "server"
+)
+
+var (
+	restoreDir        string
+	restoreCtx        string
+	restoreNamespaces []string
+	restoreMapNs      map[string]string
+	restoreDryRun     string
+	restoreConflict   string
+	restoreManager    string
+	restoreCreateNs   bool
+)
+
+var restoreCmd = &cobra.Command{
+	Use:   "restore",
+	Short: "Apply an exported directory to a cluster",
+	Long: `Apply a directory written by kubectl-manifests-export to a target context.
+
+Objects are applied with server-side apply in dependency order: CRDs, Namespaces, RBAC,
+ConfigMaps/Secrets, then workloads and everything else. Objects owned by another object
+(such as the Pods of a ReplicaSet) are skipped, since their owner recreates them, and so are
+objects the cluster creates itself, such as kube-root-ca.crt and service account tokens.
+Fields allocated by the source cluster, such as Service cluster IPs, are not applied.
+
+--dry-run=client only prints the plan, --dry-run=server lets the API server validate and admit
+every object without persisting it. --on-conflict decides what happens when fields are owned
+by another field manager: fail (default), skip the object, or force taking ownership.
+
+Examples:
+  manifold-k8s restore --context staging --dir ./backup --dry-run=server
+  manifold-k8s restore -c staging -d ./backup -n payments --map-namespace payments=payments-restore
+  manifold-k8s restore -c prod -d ./backup --on-conflict force`,
+	RunE: runRestore,
+}
+
+func init() {
+	rootCmd.AddCommand(restoreCmd)
+
+	restoreCmd.Flags().StringVarP(&restoreDir, "dir", "d", "", "exported directory to restore (required)")
+	restoreCmd.Flags().StringVarP(&restoreCtx, "context", "c", "", "kubernetes context to restore into (required)")
+	restoreCmd.Flags().StringSliceVarP(&restoreNamespaces, "namespaces", "n", nil, "exported namespaces to restore (default: --namespace, or all namespaces in the export)")
+	restoreCmd.Flags().StringToStringVar(&restoreMapNs, "map-namespace", nil, "restore a namespace under another name (old=new, can be repeated)")
+	restoreCmd.Flags().StringVar(&restoreDryRun, "dry-run", restoreDryRunNone, "none, client (print the plan) or server (validate on the API server without persisting)")
+	restoreCmd.Flags().Lookup("dry-run").NoOptDefVal = restoreDryRunClient
+	restoreCmd.Flags().StringVar(&restoreConflict, "on-conflict", k8s.ConflictFail, "what to do when fields are owned by another manager: fail, skip or force")
+	restoreCmd.Flags().StringVar(&restoreManager, "field-manager", k8s.DefaultFieldManager, "field manager name used for server-side apply")
+	restoreCmd.Flags().BoolVar(&restoreCreateNs, "create-namespaces", true, "apply the target namespaces before the objects in them")
+
+	_ = restoreCmd.MarkFlagRequired("dir")
+	_ = restoreCmd.MarkFlagRequired("context")
+}
+
+func runRestore(cmd *cobra.Command, args []string) error {
+	ctx := context.Background()
+
+	if restoreDryRun != restoreDryRunNone && restoreDryRun != restoreDryRunClient && restoreDryRun != restoreDryRunServer {
+		return fmt.Errorf("invalid --dry-run value %q (must be %s, %s or %s)", restoreDryRun, restoreDryRunNone, restoreDryRunClient, restoreDryRunServer)
+	}
+	if err := k8s.ValidateConflictPolicy(restoreConflict); err != nil {
+		return err
+	}
+	rewriter, err := newRewriter(restoreMapNs, false, "")
+	if err != nil {
+		return err
+	}
+
+	exported, err := exporter.LoadExport(restoreDir)
+	if err != nil {
+		return err
+	}
+
+	items, skipped := restoreItems(exported, rewriter)
+	if len(items) == 0 {
+		return fmt.Errorf("no manifests to restore in %s", restoreDir)
+	}
+	fmt.Printf("Restoring %d object(s) from %s\n", len(items), restoreDir)
+	for _, reason := range skipped {
+		fmt.Printf("Skipped: %s\n", reason)
+	}
+
+	if restoreDryRun == restoreDryRunClient {
+		phase := -1
+		for _, item := range items {
+			if p := k8s.ApplyPhase(item.Object.GetKind()); p != phase {
+				phase = p
+				fmt.Printf("\n%s:\n", k8s.PhaseName(phase))
+			}
+			fmt.Printf("[DRY-RUN] Would apply: %s\n", applyItemName(item))
+		}
+		return nil
+	}
+
+	// Load kubeconfig
+	config, err := loadKubeConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load kubeconfig: %w", err)
+	}
+
+	client, err := newClient(config, restoreCtx)
+	if err != nil {
+		return fmt.Errorf("failed to create client for context %s: %w", restoreCtx, err)
+	}
+
+	fmt.Printf("Using context: %s\n", restoreCtx)
+	fmt.Printf("Using identity: %s\n", client.Identity())
+
+	opts := k8s.ApplyOptions{
+		FieldManager:   restoreManager,
+		ConflictPolicy: restoreConflict,
+		DryRun:         restoreDryRun == restoreDryRunServer,
+	}
+	verb := "Applied"
+	if opts.DryRun {
+		verb = "[SERVER DRY-RUN] Applied"
+	}
+
+	applied, conflicts := 0, 0
+	var errs []error
+	phase := -1
+	for _, item := range items {
+		if p := k8s.ApplyPhase(item.Object.GetKind()); p != phase {
+			phase = p
+			fmt.Printf("\n%s:\n", k8s.PhaseName(phase))
+		}
+
+		name := applyItemName(item)
+		if _, err := k8s.ApplyObject(ctx, client, item, opts); err != nil {
+			if k8s.IsConflict(err) {
+				if restoreConflict == k8s.ConflictFail {
+					err = fmt.Errorf("conflict applying %s (use --on-conflict skip or force): %w", name, err)
+					return withExitCode(failureExitCode([]error{err}, applied), err)
+				}
+				client.Logger().Warn("skipped object because of a conflict", "object", name, "error", err)
+				conflicts++
+				continue
+			}
+			client.Logger().Error("failed to apply object", "object", name, "error", err)
+			errs = append(errs, err)
+			continue
+		}
+		fmt.Printf("%s: %s\n", verb, name)
+		applied++
+	}
+
+	fmt.Printf("\n✓ %s %d object(s) to context %s\n", verb, applied, restoreCtx)
+	if conflicts > 0 {
+		fmt.Printf("Skipped %d object(s) with conflicts\n", conflicts)
+	}
+	if len(errs) > 0 {
+		return withExitCode(failureExitCode(errs, applied), fmt.Errorf("failed to apply %d object(s)", len(errs)))
+	}
+	return nil
+}
+
+// restoreItems selects and remaps the exported objects to restore, in apply order
+// It also returns the reasons for objects that are left out.
+func restoreItems(exported map[exporter.ManifestKey]*unstructured.Unstructured, rewriter *exporter.Rewriter) ([]k8s.ApplyItem, []string) {
+	wanted := namespacesOrDefault(restoreNamespaces)
+	selected := make(map[string]bool, len(wanted))
+	for _, namespace := range wanted {
+		selected[namespace] = true
+	}
+
+	var items []k8s.ApplyItem
+	var skipped []string
+	namespaces := make(map[string]bool)
+	for key, obj := range exported {
+		if len(selected) > 0 && !selected[key.Namespace] {
+			continue
+		}
+		if owners := obj.GetOwnerReferences(); len(owners) > 0 {
+			skipped = append(skipped, fmt.Sprintf("%s (owned by %s %s)", key, owners[0].Kind, owners[0].Name))
+			continue
+		}
+		gv, err := schema.ParseGroupVersion(obj.GetAPIVersion())
+		if err != nil || obj.GetKind() == "" {
+			skipped = append(skipped, fmt.Sprintf("%s (missing or invalid apiVersion/kind)", key))
+			continue
+		}
+		if reason := k8s.ClusterCreated(obj); reason != "" {
+			skipped = append(skipped, fmt.Sprintf("%s (%s)", key, reason))
+			continue
+		}
+
+		// The namespace comes from the export layout, so it is set before remapping; fields
+		// allocated by the source cluster would be rejected or conflict in the target
+		restored := k8s.StripClusterFields(obj)
+		restored.SetNamespace(key.Namespace)
+		restored = rewriter.Rewrite(restored)
+		namespaces[restored.GetNamespace()] = true
+
+		items = append(items, k8s.ApplyItem{Object: restored, GVR: gv.WithResource(key.ResourceType)})
+	}
+
+	if restoreCreateNs && len(items) > 0 {
+		for namespace := range namespaces {
+			items = append(items, k8s.NamespaceObject(namespace))
+		}
+	}
+
+	sort.Strings(skipped)
+	k8s.SortForApply(items)
+	return items, skipped
+}
+
+// applyItemName returns namespace/resource/name, or resource/name for cluster-scoped objects
+func applyItemName(item k8s.ApplyItem) string {
+	if item.Object.GetNamespace() == "" {
+		return item.GVR.Resource + "/" + item.Object.GetName()
+	}
+	return item.Object.GetNamespace() + "/" + item.GVR.Resource + "/" + item.Object.GetName()
+}
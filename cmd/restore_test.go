@@ -0,0 +1,285 @@
+package cmd
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/davidschrooten/manifold-k8s/pkg/exporter"
+	"github.com/davidschrooten/manifold-k8s/pkg/k8s"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+func resetRestoreFlags() {
+	restoreDir = ""
+	restoreCtx = ""
+	restoreNamespaces = nil
+	restoreMapNs = nil
+	restoreDryRun = restoreDryRunNone
+	restoreConflict = k8s.ConflictFail
+	restoreManager = k8s.DefaultFieldManager
+	restoreCreateNs = true
+}
+
+// writeRestoreExport writes a deployment, a configmap, a service account and an owned pod
+func writeRestoreExport(t *testing.T, dir string) {
+	t.Helper()
+	objects := map[string]*unstructured.Unstructured{
+		"deployments":     deploymentObject("web", 2, "web:1.0"),
+		"configmaps":      {Object: map[string]interface{}{"apiVersion": "v1", "kind": "ConfigMap", "metadata": map[string]interface{}{"name": "web", "namespace": "default"}}},
+		"serviceaccounts": {Object: map[string]interface{}{"apiVersion": "v1", "kind": "ServiceAccount", "metadata": map[string]interface{}{"name": "web", "namespace": "default"}}},
+	}
+	for resourceType, obj := range objects {
+		require.NoError(t, exporter.WriteManifest(obj, exporter.GenerateFilePath(dir, "default", resourceType, obj.GetName())))
+	}
+
+	pod := &unstructured.Unstructured{Object: map[string]interface{}{"apiVersion": "v1", "kind": "Pod", "metadata": map[string]interface{}{"name": "web-abc", "namespace": "default"}}}
+	pod.SetOwnerReferences([]metav1.OwnerReference{{APIVersion: "apps/v1", Kind: "ReplicaSet", Name: "web-5d8f", UID: "1"}})
+	require.NoError(t, exporter.WriteManifest(pod, exporter.GenerateFilePath(dir, "default", "pods", "web-abc")))
+}
+
+// stubRestoreClient records the server-side apply patches sent to the cluster
+func stubRestoreClient(conflictOn string) *[]k8stesting.PatchActionImpl {
+	enableStubs()
+	var patches []k8stesting.PatchActionImpl
+	dynamicClient := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme())
+	dynamicClient.PrependReactor("patch", "*", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		patch := action.(k8stesting.PatchActionImpl)
+		if patch.GetName() == conflictOn && !*patch.PatchOptions.Force {
+			return true, nil, apierrors.NewConflict(patch.GetResource().GroupResource(), patch.GetName(), nil)
+		}
+		patches = append(patches, patch)
+		return true, &unstructured.Unstructured{}, nil
+	})
+	stubNewClient = func(config *api.Config, contextName string) (*k8s.Client, error) {
+		return &k8s.Client{Clientset: &kubernetes.Clientset{}, DynamicClient: dynamicClient}, nil
+	}
+	return &patches
+}
+
+// patchedObjects returns resource/namespace/name of each patch
+func patchedObjects(patches []k8stesting.PatchActionImpl) []string {
+	var names []string
+	for _, patch := range patches {
+		names = append(names, patch.GetResource().Resource+"/"+patch.GetNamespace()+"/"+patch.GetName())
+	}
+	return names
+}
+
+func TestRestoreCmd_Flags(t *testing.T) {
+	tests := []struct {
+		flagName string
+		wantType string
+	}{
+		{"dir", "string"},
+		{"context", "string"},
+		{"namespaces", "stringSlice"},
+		{"map-namespace", "stringToString"},
+		{"dry-run", "string"},
+		{"on-conflict", "string"},
+		{"field-manager", "string"},
+		{"create-namespaces", "bool"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.flagName, func(t *testing.T) {
+			flag := restoreCmd.Flag(tt.flagName)
+			require.NotNil(t, flag, "flag %s not found", tt.flagName)
+			assert.Equal(t, tt.wantType, flag.Value.Type())
+		})
+	}
+}
+
+func TestRunRestore_DependencyOrderAndRemapping(t *testing.T) {
+	patches := stubRestoreClient("")
+	defer disableStubs()
+	defer resetRestoreFlags()
+
+	tmpDir := t.TempDir()
+	writeRestoreExport(t, tmpDir)
+
+	restoreDir = tmpDir
+	restoreCtx = "test-context"
+	restoreMapNs = map[string]string{"default": "restored"}
+	restoreDryRun = restoreDryRunServer
+
+	require.NoError(t, runRestore(restoreCmd, []string{}))
+
+	// The owned pod is skipped, the namespace is created first
+	assert.Equal(t, []string{
+		"namespaces//restored",
+		"serviceaccounts/restored/web",
+		"configmaps/restored/web",
+		"deployments/restored/web",
+	}, patchedObjects(*patches))
+
+	for _, patch := range *patches {
+		assert.Equal(t, []string{metav1.DryRunAll}, patch.PatchOptions.DryRun)
+		assert.Equal(t, k8s.DefaultFieldManager, patch.PatchOptions.FieldManager)
+	}
+}
+
+func TestRunRestore_ClusterSpecificObjects(t *testing.T) {
+	patches := stubRestoreClient("")
+	defer disableStubs()
+	defer resetRestoreFlags()
+
+	tmpDir := t.TempDir()
+	objects := map[string]*unstructured.Unstructured{
+		"services": {Object: map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "Service",
+			"metadata": map[string]interface{}{
+				"name":        "web",
+				"namespace":   "default",
+				"annotations": map[string]interface{}{"kubectl.kubernetes.io/last-applied-configuration": "{}"},
+			},
+			"spec": map[string]interface{}{"clusterIP": "10.96.0.10", "clusterIPs": []interface{}{"10.96.0.10"}},
+		}},
+		"configmaps": {Object: map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "ConfigMap",
+			"metadata":   map[string]interface{}{"name": "kube-root-ca.crt", "namespace": "default"},
+			"data":       map[string]interface{}{"ca.crt": "source cluster CA"},
+		}},
+	}
+	for resourceType, obj := range objects {
+		require.NoError(t, exporter.WriteManifest(obj, exporter.GenerateFilePath(tmpDir, "default", resourceType, obj.GetName())))
+	}
+
+	restoreDir = tmpDir
+	restoreCtx = "test-context"
+
+	require.NoError(t, runRestore(restoreCmd, []string{}))
+
+	// kube-root-ca.crt is left to the target cluster, the service loses its source cluster IPs
+	require.Equal(t, []string{"namespaces//default", "services/default/web"}, patchedObjects(*patches))
+	applied := (*patches)[1].GetPatch()
+	assert.Contains(t, string(applied), `"kind":"Service"`)
+	assert.NotContains(t, string(applied), "clusterIP")
+	assert.NotContains(t, string(applied), "last-applied-configuration")
+}
+
+func TestRunRestore_ClientDryRunDoesNotContactCluster(t *testing.T) {
+	patches := stubRestoreClient("")
+	defer disableStubs()
+	defer resetRestoreFlags()
+
+	tmpDir := t.TempDir()
+	writeRestoreExport(t, tmpDir)
+
+	restoreDir = tmpDir
+	restoreCtx = "test-context"
+	restoreDryRun = restoreDryRunClient
+	restoreCreateNs = false
+
+	require.NoError(t, runRestore(restoreCmd, []string{}))
+	assert.Empty(t, *patches)
+}
+
+func TestRunRestore_ConflictPolicies(t *testing.T) {
+	defer disableStubs()
+	defer resetRestoreFlags()
+
+	tmpDir := t.TempDir()
+	writeRestoreExport(t, tmpDir)
+
+	tests := []struct {
+		policy      string
+		wantErr     string
+		wantCode    int
+		wantPatched int
+	}{
+		{policy: k8s.ConflictFail, wantErr: "conflict applying default/serviceaccounts/web", wantCode: exitPartialFailure, wantPatched: 1},
+		{policy: k8s.ConflictSkip, wantPatched: 1},
+		{policy: k8s.ConflictForce, wantPatched: 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			// Every exported object is named web and conflicts unless forced; the namespace does not
+			patches := stubRestoreClient("web")
+			resetRestoreFlags()
+			restoreDir = tmpDir
+			restoreCtx = "test-context"
+			restoreConflict = tt.policy
+
+			err := runRestore(restoreCmd, []string{})
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tt.wantCode, exitCode(err))
+			assert.Len(t, *patches, tt.wantPatched)
+		})
+	}
+}
+
+func TestRunRestore_PermissionDenied(t *testing.T) {
+	defer disableStubs()
+	defer resetRestoreFlags()
+
+	enableStubs()
+	dynamicClient := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme())
+	dynamicClient.PrependReactor("patch", "*", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		patch := action.(k8stesting.PatchActionImpl)
+		if patch.GetResource().Resource == "deployments" {
+			return true, nil, apierrors.NewForbidden(patch.GetResource().GroupResource(), patch.GetName(), errors.New("denied"))
+		}
+		return true, &unstructured.Unstructured{}, nil
+	})
+	stubNewClient = func(config *api.Config, contextName string) (*k8s.Client, error) {
+		return &k8s.Client{Clientset: &kubernetes.Clientset{}, DynamicClient: dynamicClient}, nil
+	}
+
+	restoreDir = t.TempDir()
+	writeRestoreExport(t, restoreDir)
+	restoreCtx = "test-context"
+
+	err := runRestore(restoreCmd, []string{})
+	assert.EqualError(t, err, "failed to apply 1 object(s)")
+	assert.Equal(t, exitPermissionDenied, exitCode(err))
+}
+
+func TestRunRestore_InvalidOptions(t *testing.T) {
+	defer resetRestoreFlags()
+
+	tests := []struct {
+		name    string
+		setup   func()
+		wantErr string
+	}{
+		{"dry-run", func() { restoreDryRun = "yes" }, `invalid --dry-run value "yes" (must be none, client or server)`},
+		{"conflict policy", func() { restoreConflict = "merge" }, `invalid conflict policy "merge" (must be fail, skip or force)`},
+		{"namespace mapping", func() { restoreMapNs = map[string]string{"payments": ""} }, `invalid namespace mapping "payments"="" (expected old=new)`},
+		{"missing directory", func() { restoreDir = "/nonexistent/backup" }, "failed to read export directory"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetRestoreFlags()
+			restoreCtx = "test-context"
+			restoreDir = t.TempDir()
+			tt.setup()
+			assert.ErrorContains(t, runRestore(restoreCmd, []string{}), tt.wantErr)
+		})
+	}
+}
+
+func TestRunRestore_EmptyExport(t *testing.T) {
+	defer resetRestoreFlags()
+
+	restoreDir = t.TempDir()
+	restoreCtx = "test-context"
+
+	assert.ErrorContains(t, runRestore(restoreCmd, []string{}), "no manifests to restore")
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 
+	"github.com/davidschrooten/manifold-k8s/pkg/k8s"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
@@ -25,19 +26,53 @@ The tool guides you through:
 }
 
 func Execute() {
-	if err := rootCmd.Execute(); err != nil {
+	if cmd, err := rootCmd.ExecuteC(); err != nil {
 		fmt.Fprintln(os.Stderr, err)
-		os.Exit(1)
+		os.Exit(commandExitCode(cmd, err))
 	}
 }
 
 func init() {
 	cobra.OnInitialize(initConfig)
+	rootCmd.PersistentPreRunE = setupLogging
+
+	// A failed run prints its own summary; the usage only helps with invalid flags
+	rootCmd.SilenceUsage = true
+	rootCmd.SetFlagErrorFunc(func(cmd *cobra.Command, err error) error {
+		cmd.PrintErrln(cmd.UsageString())
+		return err
+	})
 
 	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is ./config.toml)")
-	rootCmd.PersistentFlags().String("kubeconfig", "", "path to kubeconfig file (default is $HOME/.kube/config)")
+	rootCmd.PersistentFlags().String("kubeconfig", "", "path to kubeconfig file (default is $KUBECONFIG or $HOME/.kube/config)")
+	rootCmd.PersistentFlags().String("cluster", "", "name of the kubeconfig cluster to use (overrides the context's cluster)")
+	rootCmd.PersistentFlags().String("user", "", "name of the kubeconfig user to use (overrides the context's user)")
+	rootCmd.PersistentFlags().String("namespace", "", "namespace to use when --namespaces is not given (overrides the context's namespace)")
+	rootCmd.PersistentFlags().String("as", "", "username or ServiceAccount to impersonate (e.g. system:serviceaccount:ns:name)")
+	rootCmd.PersistentFlags().StringArray("as-group", nil, "group to impersonate (can be repeated)")
+	rootCmd.PersistentFlags().String("as-uid", "", "UID to impersonate")
+	rootCmd.PersistentFlags().String("cache-dir", "", "directory for the discovery cache (default is $HOME/.kube/cache)")
+	rootCmd.PersistentFlags().Duration("discovery-cache-ttl", k8s.DefaultDiscoveryCacheTTL, "how long cached discovery results are used before refreshing")
+	rootCmd.PersistentFlags().Bool("refresh-discovery", false, "ignore the discovery cache and refresh it from the API server")
+	rootCmd.PersistentFlags().CountP("verbose", "v", "log more details: -v for info, -vv for debug records")
+	rootCmd.PersistentFlags().BoolP("quiet", "q", false, "only log errors and hide the progress of the export commands")
+	rootCmd.PersistentFlags().String("log-format", logFormatText, "format of the log records on stderr: text or json")
+	rootCmd.PersistentFlags().Bool("trace-http", false, "log every request to the API server (implies -vv)")
 
 	_ = viper.BindPFlag("kubeconfig", rootCmd.PersistentFlags().Lookup("kubeconfig"))
+	_ = viper.BindPFlag("cluster", rootCmd.PersistentFlags().Lookup("cluster"))
+	_ = viper.BindPFlag("user", rootCmd.PersistentFlags().Lookup("user"))
+	_ = viper.BindPFlag("namespace", rootCmd.PersistentFlags().Lookup("namespace"))
+	_ = viper.BindPFlag("as", rootCmd.PersistentFlags().Lookup("as"))
+	_ = viper.BindPFlag("as-group", rootCmd.PersistentFlags().Lookup("as-group"))
+	_ = viper.BindPFlag("as-uid", rootCmd.PersistentFlags().Lookup("as-uid"))
+	_ = viper.BindPFlag("cache-dir", rootCmd.PersistentFlags().Lookup("cache-dir"))
+	_ = viper.BindPFlag("discovery-cache-ttl", rootCmd.PersistentFlags().Lookup("discovery-cache-ttl"))
+	_ = viper.BindPFlag("refresh-discovery", rootCmd.PersistentFlags().Lookup("refresh-discovery"))
+	_ = viper.BindPFlag("verbose", rootCmd.PersistentFlags().Lookup("verbose"))
+	_ = viper.BindPFlag("quiet", rootCmd.PersistentFlags().Lookup("quiet"))
+	_ = viper.BindPFlag("log-format", rootCmd.PersistentFlags().Lookup("log-format"))
+	_ = viper.BindPFlag("trace-http", rootCmd.PersistentFlags().Lookup("trace-http"))
 }
 
 func initConfig() {
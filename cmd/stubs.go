@@ -16,6 +16,10 @@ var (
 	stubNewClient         func(*api.Config, string) (*k8s.Client, error)
 	stubDiscoverResources func(discovery.DiscoveryInterface) ([]k8s.ResourceInfo, error)
 	stubGetNamespaces     func(context.Context, *k8s.Client) ([]string, error)
+	stubCheckListAccess   func(context.Context, *k8s.Client, []k8s.ResourceInfo, []string) ([]k8s.AccessCheck, error)
 	stubListHelmReleases  func(namespace string) ([]helm.Release, error)
 	stubGetHelmValues     func(releaseName, namespace string) (string, error)
+	stubGetHelmUserValues func(releaseName, namespace string) (string, error)
+	stubGetHelmRelease    func(releaseName, namespace string) (*helm.ReleaseDetails, error)
+	stubGetHelmHistory    func(releaseName, namespace string, max int) ([]*helm.ReleaseDetails, error)
 )
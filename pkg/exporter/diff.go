@@ -0,0 +1,243 @@
+package exporter
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pmezard/go-difflib/difflib"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/yaml"
+)
+
+// ManifestKey identifies an object by its location in an export tree
+type ManifestKey struct {
+	Namespace    string
+	ResourceType string
+	Name         string
+}
+
+// String returns the key as namespace/resourceType/name
+func (k ManifestKey) String() string {
+	return k.Namespace + "/" + k.ResourceType + "/" + k.Name
+}
+
+// ObjectDiff is the unified diff of an object that differs between two sides
+type ObjectDiff struct {
+	Key  ManifestKey
+	Diff string
+}
+
+// DiffResult is the outcome of comparing two sets of manifests, such as an export and the cluster
+type DiffResult struct {
+	Modified  []ObjectDiff
+	Added     []ManifestKey // only on the "to" side (the cluster, for a diff)
+	Removed   []ManifestKey // only on the "from" side (the export, for a diff)
+	Unchanged int
+}
+
+// HasDrift reports whether any object was modified, added or removed
+func (r *DiffResult) HasDrift() bool {
+	return len(r.Modified) > 0 || len(r.Added) > 0 || len(r.Removed) > 0
+}
+
+// Summary returns a one-line summary of the comparison
+func (r *DiffResult) Summary() string {
+	return fmt.Sprintf("%d modified, %d added, %d removed, %d unchanged", len(r.Modified), len(r.Added), len(r.Removed), r.Unchanged)
+}
+
+// LoadExport reads every manifest of an export tree (<baseDir>/<namespace>/<resourceType>/<name>.yaml)
+func LoadExport(baseDir string) (map[ManifestKey]*unstructured.Unstructured, error) {
+	if _, err := os.Stat(baseDir); err != nil {
+		return nil, fmt.Errorf("failed to read export directory: %w", err)
+	}
+
+	manifests := make(map[ManifestKey]*unstructured.Unstructured)
+	err := filepath.WalkDir(baseDir, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || filepath.Ext(path) != ".yaml" {
+			return nil
+		}
+
+		rel, err := filepath.Rel(baseDir, path)
+		if err != nil {
+			return err
+		}
+		parts := strings.Split(filepath.ToSlash(rel), "/")
+		if len(parts) != 3 {
+			// Not part of the namespace/resourceType/name layout
+			return nil
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		obj := &unstructured.Unstructured{}
+		if err := yaml.Unmarshal(data, &obj.Object); err != nil {
+			return fmt.Errorf("failed to parse %s: %w", path, err)
+		}
+
+		key := ManifestKey{Namespace: parts[0], ResourceType: parts[1], Name: strings.TrimSuffix(parts[2], ".yaml")}
+		manifests[key] = obj
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return manifests, nil
+}
+
+// DiffManifests compares exported manifests with live objects
+// Live objects are cleaned with CleanManifest first, so only meaningful changes are reported.
+func DiffManifests(exported, live map[ManifestKey]*unstructured.Unstructured) (*DiffResult, error) {
+	return CompareManifests(exported, live, CompareOptions{FromLabel: "exported", ToLabel: "live"})
+}
+
+// CompareOptions configures how two sets of manifests are compared
+type CompareOptions struct {
+	FromLabel   string   // prefix of the "from" file names in diffs
+	ToLabel     string   // prefix of the "to" file names in diffs
+	IgnorePaths []string // dotted field paths left out of the comparison, see RemovePaths
+}
+
+// CompareManifests compares two sets of manifests after cleaning both with CleanManifest and
+// removing the ignored paths. Added objects only exist in to, removed objects only in from.
+func CompareManifests(from, to map[ManifestKey]*unstructured.Unstructured, opts CompareOptions) (*DiffResult, error) {
+	result := &DiffResult{}
+
+	for _, key := range sortedKeys(from) {
+		toObj, ok := to[key]
+		if !ok {
+			result.Removed = append(result.Removed, key)
+			continue
+		}
+
+		fromObj := RemovePaths(CleanManifest(from[key]), opts.IgnorePaths)
+		toObj = RemovePaths(CleanManifest(toObj), opts.IgnorePaths)
+		diff, err := unifiedDiff(key, fromObj, toObj, opts.FromLabel, opts.ToLabel)
+		if err != nil {
+			return nil, err
+		}
+		if diff == "" {
+			result.Unchanged++
+			continue
+		}
+		result.Modified = append(result.Modified, ObjectDiff{Key: key, Diff: diff})
+	}
+
+	for _, key := range sortedKeys(to) {
+		if _, ok := from[key]; !ok {
+			result.Added = append(result.Added, key)
+		}
+	}
+
+	return result, nil
+}
+
+// ValidatePaths checks dotted field paths such as "spec.replicas"
+func ValidatePaths(paths []string) error {
+	for _, p := range paths {
+		for _, segment := range strings.Split(p, ".") {
+			if segment == "" {
+				return fmt.Errorf("invalid field path %q", p)
+			}
+		}
+	}
+	return nil
+}
+
+// RemovePaths returns a copy of the object without the given dotted field paths
+// A "*" segment matches every map key or list element, and numeric segments index lists,
+// e.g. "spec.template.spec.containers.*.image". Paths that do not exist are ignored.
+func RemovePaths(obj *unstructured.Unstructured, paths []string) *unstructured.Unstructured {
+	if len(paths) == 0 {
+		return obj
+	}
+	cleaned := obj.DeepCopy()
+	for _, p := range paths {
+		removePath(cleaned.Object, strings.Split(p, "."))
+	}
+	return cleaned
+}
+
+// removePath removes the field at segments below node
+func removePath(node interface{}, segments []string) {
+	if len(segments) == 0 {
+		return
+	}
+	segment, rest := segments[0], segments[1:]
+
+	switch value := node.(type) {
+	case map[string]interface{}:
+		if segment == "*" {
+			for key := range value {
+				if len(rest) == 0 {
+					delete(value, key)
+				} else {
+					removePath(value[key], rest)
+				}
+			}
+			return
+		}
+		if len(rest) == 0 {
+			delete(value, segment)
+			return
+		}
+		removePath(value[segment], rest)
+	case []interface{}:
+		// Removing list elements would shift the others, so only their fields are removed
+		if len(rest) == 0 {
+			return
+		}
+		if segment == "*" {
+			for _, item := range value {
+				removePath(item, rest)
+			}
+			return
+		}
+		if i, err := strconv.Atoi(segment); err == nil && i >= 0 && i < len(value) {
+			removePath(value[i], rest)
+		}
+	}
+}
+
+// unifiedDiff returns the unified diff between the YAML of two objects, or "" when they are equal
+func unifiedDiff(key ManifestKey, from, to *unstructured.Unstructured, fromLabel, toLabel string) (string, error) {
+	fromYAML, err := yaml.Marshal(from.Object)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal %s: %w", key, err)
+	}
+	toYAML, err := yaml.Marshal(to.Object)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal %s: %w", key, err)
+	}
+	if string(fromYAML) == string(toYAML) {
+		return "", nil
+	}
+
+	return difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(strings.TrimSuffix(string(fromYAML), "\n")),
+		B:        difflib.SplitLines(strings.TrimSuffix(string(toYAML), "\n")),
+		FromFile: fromLabel + "/" + key.String() + ".yaml",
+		ToFile:   toLabel + "/" + key.String() + ".yaml",
+		Context:  3,
+	})
+}
+
+// sortedKeys returns the keys of a manifest map in a stable order
+func sortedKeys(manifests map[ManifestKey]*unstructured.Unstructured) []ManifestKey {
+	keys := make([]ManifestKey, 0, len(manifests))
+	for key := range manifests {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].String() < keys[j].String()
+	})
+	return keys
+}
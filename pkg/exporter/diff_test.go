@@ -0,0 +1,239 @@
+package exporter
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func configMap(namespace, name string, data map[string]interface{}) *unstructured.Unstructured {
+	return &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "ConfigMap",
+			"metadata": map[string]interface{}{
+				"name":      name,
+				"namespace": namespace,
+			},
+			"data": data,
+		},
+	}
+}
+
+func TestLoadExport(t *testing.T) {
+	tmpDir := t.TempDir()
+	exp := NewExporter(tmpDir)
+
+	obj := configMap("default", "app-config", map[string]interface{}{"mode": "prod"})
+	if err := WriteManifest(obj, GenerateFilePath(exp.BaseDir, "default", "configmaps", "app-config")); err != nil {
+		t.Fatalf("WriteManifest() error = %v", err)
+	}
+	// Files outside the namespace/resourceType/name layout are ignored
+	if err := os.WriteFile(filepath.Join(tmpDir, "helmfile.yaml"), []byte("releases: []\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	manifests, err := LoadExport(tmpDir)
+	if err != nil {
+		t.Fatalf("LoadExport() error = %v", err)
+	}
+	if len(manifests) != 1 {
+		t.Fatalf("LoadExport() returned %d manifests, want 1", len(manifests))
+	}
+
+	key := ManifestKey{Namespace: "default", ResourceType: "configmaps", Name: "app-config"}
+	loaded, ok := manifests[key]
+	if !ok {
+		t.Fatalf("LoadExport() missing %s", key)
+	}
+	if loaded.GetKind() != "ConfigMap" || loaded.GetName() != "app-config" {
+		t.Errorf("LoadExport() loaded %s %s", loaded.GetKind(), loaded.GetName())
+	}
+}
+
+func TestLoadExport_MissingDirectory(t *testing.T) {
+	if _, err := LoadExport(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Error("LoadExport() expected error for a missing directory")
+	}
+}
+
+func TestLoadExport_InvalidYAML(t *testing.T) {
+	tmpDir := t.TempDir()
+	path := GenerateFilePath(tmpDir, "default", "configmaps", "broken")
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte("data: [unclosed"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := LoadExport(tmpDir); err == nil || !strings.Contains(err.Error(), "failed to parse") {
+		t.Errorf("LoadExport() error = %v, want parse error", err)
+	}
+}
+
+func TestDiffManifests(t *testing.T) {
+	same := ManifestKey{Namespace: "default", ResourceType: "configmaps", Name: "same"}
+	changed := ManifestKey{Namespace: "default", ResourceType: "configmaps", Name: "changed"}
+	removed := ManifestKey{Namespace: "default", ResourceType: "configmaps", Name: "removed"}
+	added := ManifestKey{Namespace: "default", ResourceType: "configmaps", Name: "added"}
+
+	exported := map[ManifestKey]*unstructured.Unstructured{
+		same:    configMap("default", "same", map[string]interface{}{"a": "1"}),
+		changed: configMap("default", "changed", map[string]interface{}{"mode": "prod"}),
+		removed: configMap("default", "removed", nil),
+	}
+
+	liveSame := configMap("default", "same", map[string]interface{}{"a": "1"})
+	// Runtime fields are cleaned before comparing
+	liveSame.SetResourceVersion("12345")
+	liveSame.SetUID("abc")
+	live := map[ManifestKey]*unstructured.Unstructured{
+		same:    liveSame,
+		changed: configMap("default", "changed", map[string]interface{}{"mode": "debug"}),
+		added:   configMap("default", "added", nil),
+	}
+
+	result, err := DiffManifests(exported, live)
+	if err != nil {
+		t.Fatalf("DiffManifests() error = %v", err)
+	}
+
+	if !result.HasDrift() {
+		t.Error("HasDrift() = false, want true")
+	}
+	if result.Unchanged != 1 {
+		t.Errorf("Unchanged = %d, want 1", result.Unchanged)
+	}
+	if len(result.Added) != 1 || result.Added[0] != added {
+		t.Errorf("Added = %v, want [%s]", result.Added, added)
+	}
+	if len(result.Removed) != 1 || result.Removed[0] != removed {
+		t.Errorf("Removed = %v, want [%s]", result.Removed, removed)
+	}
+	if len(result.Modified) != 1 || result.Modified[0].Key != changed {
+		t.Fatalf("Modified = %v, want [%s]", result.Modified, changed)
+	}
+
+	diff := result.Modified[0].Diff
+	for _, want := range []string{
+		"--- exported/default/configmaps/changed.yaml",
+		"+++ live/default/configmaps/changed.yaml",
+		"-  mode: prod",
+		"+  mode: debug",
+	} {
+		if !strings.Contains(diff, want) {
+			t.Errorf("diff missing %q:\n%s", want, diff)
+		}
+	}
+
+	if got, want := result.Summary(), "1 modified, 1 added, 1 removed, 1 unchanged"; got != want {
+		t.Errorf("Summary() = %q, want %q", got, want)
+	}
+}
+
+func TestDiffManifests_NoDrift(t *testing.T) {
+	key := ManifestKey{Namespace: "default", ResourceType: "configmaps", Name: "same"}
+	exported := map[ManifestKey]*unstructured.Unstructured{key: configMap("default", "same", nil)}
+	live := map[ManifestKey]*unstructured.Unstructured{key: configMap("default", "same", nil)}
+
+	result, err := DiffManifests(exported, live)
+	if err != nil {
+		t.Fatalf("DiffManifests() error = %v", err)
+	}
+	if result.HasDrift() {
+		t.Errorf("HasDrift() = true, want false: %+v", result)
+	}
+}
+
+func TestCompareManifests_IgnorePaths(t *testing.T) {
+	key := ManifestKey{Namespace: "default", ResourceType: "deployments", Name: "web"}
+	deployment := func(replicas int64, image, version string) *unstructured.Unstructured {
+		return &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "apps/v1",
+			"kind":       "Deployment",
+			"metadata":   map[string]interface{}{"name": "web", "namespace": "default", "labels": map[string]interface{}{"version": version}},
+			"spec": map[string]interface{}{
+				"replicas": replicas,
+				"template": map[string]interface{}{"spec": map[string]interface{}{
+					"containers": []interface{}{map[string]interface{}{"name": "web", "image": image}},
+				}},
+			},
+		}}
+	}
+
+	staging := map[ManifestKey]*unstructured.Unstructured{key: deployment(1, "web:1.1", "1.1")}
+	prod := map[ManifestKey]*unstructured.Unstructured{key: deployment(5, "web:1.0", "1.0")}
+
+	opts := CompareOptions{FromLabel: "staging", ToLabel: "prod", IgnorePaths: []string{"spec.replicas", "spec.template.spec.containers.*.image"}}
+	result, err := CompareManifests(staging, prod, opts)
+	if err != nil {
+		t.Fatalf("CompareManifests() error = %v", err)
+	}
+	if len(result.Modified) != 1 {
+		t.Fatalf("Modified = %v, want 1 object", result.Modified)
+	}
+	diff := result.Modified[0].Diff
+	if strings.Contains(diff, "replicas") || strings.Contains(diff, "image") {
+		t.Errorf("diff should not contain ignored paths:\n%s", diff)
+	}
+	if !strings.Contains(diff, "--- staging/default/deployments/web.yaml") || !strings.Contains(diff, "+    version: \"1.0\"") {
+		t.Errorf("diff missing the label change:\n%s", diff)
+	}
+
+	// The inputs are left untouched
+	if replicas, _, _ := unstructured.NestedInt64(staging[key].Object, "spec", "replicas"); replicas != 1 {
+		t.Errorf("CompareManifests() modified its input, replicas = %d", replicas)
+	}
+
+	opts.IgnorePaths = append(opts.IgnorePaths, "metadata.labels")
+	result, err = CompareManifests(staging, prod, opts)
+	if err != nil {
+		t.Fatalf("CompareManifests() error = %v", err)
+	}
+	if result.HasDrift() || result.Unchanged != 1 {
+		t.Errorf("CompareManifests() = %+v, want no drift", result)
+	}
+}
+
+func TestRemovePaths(t *testing.T) {
+	obj := &unstructured.Unstructured{Object: map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]interface{}{"a": "1", "b": "2"},
+		},
+		"spec": map[string]interface{}{
+			"items": []interface{}{
+				map[string]interface{}{"name": "x", "value": "1"},
+				map[string]interface{}{"name": "y", "value": "2"},
+			},
+		},
+	}}
+
+	removed := RemovePaths(obj, []string{"metadata.annotations.*", "spec.items.0.value", "spec.missing.field"})
+
+	annotations, _, _ := unstructured.NestedMap(removed.Object, "metadata", "annotations")
+	if len(annotations) != 0 {
+		t.Errorf("annotations = %v, want none", annotations)
+	}
+	items, _, _ := unstructured.NestedSlice(removed.Object, "spec", "items")
+	if _, found := items[0].(map[string]interface{})["value"]; found {
+		t.Error("spec.items.0.value was not removed")
+	}
+	if items[1].(map[string]interface{})["value"] != "2" {
+		t.Error("spec.items.1.value should be kept")
+	}
+}
+
+func TestValidatePaths(t *testing.T) {
+	if err := ValidatePaths([]string{"spec.replicas", "spec.template.spec.containers.*.image"}); err != nil {
+		t.Errorf("ValidatePaths() error = %v", err)
+	}
+	for _, path := range []string{"", "spec..replicas", ".spec"} {
+		if err := ValidatePaths([]string{path}); err == nil {
+			t.Errorf("ValidatePaths(%q) expected error", path)
+		}
+	}
+}
@@ -0,0 +1,240 @@
+package exporter
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/davidschrooten/manifold-k8s/pkg/helm"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/yaml"
+)
+
+// ChartTemplatesDir is the directory of a chart holding its templates
+const ChartTemplatesDir = "templates"
+
+// podSpecPaths locates the pod spec of the workload kinds whose values are pulled out
+var podSpecPaths = map[string][]string{
+	"Deployment":  {"spec", "template", "spec"},
+	"StatefulSet": {"spec", "template", "spec"},
+	"DaemonSet":   {"spec", "template", "spec"},
+	"ReplicaSet":  {"spec", "template", "spec"},
+	"Job":         {"spec", "template", "spec"},
+	"CronJob":     {"spec", "jobTemplate", "spec", "template", "spec"},
+}
+
+var (
+	identifierPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	delimiterPattern  = regexp.MustCompile(`\{\{|\}\}`)
+)
+
+// chartTemplate collects the values pulled out of one manifest and the template expressions
+// that replace them
+type chartTemplate struct {
+	values       map[string]interface{}
+	expressions  map[string]string
+	placeholders int
+}
+
+// WriteHelmChart turns the manifests exported into the templates directory of chartDir into a
+// Helm chart. Image repositories and tags, replica counts and container resource limits and
+// requests are moved to values.yaml, and the templates reference them; Chart.yaml is written
+// from metadata.
+func WriteHelmChart(chartDir string, metadata helm.ChartMetadata) error {
+	templatesDir := filepath.Join(chartDir, ChartTemplatesDir)
+	manifests, err := LoadExport(templatesDir)
+	if err != nil {
+		return err
+	}
+
+	// Values are keyed by resource type and name, and by namespace first when there are several
+	namespaces := make(map[string]bool)
+	for key := range manifests {
+		namespaces[key.Namespace] = true
+	}
+
+	values := make(map[string]interface{})
+	for _, key := range sortedKeys(manifests) {
+		prefix := []string{key.ResourceType, key.Name}
+		if len(namespaces) > 1 {
+			prefix = append([]string{key.Namespace}, prefix...)
+		}
+
+		content, objectValues, err := templateManifest(manifests[key], prefix)
+		if err != nil {
+			return fmt.Errorf("failed to template %s: %w", key, err)
+		}
+		if err := writeFile(GenerateFilePath(templatesDir, key.Namespace, key.ResourceType, key.Name), []byte(content)); err != nil {
+			return err
+		}
+		if len(objectValues) > 0 {
+			setNestedValue(values, prefix, objectValues)
+		}
+	}
+
+	valuesData, err := yaml.Marshal(values)
+	if err != nil {
+		return fmt.Errorf("failed to marshal values: %w", err)
+	}
+	if err := writeFile(filepath.Join(chartDir, "values.yaml"), valuesData); err != nil {
+		return err
+	}
+
+	if metadata.APIVersion == "" {
+		metadata.APIVersion = "v2"
+	}
+	if metadata.Type == "" {
+		metadata.Type = "application"
+	}
+	if metadata.Version == "" {
+		metadata.Version = "0.1.0"
+	}
+	chartData, err := yaml.Marshal(metadata)
+	if err != nil {
+		return fmt.Errorf("failed to marshal Chart.yaml: %w", err)
+	}
+	return writeFile(filepath.Join(chartDir, "Chart.yaml"), chartData)
+}
+
+// templateManifest returns the template text of a manifest and the values pulled out of it
+// The values are replaced by placeholders before marshalling, which are then swapped for
+// template expressions; template delimiters already in the manifest are escaped.
+func templateManifest(obj *unstructured.Unstructured, prefix []string) (string, map[string]interface{}, error) {
+	obj = obj.DeepCopy()
+	t := &chartTemplate{values: make(map[string]interface{}), expressions: make(map[string]string)}
+
+	if specPath, ok := podSpecPaths[obj.GetKind()]; ok {
+		if replicas, found, _ := unstructured.NestedFieldNoCopy(obj.Object, "spec", "replicas"); found {
+			placeholder := t.pullOut(prefix, []string{"replicas"}, replicas, "")
+			_ = unstructured.SetNestedField(obj.Object, placeholder, "spec", "replicas")
+		}
+		if podSpec, found, _ := unstructured.NestedMap(obj.Object, specPath...); found {
+			for _, field := range []string{"initContainers", "containers"} {
+				t.templateContainers(podSpec, field, prefix)
+			}
+			_ = unstructured.SetNestedMap(obj.Object, podSpec, specPath...)
+		}
+	}
+
+	data, err := yaml.Marshal(obj.Object)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to marshal to YAML: %w", err)
+	}
+	content := escapeTemplateDelimiters(string(data))
+	for placeholder, expression := range t.expressions {
+		content = strings.ReplaceAll(content, placeholder, expression)
+	}
+	return content, t.values, nil
+}
+
+// templateContainers pulls the image and resources of each container out of podSpec[field]
+func (t *chartTemplate) templateContainers(podSpec map[string]interface{}, field string, prefix []string) {
+	containers, ok := podSpec[field].([]interface{})
+	if !ok {
+		return
+	}
+
+	for _, item := range containers {
+		container, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		name, _ := container["name"].(string)
+		if name == "" {
+			continue
+		}
+		path := []string{field, name}
+
+		if image, ok := container["image"].(string); ok && image != "" {
+			repository, tag := splitImage(image)
+			repositoryRef := t.valueRef(prefix, append(path, "image", "repository"), repository)
+			if tag == "" {
+				container["image"] = t.placeholder(fmt.Sprintf("{{ %s | quote }}", repositoryRef))
+			} else {
+				tagRef := t.valueRef(prefix, append(path, "image", "tag"), tag)
+				container["image"] = t.placeholder(fmt.Sprintf(`"{{ %s }}:{{ %s }}"`, repositoryRef, tagRef))
+			}
+		}
+
+		resources, ok := container["resources"].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		for _, kind := range []string{"limits", "requests"} {
+			quantities, ok := resources[kind].(map[string]interface{})
+			if !ok {
+				continue
+			}
+			for resource, quantity := range quantities {
+				quantities[resource] = t.pullOut(prefix, append(path, "resources", kind, resource), quantity, " | quote")
+			}
+		}
+	}
+}
+
+// pullOut stores value at path and returns the placeholder of the expression referencing it
+func (t *chartTemplate) pullOut(prefix, path []string, value interface{}, pipeline string) string {
+	return t.placeholder(fmt.Sprintf("{{ %s%s }}", t.valueRef(prefix, path, value), pipeline))
+}
+
+// valueRef stores value at path and returns the expression referencing it
+func (t *chartTemplate) valueRef(prefix, path []string, value interface{}) string {
+	setNestedValue(t.values, path, value)
+	return valuesReference(append(append([]string{}, prefix...), path...))
+}
+
+// placeholder registers a template expression and returns the string standing in for it
+func (t *chartTemplate) placeholder(expression string) string {
+	t.placeholders++
+	placeholder := fmt.Sprintf("__MANIFOLD_VALUE_%d__", t.placeholders)
+	t.expressions[placeholder] = expression
+	return placeholder
+}
+
+// valuesReference returns the template expression of a values path, using index when a key is
+// not a valid identifier
+func valuesReference(path []string) string {
+	for _, segment := range path {
+		if !identifierPattern.MatchString(segment) {
+			quoted := make([]string, len(path))
+			for i, segment := range path {
+				quoted[i] = fmt.Sprintf("%q", segment)
+			}
+			return "index .Values " + strings.Join(quoted, " ")
+		}
+	}
+	return ".Values." + strings.Join(path, ".")
+}
+
+// setNestedValue sets value at path in values, creating the maps on the way
+func setNestedValue(values map[string]interface{}, path []string, value interface{}) {
+	for _, segment := range path[:len(path)-1] {
+		child, ok := values[segment].(map[string]interface{})
+		if !ok {
+			child = make(map[string]interface{})
+			values[segment] = child
+		}
+		values = child
+	}
+	values[path[len(path)-1]] = value
+}
+
+// splitImage splits an image reference into repository and tag
+// References pinned by digest are kept whole, since the digest identifies the image.
+func splitImage(image string) (string, string) {
+	if strings.Contains(image, "@") {
+		return image, ""
+	}
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		return image[:i], image[i+1:]
+	}
+	return image, ""
+}
+
+// escapeTemplateDelimiters escapes {{ and }} so that Helm renders them literally
+func escapeTemplateDelimiters(s string) string {
+	return delimiterPattern.ReplaceAllStringFunc(s, func(delimiter string) string {
+		return fmt.Sprintf("{{ %q }}", delimiter)
+	})
+}
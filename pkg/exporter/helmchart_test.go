@@ -0,0 +1,191 @@
+package exporter
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"text/template"
+
+	"github.com/davidschrooten/manifold-k8s/pkg/helm"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/yaml"
+)
+
+// renderChartTemplate renders a template the way Helm would for the functions used in exported charts
+func renderChartTemplate(t *testing.T, content string, values map[string]interface{}) map[string]interface{} {
+	t.Helper()
+	tmpl, err := template.New("manifest").Funcs(template.FuncMap{
+		"quote": func(v interface{}) string { return fmt.Sprintf("%q", fmt.Sprint(v)) },
+	}).Parse(content)
+	if err != nil {
+		t.Fatalf("template does not parse: %v\n%s", err, content)
+	}
+	var out bytes.Buffer
+	if err := tmpl.Execute(&out, map[string]interface{}{"Values": values}); err != nil {
+		t.Fatalf("template does not render: %v\n%s", err, content)
+	}
+	var rendered map[string]interface{}
+	if err := yaml.Unmarshal(out.Bytes(), &rendered); err != nil {
+		t.Fatalf("rendered template is not YAML: %v\n%s", err, out.String())
+	}
+	return rendered
+}
+
+func TestWriteHelmChart(t *testing.T) {
+	deployment := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "apps/v1",
+		"kind":       "Deployment",
+		"metadata":   map[string]interface{}{"name": "web-app", "namespace": "default"},
+		"spec": map[string]interface{}{
+			"replicas": int64(3),
+			"template": map[string]interface{}{"spec": map[string]interface{}{
+				"initContainers": []interface{}{map[string]interface{}{"name": "migrate", "image": "registry.example.com:5000/web/migrate"}},
+				"containers": []interface{}{map[string]interface{}{
+					"name":  "web",
+					"image": "registry.example.com:5000/web:1.25",
+					"resources": map[string]interface{}{
+						"limits":   map[string]interface{}{"cpu": "500m", "memory": "256Mi"},
+						"requests": map[string]interface{}{"cpu": "1"},
+					},
+				}},
+			}},
+		},
+	}}
+	cronJob := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "batch/v1",
+		"kind":       "CronJob",
+		"metadata":   map[string]interface{}{"name": "report", "namespace": "default"},
+		"spec": map[string]interface{}{"jobTemplate": map[string]interface{}{"spec": map[string]interface{}{"template": map[string]interface{}{"spec": map[string]interface{}{
+			"containers": []interface{}{map[string]interface{}{"name": "report", "image": "report@sha256:abc123"}},
+		}}}}},
+	}}
+	rules := configMap("default", "alerts", map[string]interface{}{"rule": "{{ $labels.instance }} is down"})
+
+	tmpDir := t.TempDir()
+	templatesDir := filepath.Join(tmpDir, ChartTemplatesDir)
+	originals := map[string]*unstructured.Unstructured{"deployments": deployment, "cronjobs": cronJob, "configmaps": rules}
+	for resourceType, obj := range originals {
+		if err := WriteManifest(obj, GenerateFilePath(templatesDir, "default", resourceType, obj.GetName())); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := WriteHelmChart(tmpDir, helm.ChartMetadata{Name: "web"}); err != nil {
+		t.Fatalf("WriteHelmChart() error = %v", err)
+	}
+
+	chart, err := os.ReadFile(filepath.Join(tmpDir, "Chart.yaml"))
+	if err != nil {
+		t.Fatalf("Chart.yaml not written: %v", err)
+	}
+	if want := "apiVersion: v2\nname: web\ntype: application\nversion: 0.1.0\n"; string(chart) != want {
+		t.Errorf("Chart.yaml =\n%s\nwant\n%s", chart, want)
+	}
+
+	valuesData, err := os.ReadFile(filepath.Join(tmpDir, "values.yaml"))
+	if err != nil {
+		t.Fatalf("values.yaml not written: %v", err)
+	}
+	var values map[string]interface{}
+	if err := yaml.Unmarshal(valuesData, &values); err != nil {
+		t.Fatal(err)
+	}
+
+	wantValues := map[string]string{
+		"deployments.web-app.replicas":                                "3",
+		"deployments.web-app.containers.web.image.repository":         "registry.example.com:5000/web",
+		"deployments.web-app.containers.web.image.tag":                "1.25",
+		"deployments.web-app.containers.web.resources.limits.memory":  "256Mi",
+		"deployments.web-app.containers.web.resources.requests.cpu":   "1",
+		"deployments.web-app.initContainers.migrate.image.repository": "registry.example.com:5000/web/migrate",
+		"cronjobs.report.containers.report.image.repository":          "report@sha256:abc123",
+	}
+	for path, want := range wantValues {
+		value, found, _ := unstructured.NestedFieldNoCopy(values, strings.Split(path, ".")...)
+		if !found || fmt.Sprint(value) != want {
+			t.Errorf("values %s = %v, want %s", path, value, want)
+		}
+	}
+	if _, found := values["configmaps"]; found {
+		t.Error("ConfigMaps should not have values")
+	}
+
+	// Rendering the templates with the default values gives back the exported objects
+	for resourceType, obj := range originals {
+		content, err := os.ReadFile(GenerateFilePath(templatesDir, "default", resourceType, obj.GetName()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resourceType == "deployments" && !strings.Contains(string(content), `{{ index .Values "deployments" "web-app" "replicas" }}`) {
+			t.Errorf("keys that are not identifiers should be referenced with index:\n%s", content)
+		}
+
+		want, err := yaml.Marshal(obj.Object)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var wantObject map[string]interface{}
+		if err := yaml.Unmarshal(want, &wantObject); err != nil {
+			t.Fatal(err)
+		}
+		if rendered := renderChartTemplate(t, string(content), values); !reflect.DeepEqual(rendered, wantObject) {
+			t.Errorf("%s renders to\n%v\nwant\n%v", resourceType, rendered, wantObject)
+		}
+	}
+}
+
+func TestWriteHelmChart_SeveralNamespaces(t *testing.T) {
+	tmpDir := t.TempDir()
+	templatesDir := filepath.Join(tmpDir, ChartTemplatesDir)
+	for _, namespace := range []string{"blue", "green"} {
+		obj := &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "apps/v1",
+			"kind":       "Deployment",
+			"metadata":   map[string]interface{}{"name": "web", "namespace": namespace},
+			"spec":       map[string]interface{}{"replicas": int64(1)},
+		}}
+		if err := WriteManifest(obj, GenerateFilePath(templatesDir, namespace, "deployments", "web")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := WriteHelmChart(tmpDir, helm.ChartMetadata{Name: "web"}); err != nil {
+		t.Fatalf("WriteHelmChart() error = %v", err)
+	}
+
+	content, err := os.ReadFile(GenerateFilePath(templatesDir, "green", "deployments", "web"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(content), "replicas: {{ .Values.green.deployments.web.replicas }}") {
+		t.Errorf("values should be keyed by namespace first:\n%s", content)
+	}
+}
+
+func TestWriteHelmChart_MissingTemplates(t *testing.T) {
+	if err := WriteHelmChart(filepath.Join(t.TempDir(), "missing"), helm.ChartMetadata{Name: "web"}); err == nil {
+		t.Error("WriteHelmChart() expected error for a missing templates directory")
+	}
+}
+
+func TestSplitImage(t *testing.T) {
+	tests := []struct {
+		image, repository, tag string
+	}{
+		{"nginx", "nginx", ""},
+		{"nginx:1.25", "nginx", "1.25"},
+		{"localhost:5000/nginx", "localhost:5000/nginx", ""},
+		{"localhost:5000/nginx:1.25", "localhost:5000/nginx", "1.25"},
+		{"nginx@sha256:abc", "nginx@sha256:abc", ""},
+	}
+	for _, tt := range tests {
+		repository, tag := splitImage(tt.image)
+		if repository != tt.repository || tag != tt.tag {
+			t.Errorf("splitImage(%q) = %q, %q, want %q, %q", tt.image, repository, tag, tt.repository, tt.tag)
+		}
+	}
+}
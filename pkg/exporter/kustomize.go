@@ -0,0 +1,281 @@
+package exporter
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/yaml"
+)
+
+// KustomizationFile is the file name Kustomize looks for in a directory
+const KustomizationFile = "kustomization.yaml"
+
+// kustomization is the subset of a Kustomization written for exports
+type kustomization struct {
+	APIVersion string           `json:"apiVersion"`
+	Kind       string           `json:"kind"`
+	Namespace  string           `json:"namespace,omitempty"`
+	Resources  []string         `json:"resources,omitempty"`
+	Patches    []kustomizePatch `json:"patches,omitempty"`
+}
+
+// kustomizePatch references a patch file and the object it applies to
+type kustomizePatch struct {
+	Path   string          `json:"path"`
+	Target kustomizeTarget `json:"target"`
+}
+
+// kustomizeTarget selects the object a patch applies to
+type kustomizeTarget struct {
+	Group     string `json:"group,omitempty"`
+	Version   string `json:"version"`
+	Kind      string `json:"kind"`
+	Name      string `json:"name"`
+	Namespace string `json:"namespace,omitempty"`
+}
+
+// PatchOperation is a JSON6902 patch operation
+type PatchOperation struct {
+	Op    string      `json:"op"`
+	Path  string      `json:"path"`
+	Value interface{} `json:"value"`
+}
+
+// MarshalJSON leaves out the value of remove operations only, so that add and replace keep
+// a null value, which JSON6902 requires to be present
+func (o PatchOperation) MarshalJSON() ([]byte, error) {
+	if o.Op == "remove" {
+		return json.Marshal(struct {
+			Op   string `json:"op"`
+			Path string `json:"path"`
+		}{o.Op, o.Path})
+	}
+	type operation PatchOperation
+	return json.Marshal(operation(o))
+}
+
+// WriteKustomizations writes a kustomization.yaml into every namespace directory of an export
+// tree, listing the exported resources, and one at the top level listing the namespaces.
+func WriteKustomizations(baseDir string) error {
+	manifests, err := LoadExport(baseDir)
+	if err != nil {
+		return err
+	}
+
+	byNamespace := make(map[string][]string)
+	for key := range manifests {
+		byNamespace[key.Namespace] = append(byNamespace[key.Namespace], key.ResourceType+"/"+key.Name+".yaml")
+	}
+
+	var namespaces []string
+	for namespace, resources := range byNamespace {
+		sort.Strings(resources)
+		k := newKustomization()
+		k.Namespace = namespace
+		k.Resources = resources
+		if err := writeKustomization(filepath.Join(baseDir, namespace), k); err != nil {
+			return err
+		}
+		namespaces = append(namespaces, namespace)
+	}
+
+	sort.Strings(namespaces)
+	root := newKustomization()
+	root.Resources = namespaces
+	return writeKustomization(baseDir, root)
+}
+
+// WriteOverlays turns the export trees of several contexts into a shared Kustomize base and
+// one overlay per context. The base holds the objects exported from every context, as found in
+// the first one; each overlay adds the objects only its context has and JSON6902 patches for the
+// fields that differ from the base.
+func WriteOverlays(outputDir string, contexts []string, trees []map[ManifestKey]*unstructured.Unstructured) error {
+	if len(contexts) != len(trees) || len(trees) < 2 {
+		return fmt.Errorf("overlays need the exports of at least two contexts")
+	}
+
+	// Objects exported from every context make up the base
+	var shared []ManifestKey
+	for _, key := range sortedKeys(trees[0]) {
+		inAll := true
+		for _, tree := range trees[1:] {
+			if _, ok := tree[key]; !ok {
+				inAll = false
+				break
+			}
+		}
+		if inAll {
+			shared = append(shared, key)
+		}
+	}
+
+	baseDir := filepath.Join(outputDir, "base")
+	base := newKustomization()
+	for _, key := range shared {
+		if err := WriteManifest(trees[0][key], filepath.Join(baseDir, manifestPath(key))); err != nil {
+			return err
+		}
+		base.Resources = append(base.Resources, manifestPath(key))
+	}
+	if err := writeKustomization(baseDir, base); err != nil {
+		return err
+	}
+
+	isShared := make(map[ManifestKey]bool, len(shared))
+	for _, key := range shared {
+		isShared[key] = true
+	}
+
+	for i, contextName := range contexts {
+		overlayDir := filepath.Join(outputDir, "overlays", contextName)
+		overlay := newKustomization()
+		overlay.Resources = []string{"../../base"}
+
+		for _, key := range sortedKeys(trees[i]) {
+			obj := trees[i][key]
+			if !isShared[key] {
+				path := filepath.ToSlash(filepath.Join("resources", manifestPath(key)))
+				if err := WriteManifest(obj, filepath.Join(overlayDir, path)); err != nil {
+					return err
+				}
+				overlay.Resources = append(overlay.Resources, path)
+				continue
+			}
+
+			ops := DiffJSONPatch(trees[0][key].Object, obj.Object)
+			if len(ops) == 0 {
+				continue
+			}
+			data, err := yaml.Marshal(ops)
+			if err != nil {
+				return fmt.Errorf("failed to marshal patch for %s: %w", key, err)
+			}
+			path := filepath.ToSlash(filepath.Join("patches", key.Namespace+"-"+key.ResourceType+"-"+key.Name+".yaml"))
+			if err := writeFile(filepath.Join(overlayDir, path), data); err != nil {
+				return err
+			}
+			overlay.Patches = append(overlay.Patches, kustomizePatch{Path: path, Target: patchTarget(trees[0][key])})
+		}
+
+		if err := writeKustomization(overlayDir, overlay); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// DiffJSONPatch returns the JSON6902 operations that turn from into to
+// Maps are compared key by key and lists of equal length element by element; lists whose length
+// changed are replaced as a whole, since removing elements by index is fragile.
+func DiffJSONPatch(from, to map[string]interface{}) []PatchOperation {
+	var ops []PatchOperation
+	diffValue("", from, to, &ops)
+	return ops
+}
+
+// diffValue appends the operations that turn from into to at path
+func diffValue(path string, from, to interface{}, ops *[]PatchOperation) {
+	if reflect.DeepEqual(from, to) {
+		return
+	}
+
+	switch fromValue := from.(type) {
+	case map[string]interface{}:
+		toValue, ok := to.(map[string]interface{})
+		if !ok {
+			break
+		}
+		keys := make([]string, 0, len(fromValue)+len(toValue))
+		for key := range fromValue {
+			keys = append(keys, key)
+		}
+		for key := range toValue {
+			if _, ok := fromValue[key]; !ok {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			childPath := path + "/" + escapePointer(key)
+			fromChild, inFrom := fromValue[key]
+			toChild, inTo := toValue[key]
+			switch {
+			case !inTo:
+				*ops = append(*ops, PatchOperation{Op: "remove", Path: childPath})
+			case !inFrom:
+				*ops = append(*ops, PatchOperation{Op: "add", Path: childPath, Value: toChild})
+			default:
+				diffValue(childPath, fromChild, toChild, ops)
+			}
+		}
+		return
+	case []interface{}:
+		toValue, ok := to.([]interface{})
+		if !ok || len(toValue) != len(fromValue) {
+			break
+		}
+		for i := range fromValue {
+			diffValue(path+"/"+strconv.Itoa(i), fromValue[i], toValue[i], ops)
+		}
+		return
+	}
+
+	*ops = append(*ops, PatchOperation{Op: "replace", Path: path, Value: to})
+}
+
+// escapePointer escapes a key for use in a JSON pointer
+func escapePointer(key string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(key, "~", "~0"), "/", "~1")
+}
+
+// patchTarget returns the Kustomize target selecting an object
+func patchTarget(obj *unstructured.Unstructured) kustomizeTarget {
+	gv, _ := schema.ParseGroupVersion(obj.GetAPIVersion())
+	return kustomizeTarget{
+		Group:     gv.Group,
+		Version:   gv.Version,
+		Kind:      obj.GetKind(),
+		Name:      obj.GetName(),
+		Namespace: obj.GetNamespace(),
+	}
+}
+
+// manifestPath returns the path of a manifest relative to the root of an export tree
+func manifestPath(key ManifestKey) string {
+	return key.Namespace + "/" + key.ResourceType + "/" + key.Name + ".yaml"
+}
+
+// newKustomization returns an empty Kustomization
+func newKustomization() kustomization {
+	return kustomization{APIVersion: "kustomize.config.k8s.io/v1beta1", Kind: "Kustomization"}
+}
+
+// writeKustomization writes a kustomization.yaml into dir
+func writeKustomization(dir string, k kustomization) error {
+	data, err := yaml.Marshal(k)
+	if err != nil {
+		return fmt.Errorf("failed to marshal kustomization: %w", err)
+	}
+	return writeFile(filepath.Join(dir, KustomizationFile), data)
+}
+
+// writeFile writes data to path, creating its directory
+func writeFile(path string, data []byte) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create directory %s: %w", dir, err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write file %s: %w", path, err)
+	}
+	return nil
+}
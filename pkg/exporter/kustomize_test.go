@@ -0,0 +1,165 @@
+package exporter
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/yaml"
+)
+
+func TestWriteKustomizations(t *testing.T) {
+	tmpDir := t.TempDir()
+	for _, obj := range []*unstructured.Unstructured{
+		configMap("payments", "app", nil),
+		configMap("payments", "db", nil),
+		configMap("monitoring", "grafana", nil),
+	} {
+		if err := WriteManifest(obj, GenerateFilePath(tmpDir, obj.GetNamespace(), "configmaps", obj.GetName())); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := WriteKustomizations(tmpDir); err != nil {
+		t.Fatalf("WriteKustomizations() error = %v", err)
+	}
+
+	tests := map[string]string{
+		filepath.Join(tmpDir, "payments", KustomizationFile):   "namespace: payments\nresources:\n- configmaps/app.yaml\n- configmaps/db.yaml\n",
+		filepath.Join(tmpDir, "monitoring", KustomizationFile): "namespace: monitoring\nresources:\n- configmaps/grafana.yaml\n",
+		filepath.Join(tmpDir, KustomizationFile):               "resources:\n- monitoring\n- payments\n",
+	}
+	for path, want := range tests {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Errorf("%s not written: %v", path, err)
+			continue
+		}
+		if !strings.HasSuffix(string(data), "kind: Kustomization\n"+want) {
+			t.Errorf("%s =\n%s\nwant suffix\n%s", path, data, want)
+		}
+	}
+
+	// The kustomization files are not picked up as manifests
+	manifests, err := LoadExport(tmpDir)
+	if err != nil {
+		t.Fatalf("LoadExport() error = %v", err)
+	}
+	if len(manifests) != 3 {
+		t.Errorf("LoadExport() returned %d manifests, want 3", len(manifests))
+	}
+}
+
+func TestWriteOverlays(t *testing.T) {
+	key := func(name string) ManifestKey {
+		return ManifestKey{Namespace: "default", ResourceType: "configmaps", Name: name}
+	}
+	staging := map[ManifestKey]*unstructured.Unstructured{
+		key("app"):     configMap("default", "app", map[string]interface{}{"mode": "staging", "debug": "true"}),
+		key("shared"):  configMap("default", "shared", map[string]interface{}{"region": "eu"}),
+		key("preview"): configMap("default", "preview", nil),
+	}
+	prod := map[ManifestKey]*unstructured.Unstructured{
+		key("app"):    configMap("default", "app", map[string]interface{}{"mode": "prod", "replicas": "3"}),
+		key("shared"): configMap("default", "shared", map[string]interface{}{"region": "eu"}),
+	}
+
+	tmpDir := t.TempDir()
+	if err := WriteOverlays(tmpDir, []string{"staging", "prod"}, []map[ManifestKey]*unstructured.Unstructured{staging, prod}); err != nil {
+		t.Fatalf("WriteOverlays() error = %v", err)
+	}
+
+	base, err := LoadExport(filepath.Join(tmpDir, "base"))
+	if err != nil {
+		t.Fatalf("LoadExport(base) error = %v", err)
+	}
+	if len(base) != 2 || base[key("app")] == nil || base[key("shared")] == nil {
+		t.Errorf("base = %v, want app and shared", sortedKeys(base))
+	}
+
+	if _, err := os.Stat(filepath.Join(tmpDir, "overlays", "staging", "resources", "default", "configmaps", "preview.yaml")); err != nil {
+		t.Errorf("preview should be added by the staging overlay: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, "overlays", "prod", "patches", "default-configmaps-shared.yaml")); !os.IsNotExist(err) {
+		t.Error("identical objects should not be patched")
+	}
+
+	patch, err := os.ReadFile(filepath.Join(tmpDir, "overlays", "prod", "patches", "default-configmaps-app.yaml"))
+	if err != nil {
+		t.Fatalf("patch not written: %v", err)
+	}
+	want := "- op: remove\n  path: /data/debug\n- op: replace\n  path: /data/mode\n  value: prod\n- op: add\n  path: /data/replicas\n  value: \"3\"\n"
+	if string(patch) != want {
+		t.Errorf("patch =\n%s\nwant\n%s", patch, want)
+	}
+
+	overlay, err := os.ReadFile(filepath.Join(tmpDir, "overlays", "prod", KustomizationFile))
+	if err != nil {
+		t.Fatalf("overlay kustomization not written: %v", err)
+	}
+	for _, want := range []string{"- ../../base", "path: patches/default-configmaps-app.yaml", "kind: ConfigMap", "name: app", "version: v1"} {
+		if !strings.Contains(string(overlay), want) {
+			t.Errorf("overlay kustomization missing %q:\n%s", want, overlay)
+		}
+	}
+
+	if err := WriteOverlays(tmpDir, []string{"staging"}, []map[ManifestKey]*unstructured.Unstructured{staging}); err == nil {
+		t.Error("WriteOverlays() expected error for a single context")
+	}
+}
+
+func TestDiffJSONPatch(t *testing.T) {
+	from := map[string]interface{}{
+		"metadata": map[string]interface{}{"labels": map[string]interface{}{"app/tier": "web"}},
+		"spec": map[string]interface{}{
+			"ports": []interface{}{"80"},
+			"hosts": []interface{}{"a", "b"},
+		},
+	}
+	to := map[string]interface{}{
+		"metadata": map[string]interface{}{"labels": map[string]interface{}{"app/tier": "api"}},
+		"spec": map[string]interface{}{
+			"ports": []interface{}{"80", "443"},
+			"hosts": []interface{}{"a", "c"},
+		},
+	}
+
+	want := []PatchOperation{
+		{Op: "replace", Path: "/metadata/labels/app~1tier", Value: "api"},
+		{Op: "replace", Path: "/spec/hosts/1", Value: "c"},
+		{Op: "replace", Path: "/spec/ports", Value: []interface{}{"80", "443"}},
+	}
+	if got := DiffJSONPatch(from, to); !reflect.DeepEqual(got, want) {
+		t.Errorf("DiffJSONPatch() = %+v, want %+v", got, want)
+	}
+	if got := DiffJSONPatch(from, from); len(got) != 0 {
+		t.Errorf("DiffJSONPatch() of equal objects = %+v, want none", got)
+	}
+}
+
+func TestPatchOperation_NullValue(t *testing.T) {
+	ops := DiffJSONPatch(
+		map[string]interface{}{"spec": map[string]interface{}{"selector": map[string]interface{}{"app": "web"}}},
+		map[string]interface{}{"spec": map[string]interface{}{"selector": nil, "paused": nil}},
+	)
+
+	data, err := yaml.Marshal(ops)
+	if err != nil {
+		t.Fatalf("yaml.Marshal() error = %v", err)
+	}
+	want := "- op: add\n  path: /spec/paused\n  value: null\n- op: replace\n  path: /spec/selector\n  value: null\n"
+	if string(data) != want {
+		t.Errorf("patch =\n%s\nwant\n%s", data, want)
+	}
+
+	data, err = yaml.Marshal([]PatchOperation{{Op: "remove", Path: "/data/debug"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "- op: remove\n  path: /data/debug\n"; string(data) != want {
+		t.Errorf("remove patch =\n%s\nwant\n%s", data, want)
+	}
+}
@@ -0,0 +1,201 @@
+package exporter
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/yaml"
+)
+
+// RewriteRule replaces a regular expression in the string fields of a manifest
+type RewriteRule struct {
+	Kinds []string `json:"kinds,omitempty"` // kinds the rule applies to (default: all)
+	Path  string   `json:"path,omitempty"`  // dotted field path the rule is limited to (default: the whole object)
+	From  string   `json:"from"`            // regular expression to replace
+	To    string   `json:"to"`              // replacement, may reference groups as $1
+
+	pattern *regexp.Regexp
+}
+
+// Rewriter rewrites cleaned manifests, e.g. to clone an environment under other names
+type Rewriter struct {
+	Namespaces map[string]string // namespace mapping, old to new
+	RewriteDNS bool              // also rewrite <service>.<namespace>.svc names in ConfigMaps
+	Rules      []RewriteRule
+}
+
+// LoadRewriteRules reads a YAML list of rewrite rules
+func LoadRewriteRules(path string) ([]RewriteRule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rewrite rules: %w", err)
+	}
+
+	var rules []RewriteRule
+	if err := yaml.UnmarshalStrict(data, &rules); err != nil {
+		return nil, fmt.Errorf("failed to parse rewrite rules %s: %w", path, err)
+	}
+	if err := CompileRewriteRules(rules); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// CompileRewriteRules validates rewrite rules and compiles their expressions
+func CompileRewriteRules(rules []RewriteRule) error {
+	for i := range rules {
+		rule := &rules[i]
+		if rule.From == "" {
+			return fmt.Errorf("rewrite rule %d: from is required", i+1)
+		}
+		if rule.Path != "" {
+			if err := ValidatePaths([]string{rule.Path}); err != nil {
+				return fmt.Errorf("rewrite rule %d: %w", i+1, err)
+			}
+		}
+		pattern, err := regexp.Compile(rule.From)
+		if err != nil {
+			return fmt.Errorf("rewrite rule %d: invalid expression %q: %w", i+1, rule.From, err)
+		}
+		rule.pattern = pattern
+	}
+	return nil
+}
+
+// IsEmpty reports whether the rewriter changes nothing
+func (r *Rewriter) IsEmpty() bool {
+	return r == nil || (len(r.Namespaces) == 0 && len(r.Rules) == 0)
+}
+
+// MapNamespace returns the new name of a namespace
+func (r *Rewriter) MapNamespace(namespace string) string {
+	if r != nil {
+		if mapped, ok := r.Namespaces[namespace]; ok {
+			return mapped
+		}
+	}
+	return namespace
+}
+
+// Rewrite returns a rewritten copy of a manifest
+// Namespaces are mapped in metadata.namespace and in the subjects of (Cluster)RoleBindings,
+// and in ConfigMap service DNS names when enabled; the rules are applied afterwards.
+func (r *Rewriter) Rewrite(obj *unstructured.Unstructured) *unstructured.Unstructured {
+	if r.IsEmpty() {
+		return obj
+	}
+	rewritten := obj.DeepCopy()
+
+	if namespace := rewritten.GetNamespace(); namespace != "" {
+		rewritten.SetNamespace(r.MapNamespace(namespace))
+	}
+
+	switch rewritten.GetKind() {
+	case "RoleBinding", "ClusterRoleBinding":
+		r.rewriteSubjects(rewritten)
+	case "ConfigMap":
+		if r.RewriteDNS {
+			r.rewriteServiceDNS(rewritten)
+		}
+	}
+
+	for _, rule := range r.Rules {
+		if len(rule.Kinds) > 0 && !containsString(rule.Kinds, rewritten.GetKind()) {
+			continue
+		}
+		var segments []string
+		if rule.Path != "" {
+			segments = strings.Split(rule.Path, ".")
+		}
+		rewriteStrings(rewritten.Object, segments, func(s string) string {
+			return rule.pattern.ReplaceAllString(s, rule.To)
+		})
+	}
+
+	return rewritten
+}
+
+// rewriteSubjects maps the namespaces of ServiceAccount subjects
+func (r *Rewriter) rewriteSubjects(obj *unstructured.Unstructured) {
+	subjects, found, _ := unstructured.NestedSlice(obj.Object, "subjects")
+	if !found {
+		return
+	}
+	for _, subject := range subjects {
+		if fields, ok := subject.(map[string]interface{}); ok {
+			if namespace, ok := fields["namespace"].(string); ok {
+				fields["namespace"] = r.MapNamespace(namespace)
+			}
+		}
+	}
+	_ = unstructured.SetNestedSlice(obj.Object, subjects, "subjects")
+}
+
+// serviceDNSPattern matches the namespace part of a service DNS name
+var serviceDNSPattern = regexp.MustCompile(`\.([a-z0-9-]+)\.svc\b`)
+
+// rewriteServiceDNS maps namespaces in service DNS names such as api.payments-prod.svc.cluster.local
+// Each name is mapped once from its original namespace, so chained or swapped mappings are stable.
+func (r *Rewriter) rewriteServiceDNS(obj *unstructured.Unstructured) {
+	rewriteStrings(obj.Object, []string{"data"}, func(s string) string {
+		return serviceDNSPattern.ReplaceAllStringFunc(s, func(match string) string {
+			namespace := serviceDNSPattern.FindStringSubmatch(match)[1]
+			return "." + r.MapNamespace(namespace) + ".svc"
+		})
+	})
+}
+
+// rewriteStrings applies fn to every string at segments below node, or below it when segments is empty
+// Segments follow RemovePaths: "*" matches every map key or list element, numbers index lists.
+func rewriteStrings(node interface{}, segments []string, fn func(string) string) interface{} {
+	if len(segments) == 0 {
+		switch value := node.(type) {
+		case string:
+			return fn(value)
+		case map[string]interface{}:
+			for key, child := range value {
+				value[key] = rewriteStrings(child, nil, fn)
+			}
+		case []interface{}:
+			for i, child := range value {
+				value[i] = rewriteStrings(child, nil, fn)
+			}
+		}
+		return node
+	}
+
+	segment, rest := segments[0], segments[1:]
+	switch value := node.(type) {
+	case map[string]interface{}:
+		if segment == "*" {
+			for key, child := range value {
+				value[key] = rewriteStrings(child, rest, fn)
+			}
+		} else if child, ok := value[segment]; ok {
+			value[segment] = rewriteStrings(child, rest, fn)
+		}
+	case []interface{}:
+		if segment == "*" {
+			for i, child := range value {
+				value[i] = rewriteStrings(child, rest, fn)
+			}
+		} else if i, err := strconv.Atoi(segment); err == nil && i >= 0 && i < len(value) {
+			value[i] = rewriteStrings(value[i], rest, fn)
+		}
+	}
+	return node
+}
+
+// containsString reports whether list contains s
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
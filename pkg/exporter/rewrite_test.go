@@ -0,0 +1,178 @@
+package exporter
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestRewriter_Namespaces(t *testing.T) {
+	rewriter := &Rewriter{Namespaces: map[string]string{"payments-prod": "payments-staging"}}
+
+	binding := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "rbac.authorization.k8s.io/v1",
+		"kind":       "RoleBinding",
+		"metadata":   map[string]interface{}{"name": "deployer", "namespace": "payments-prod"},
+		"subjects": []interface{}{
+			map[string]interface{}{"kind": "ServiceAccount", "name": "ci", "namespace": "payments-prod"},
+			map[string]interface{}{"kind": "ServiceAccount", "name": "monitor", "namespace": "monitoring"},
+			map[string]interface{}{"kind": "Group", "name": "devs"},
+		},
+	}}
+
+	rewritten := rewriter.Rewrite(binding)
+	if rewritten.GetNamespace() != "payments-staging" {
+		t.Errorf("namespace = %s, want payments-staging", rewritten.GetNamespace())
+	}
+	subjects, _, _ := unstructured.NestedSlice(rewritten.Object, "subjects")
+	for i, want := range []interface{}{"payments-staging", "monitoring", nil} {
+		if got := subjects[i].(map[string]interface{})["namespace"]; got != want {
+			t.Errorf("subject %d namespace = %v, want %v", i, got, want)
+		}
+	}
+
+	// The input is left untouched
+	if binding.GetNamespace() != "payments-prod" {
+		t.Error("Rewrite() modified its input")
+	}
+}
+
+func TestRewriter_ServiceDNS(t *testing.T) {
+	config := configMap("payments-prod", "app", map[string]interface{}{
+		"DATABASE_HOST": "postgres.payments-prod.svc.cluster.local",
+		"CACHE_URL":     "redis://redis.payments-prod.svc:6379",
+		"OTHER":         "api.payments-prod-legacy.svc",
+	})
+
+	withoutDNS := (&Rewriter{Namespaces: map[string]string{"payments-prod": "payments-staging"}}).Rewrite(config)
+	if host, _, _ := unstructured.NestedString(withoutDNS.Object, "data", "DATABASE_HOST"); host != "postgres.payments-prod.svc.cluster.local" {
+		t.Errorf("DNS names should only be rewritten when asked, got %s", host)
+	}
+
+	rewritten := (&Rewriter{Namespaces: map[string]string{"payments-prod": "payments-staging"}, RewriteDNS: true}).Rewrite(config)
+	data, _, _ := unstructured.NestedStringMap(rewritten.Object, "data")
+	want := map[string]string{
+		"DATABASE_HOST": "postgres.payments-staging.svc.cluster.local",
+		"CACHE_URL":     "redis://redis.payments-staging.svc:6379",
+		"OTHER":         "api.payments-prod-legacy.svc",
+	}
+	for key, value := range want {
+		if data[key] != value {
+			t.Errorf("data[%s] = %q, want %q", key, data[key], value)
+		}
+	}
+}
+
+func TestRewriter_ServiceDNSSwapped(t *testing.T) {
+	config := configMap("blue", "app", map[string]interface{}{
+		"UPSTREAMS": "http://api.blue.svc:8080,http://api.green.svc:8080,http://api.red.svc.cluster.local",
+	})
+	rewriter := &Rewriter{Namespaces: map[string]string{"blue": "green", "green": "blue", "red": "blue"}, RewriteDNS: true}
+
+	// Every name is mapped from its original namespace, whatever the order of the mapping
+	want := "http://api.green.svc:8080,http://api.blue.svc:8080,http://api.blue.svc.cluster.local"
+	for i := 0; i < 20; i++ {
+		rewritten := rewriter.Rewrite(config)
+		if got, _, _ := unstructured.NestedString(rewritten.Object, "data", "UPSTREAMS"); got != want {
+			t.Fatalf("UPSTREAMS = %q, want %q", got, want)
+		}
+	}
+}
+
+func TestRewriter_Rules(t *testing.T) {
+	rules := []RewriteRule{
+		{Kinds: []string{"Deployment"}, Path: "spec.template.spec.containers.*.image", From: `^registry\.prod\.example\.com/`, To: "registry.staging.example.com/"},
+		{Path: "metadata.name", From: `-prod$`, To: "-staging"},
+	}
+	if err := CompileRewriteRules(rules); err != nil {
+		t.Fatalf("CompileRewriteRules() error = %v", err)
+	}
+	rewriter := &Rewriter{Rules: rules}
+
+	deployment := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "apps/v1",
+		"kind":       "Deployment",
+		"metadata":   map[string]interface{}{"name": "web-prod", "namespace": "default"},
+		"spec": map[string]interface{}{"template": map[string]interface{}{"spec": map[string]interface{}{
+			"containers": []interface{}{map[string]interface{}{"name": "web", "image": "registry.prod.example.com/web:1.0"}},
+		}}},
+	}}
+	rewritten := rewriter.Rewrite(deployment)
+	if rewritten.GetName() != "web-staging" {
+		t.Errorf("name = %s, want web-staging", rewritten.GetName())
+	}
+	containers, _, _ := unstructured.NestedSlice(rewritten.Object, "spec", "template", "spec", "containers")
+	if image := containers[0].(map[string]interface{})["image"]; image != "registry.staging.example.com/web:1.0" {
+		t.Errorf("image = %v", image)
+	}
+
+	// Kind-restricted rules leave other kinds alone
+	config := configMap("default", "app-prod", map[string]interface{}{"image": "registry.prod.example.com/web:1.0"})
+	rewritten = rewriter.Rewrite(config)
+	if image, _, _ := unstructured.NestedString(rewritten.Object, "data", "image"); image != "registry.prod.example.com/web:1.0" {
+		t.Errorf("configmap image = %s, should be unchanged", image)
+	}
+	if rewritten.GetName() != "app-staging" {
+		t.Errorf("configmap name = %s, want app-staging", rewritten.GetName())
+	}
+}
+
+func TestLoadRewriteRules(t *testing.T) {
+	dir := t.TempDir()
+	valid := filepath.Join(dir, "rules.yaml")
+	if err := os.WriteFile(valid, []byte("- kinds: [Deployment]\n  path: spec.replicas\n  from: \"5\"\n  to: \"1\"\n- from: prod\n  to: staging\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	rules, err := LoadRewriteRules(valid)
+	if err != nil {
+		t.Fatalf("LoadRewriteRules() error = %v", err)
+	}
+	if len(rules) != 2 || rules[0].Path != "spec.replicas" || rules[1].pattern == nil {
+		t.Errorf("LoadRewriteRules() = %+v", rules)
+	}
+
+	tests := map[string]string{
+		"missing from":   "- to: staging\n",
+		"bad expression": "- from: \"(\"\n  to: x\n",
+		"bad path":       "- path: spec..image\n  from: a\n  to: b\n",
+		"unknown field":  "- form: a\n  to: b\n",
+	}
+	for name, content := range tests {
+		path := filepath.Join(dir, strings.ReplaceAll(name, " ", "-")+".yaml")
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := LoadRewriteRules(path); err == nil {
+			t.Errorf("%s: LoadRewriteRules() expected error", name)
+		}
+	}
+
+	if _, err := LoadRewriteRules(filepath.Join(dir, "missing.yaml")); err == nil {
+		t.Error("LoadRewriteRules() expected error for a missing file")
+	}
+}
+
+func TestExporter_ExportResourceWithRewriter(t *testing.T) {
+	tmpDir := t.TempDir()
+	exp := NewExporter(tmpDir)
+	exp.Rewriter = &Rewriter{Namespaces: map[string]string{"payments-prod": "payments-staging"}}
+
+	obj := configMap("payments-prod", "app", map[string]interface{}{"mode": "prod"})
+	gvr := schema.GroupVersionResource{Version: "v1", Resource: "configmaps"}
+	if err := exp.ExportResource(context.Background(), obj, gvr, "payments-prod"); err != nil {
+		t.Fatalf("ExportResource() error = %v", err)
+	}
+
+	data, err := os.ReadFile(GenerateFilePath(tmpDir, "payments-staging", "configmaps", "app"))
+	if err != nil {
+		t.Fatalf("manifest not written under the mapped namespace: %v", err)
+	}
+	if !strings.Contains(string(data), "namespace: payments-staging") {
+		t.Errorf("manifest namespace not rewritten:\n%s", data)
+	}
+}
@@ -3,6 +3,7 @@ package exporter
 import (
 	"context"
 	"fmt"
+	"log/slog"
 	"os"
 	"path/filepath"
 	"sync"
@@ -16,6 +17,9 @@ import (
 type Exporter struct {
 	BaseDir       string
 	ExportedCount int
+	ExportedFiles []string     // paths of the manifests written, in the order they were exported
+	Rewriter      *Rewriter    // applied after CleanManifest when set
+	Logger        *slog.Logger // receives a debug record of each manifest written when set
 	mu            sync.Mutex
 }
 
@@ -77,8 +81,9 @@ func WriteManifest(obj *unstructured.Unstructured, filePath string) error {
 
 // ExportResource exports a single resource to disk
 func (e *Exporter) ExportResource(ctx context.Context, obj *unstructured.Unstructured, gvr schema.GroupVersionResource, namespace string) error {
-	// Clean the manifest
-	cleaned := CleanManifest(obj)
+	// Clean the manifest, then apply namespace mappings and rewrite rules
+	cleaned := e.Rewriter.Rewrite(CleanManifest(obj))
+	namespace = e.Rewriter.MapNamespace(namespace)
 
 	// Get resource name
 	name := cleaned.GetName()
@@ -94,9 +99,14 @@ func (e *Exporter) ExportResource(ctx context.Context, obj *unstructured.Unstruc
 		return err
 	}
 
+	if e.Logger != nil {
+		e.Logger.Debug("wrote manifest", "resource", gvr.Resource, "namespace", namespace, "name", name, "path", filePath)
+	}
+
 	// Increment counter
 	e.mu.Lock()
 	e.ExportedCount++
+	e.ExportedFiles = append(e.ExportedFiles, filePath)
 	e.mu.Unlock()
 
 	return nil
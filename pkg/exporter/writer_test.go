@@ -1,7 +1,9 @@
 package exporter
 
 import (
+	"bytes"
 	"context"
+	"log/slog"
 	"os"
 	"path/filepath"
 	"testing"
@@ -196,6 +198,29 @@ func TestExporter_ExportResource(t *testing.T) {
 	if exporter.ExportedCount != 1 {
 		t.Errorf("ExportResource() ExportedCount = %d, want 1", exporter.ExportedCount)
 	}
+	if len(exporter.ExportedFiles) != 1 || exporter.ExportedFiles[0] != expectedPath {
+		t.Errorf("ExportResource() ExportedFiles = %v, want [%s]", exporter.ExportedFiles, expectedPath)
+	}
+}
+
+func TestExporter_Logger(t *testing.T) {
+	var logs bytes.Buffer
+	exporter := NewExporter(t.TempDir())
+	exporter.Logger = slog.New(slog.NewTextHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	obj := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Pod",
+		"metadata":   map[string]interface{}{"name": "test-pod", "namespace": "default"},
+	}}
+	gvr := schema.GroupVersionResource{Version: "v1", Resource: "pods"}
+	if err := exporter.ExportResource(context.Background(), obj, gvr, "default"); err != nil {
+		t.Fatalf("ExportResource() error = %v", err)
+	}
+
+	if !contains(logs.String(), `msg="wrote manifest" resource=pods namespace=default name=test-pod`) {
+		t.Errorf("ExportResource() did not log the manifest written:\n%s", logs.String())
+	}
 }
 
 func TestExporter_Summary(t *testing.T) {
@@ -0,0 +1,134 @@
+package helm
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/davidschrooten/manifold-k8s/pkg/k8s"
+	"sigs.k8s.io/yaml"
+)
+
+// Release artefact parts that can be exported alongside the values
+const (
+	PartManifest = "manifest"
+	PartHooks    = "hooks"
+	PartNotes    = "notes"
+	PartMetadata = "metadata"
+)
+
+// ArtefactParts lists the supported release artefact parts in export order
+var ArtefactParts = []string{PartManifest, PartHooks, PartNotes, PartMetadata}
+
+// artefactFiles maps each artefact part to the file it is written to
+var artefactFiles = map[string]string{
+	PartManifest: "manifest.yaml",
+	PartHooks:    "hooks.yaml",
+	PartNotes:    "NOTES.txt",
+	PartMetadata: "metadata.yaml",
+}
+
+// Hook represents a Helm hook stored with a release
+type Hook struct {
+	Name     string
+	Kind     string
+	Path     string
+	Manifest string
+	Events   []string
+	Weight   int
+}
+
+// ReleaseDetails holds the full contents of a Helm release revision
+type ReleaseDetails struct {
+	Release
+	Description string
+	Notes       string
+	Manifest    string
+	Hooks       []Hook
+	Metadata    ChartMetadata
+	UserValues  map[string]interface{}
+	ChartValues map[string]interface{}
+}
+
+// releaseMetadata is the document written for the metadata part
+type releaseMetadata struct {
+	Name        string        `json:"name"`
+	Namespace   string        `json:"namespace"`
+	Revision    string        `json:"revision"`
+	Status      string        `json:"status"`
+	Updated     string        `json:"updated,omitempty"`
+	Description string        `json:"description,omitempty"`
+	Chart       ChartMetadata `json:"chart"`
+}
+
+// GetRelease retrieves the full contents of the latest revision of a Helm release
+func GetRelease(ctx context.Context, client *k8s.Client, releaseName, namespace string) (*ReleaseDetails, error) {
+	record, err := getLatestRelease(ctx, client, releaseName, namespace)
+	if err != nil {
+		return nil, err
+	}
+	return record.toDetails(), nil
+}
+
+// ValidateParts checks that every requested artefact part is supported
+func ValidateParts(parts []string) error {
+	for _, part := range parts {
+		if _, ok := artefactFiles[part]; !ok {
+			return fmt.Errorf("invalid release part %q (must be one of: %s)", part, strings.Join(ArtefactParts, ", "))
+		}
+	}
+	return nil
+}
+
+// ArtefactFile returns the file name an artefact part is written to
+func ArtefactFile(part string) string {
+	return artefactFiles[part]
+}
+
+// Artefact renders a single artefact part of the release
+// An empty result means the release has nothing to export for that part.
+func (d *ReleaseDetails) Artefact(part string) ([]byte, error) {
+	switch part {
+	case PartManifest:
+		return []byte(d.Manifest), nil
+	case PartHooks:
+		return []byte(d.hooksManifest()), nil
+	case PartNotes:
+		return []byte(d.Notes), nil
+	case PartMetadata:
+		return d.metadata()
+	default:
+		return nil, fmt.Errorf("invalid release part %q", part)
+	}
+}
+
+// hooksManifest joins the hook manifests the way `helm get hooks` prints them
+func (d *ReleaseDetails) hooksManifest() string {
+	var b strings.Builder
+	for _, hook := range d.Hooks {
+		fmt.Fprintf(&b, "---\n# Source: %s\n%s\n", hook.Path, strings.TrimRight(hook.Manifest, "\n"))
+	}
+	return b.String()
+}
+
+// metadata renders the release and chart metadata as YAML
+func (d *ReleaseDetails) metadata() ([]byte, error) {
+	doc := releaseMetadata{
+		Name:        d.Name,
+		Namespace:   d.Namespace,
+		Revision:    d.Revision,
+		Status:      d.Status,
+		Description: d.Description,
+		Chart:       d.Metadata,
+	}
+	if !d.Updated.IsZero() {
+		doc.Updated = d.Updated.UTC().Format(time.RFC3339)
+	}
+
+	data, err := yaml.Marshal(doc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal metadata for %s: %w", d.Name, err)
+	}
+	return data, nil
+}
@@ -0,0 +1,163 @@
+package helm
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fullRelease returns a stored release with a manifest, hooks and notes
+func fullRelease() map[string]interface{} {
+	return map[string]interface{}{
+		"name":      "web",
+		"namespace": "default",
+		"version":   4,
+		"info": map[string]interface{}{
+			"status":        "deployed",
+			"description":   "Upgrade complete",
+			"notes":         "Visit http://web.example.com",
+			"last_deployed": "2024-06-01T10:00:00Z",
+		},
+		"chart": map[string]interface{}{
+			"metadata": map[string]interface{}{
+				"apiVersion":  "v2",
+				"name":        "web",
+				"version":     "1.4.0",
+				"appVersion":  "2.0.0",
+				"description": "A web server",
+			},
+			"values": map[string]interface{}{"replicaCount": 1},
+		},
+		"config":   map[string]interface{}{"replicaCount": 2},
+		"manifest": "---\n# Source: web/templates/service.yaml\napiVersion: v1\nkind: Service\nmetadata:\n  name: web\n",
+		"hooks": []interface{}{
+			map[string]interface{}{
+				"name":     "web-test",
+				"kind":     "Pod",
+				"path":     "web/templates/tests/test-connection.yaml",
+				"manifest": "apiVersion: v1\nkind: Pod\nmetadata:\n  name: web-test\n",
+				"events":   []string{"test"},
+				"weight":   5,
+			},
+		},
+	}
+}
+
+func TestGetRelease(t *testing.T) {
+	client := newFakeClient(
+		releaseSecret(t, "web", "default", "superseded", 3, nil),
+		releaseSecretFor(t, "web", "default", "deployed", 4, fullRelease()),
+	)
+
+	details, err := GetRelease(context.Background(), client, "web", "default")
+	if err != nil {
+		t.Fatalf("GetRelease() error = %v", err)
+	}
+
+	if details.Revision != "4" || details.Chart != "web-1.4.0" {
+		t.Errorf("GetRelease() release = %+v, want revision 4 of web-1.4.0", details.Release)
+	}
+	if details.Description != "Upgrade complete" || details.Notes != "Visit http://web.example.com" {
+		t.Errorf("GetRelease() description = %q, notes = %q", details.Description, details.Notes)
+	}
+	if !strings.Contains(details.Manifest, "kind: Service") {
+		t.Errorf("GetRelease() manifest = %q, want the Service", details.Manifest)
+	}
+	if len(details.Hooks) != 1 || details.Hooks[0].Name != "web-test" || details.Hooks[0].Weight != 5 {
+		t.Errorf("GetRelease() hooks = %+v", details.Hooks)
+	}
+	if details.Metadata.Description != "A web server" || details.Metadata.APIVersion != "v2" {
+		t.Errorf("GetRelease() metadata = %+v", details.Metadata)
+	}
+	if details.UserValues["replicaCount"] != float64(2) || details.ChartValues["replicaCount"] != float64(1) {
+		t.Errorf("GetRelease() user values = %v, chart values = %v", details.UserValues, details.ChartValues)
+	}
+}
+
+func TestGetRelease_NonExistentRelease(t *testing.T) {
+	if _, err := GetRelease(context.Background(), newFakeClient(), "missing", "default"); err == nil {
+		t.Error("GetRelease() should return error for non-existent release")
+	}
+}
+
+func TestReleaseDetails_Artefact(t *testing.T) {
+	details := &ReleaseDetails{
+		Release: Release{
+			Name:      "web",
+			Namespace: "default",
+			Status:    "deployed",
+			Revision:  "4",
+			Updated:   time.Date(2024, 6, 1, 12, 0, 0, 0, time.FixedZone("CEST", 2*60*60)),
+		},
+		Description: "Upgrade complete",
+		Notes:       "Visit http://web.example.com",
+		Manifest:    "kind: Service\n",
+		Hooks: []Hook{
+			{Path: "web/templates/pre-install.yaml", Manifest: "kind: Job\n"},
+			{Path: "web/templates/tests/test.yaml", Manifest: "kind: Pod"},
+		},
+		Metadata: ChartMetadata{Name: "web", Version: "1.4.0", AppVersion: "2.0.0"},
+	}
+
+	tests := []struct {
+		part string
+		want string
+	}{
+		{PartManifest, "kind: Service\n"},
+		{PartHooks, "---\n# Source: web/templates/pre-install.yaml\nkind: Job\n---\n# Source: web/templates/tests/test.yaml\nkind: Pod\n"},
+		{PartNotes, "Visit http://web.example.com"},
+		{PartMetadata, `chart:
+  appVersion: 2.0.0
+  name: web
+  version: 1.4.0
+description: Upgrade complete
+name: web
+namespace: default
+revision: "4"
+status: deployed
+updated: "2024-06-01T10:00:00Z"
+`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.part, func(t *testing.T) {
+			got, err := details.Artefact(tt.part)
+			if err != nil {
+				t.Fatalf("Artefact() error = %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("Artefact(%s) =\n%s\nwant\n%s", tt.part, got, tt.want)
+			}
+		})
+	}
+
+	if _, err := details.Artefact("chart"); err == nil {
+		t.Error("Artefact() expected error for unknown part, got nil")
+	}
+}
+
+func TestReleaseDetails_ArtefactEmpty(t *testing.T) {
+	details := &ReleaseDetails{}
+	for _, part := range []string{PartManifest, PartHooks, PartNotes} {
+		got, err := details.Artefact(part)
+		if err != nil {
+			t.Fatalf("Artefact(%s) error = %v", part, err)
+		}
+		if len(got) != 0 {
+			t.Errorf("Artefact(%s) = %q, want empty", part, got)
+		}
+	}
+}
+
+func TestValidateParts(t *testing.T) {
+	if err := ValidateParts(ArtefactParts); err != nil {
+		t.Errorf("ValidateParts(%v) error = %v", ArtefactParts, err)
+	}
+	if err := ValidateParts(nil); err != nil {
+		t.Errorf("ValidateParts(nil) error = %v", err)
+	}
+	if err := ValidateParts([]string{"manifest", "values"}); err == nil {
+		t.Error("ValidateParts() expected error for unknown part, got nil")
+	}
+}
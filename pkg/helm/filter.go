@@ -0,0 +1,86 @@
+package helm
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+
+	"github.com/Masterminds/semver/v3"
+)
+
+// Filter selects releases by chart name, chart version and release name
+// Empty criteria match every release.
+type Filter struct {
+	chartPattern string
+	versions     *semver.Constraints
+	namePattern  *regexp.Regexp
+}
+
+// NewFilter builds a release filter from a chart name glob (e.g. "ingress-*"), a chart
+// version constraint (e.g. "< 4.0" or ">= 1.2, < 2") and a release name regular expression
+func NewFilter(chartGlob, versionConstraint, nameRegex string) (*Filter, error) {
+	filter := &Filter{chartPattern: chartGlob}
+
+	if chartGlob != "" {
+		if _, err := path.Match(chartGlob, ""); err != nil {
+			return nil, fmt.Errorf("invalid chart pattern %q: %w", chartGlob, err)
+		}
+	}
+
+	if versionConstraint != "" {
+		constraints, err := semver.NewConstraint(versionConstraint)
+		if err != nil {
+			return nil, fmt.Errorf("invalid chart version constraint %q: %w", versionConstraint, err)
+		}
+		filter.versions = constraints
+	}
+
+	if nameRegex != "" {
+		pattern, err := regexp.Compile(nameRegex)
+		if err != nil {
+			return nil, fmt.Errorf("invalid release name pattern %q: %w", nameRegex, err)
+		}
+		filter.namePattern = pattern
+	}
+
+	return filter, nil
+}
+
+// IsEmpty reports whether the filter has no criteria
+func (f *Filter) IsEmpty() bool {
+	return f.chartPattern == "" && f.versions == nil && f.namePattern == nil
+}
+
+// Match reports whether a release meets every criterion of the filter
+// Releases whose chart version is not valid semver never match a version constraint.
+func (f *Filter) Match(release Release) bool {
+	if f.chartPattern != "" {
+		if matched, _ := path.Match(f.chartPattern, release.ChartName); !matched {
+			return false
+		}
+	}
+
+	if f.versions != nil {
+		version, err := semver.NewVersion(release.ChartVersion)
+		if err != nil || !f.versions.Check(version) {
+			return false
+		}
+	}
+
+	if f.namePattern != nil && !f.namePattern.MatchString(release.Name) {
+		return false
+	}
+
+	return true
+}
+
+// FilterReleases returns the releases that match the filter
+func FilterReleases(releases []Release, filter *Filter) []Release {
+	var matched []Release
+	for _, release := range releases {
+		if filter.Match(release) {
+			matched = append(matched, release)
+		}
+	}
+	return matched
+}
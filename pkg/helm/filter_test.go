@@ -0,0 +1,87 @@
+package helm
+
+import (
+	"testing"
+)
+
+func TestFilter_Match(t *testing.T) {
+	releases := map[string]Release{
+		"ingress-old": {Name: "ingress", ChartName: "ingress-nginx", ChartVersion: "3.41.0"},
+		"ingress-new": {Name: "edge", ChartName: "ingress-nginx", ChartVersion: "4.10.1"},
+		"api":         {Name: "payments-api", ChartName: "payments", ChartVersion: "0.1.0-rc.1+build.5"},
+		"unversioned": {Name: "legacy", ChartName: "legacy-chart", ChartVersion: "latest"},
+	}
+
+	tests := []struct {
+		name       string
+		chart      string
+		version    string
+		nameRegex  string
+		wantMatch  []string
+		wantFilter bool
+	}{
+		{name: "no criteria", wantMatch: []string{"ingress-old", "ingress-new", "api", "unversioned"}},
+		{name: "chart glob", chart: "ingress-*", wantMatch: []string{"ingress-old", "ingress-new"}, wantFilter: true},
+		{name: "chart and version", chart: "ingress-nginx", version: "< 4.0", wantMatch: []string{"ingress-old"}, wantFilter: true},
+		{name: "version range", version: ">= 3.0, < 5", wantMatch: []string{"ingress-old", "ingress-new"}, wantFilter: true},
+		{name: "prerelease constraint", version: ">= 0.1.0-0", wantMatch: []string{"ingress-old", "ingress-new", "api"}, wantFilter: true},
+		{name: "release name regex", nameRegex: "^(edge|legacy)$", wantMatch: []string{"ingress-new", "unversioned"}, wantFilter: true},
+		{name: "all criteria", chart: "*", version: "^4", nameRegex: "e", wantMatch: []string{"ingress-new"}, wantFilter: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filter, err := NewFilter(tt.chart, tt.version, tt.nameRegex)
+			if err != nil {
+				t.Fatalf("NewFilter() error = %v", err)
+			}
+			if filter.IsEmpty() == tt.wantFilter {
+				t.Errorf("IsEmpty() = %v, want %v", filter.IsEmpty(), !tt.wantFilter)
+			}
+
+			want := make(map[string]bool)
+			for _, key := range tt.wantMatch {
+				want[key] = true
+			}
+			for key, release := range releases {
+				if got := filter.Match(release); got != want[key] {
+					t.Errorf("Match(%s) = %v, want %v", key, got, want[key])
+				}
+			}
+		})
+	}
+}
+
+func TestNewFilter_Invalid(t *testing.T) {
+	tests := []struct {
+		name      string
+		chart     string
+		version   string
+		nameRegex string
+	}{
+		{name: "bad glob", chart: "ingress-["},
+		{name: "bad constraint", version: "newer than 4"},
+		{name: "bad regex", nameRegex: "api-("},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewFilter(tt.chart, tt.version, tt.nameRegex); err == nil {
+				t.Error("NewFilter() expected error, got nil")
+			}
+		})
+	}
+}
+
+func TestFilterReleases(t *testing.T) {
+	filter, err := NewFilter("web*", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	releases := []Release{{Name: "a", ChartName: "web"}, {Name: "b", ChartName: "api"}, {Name: "c", ChartName: "webhook"}}
+	got := FilterReleases(releases, filter)
+	if len(got) != 2 || got[0].Name != "a" || got[1].Name != "c" {
+		t.Errorf("FilterReleases() = %v, want releases a and c", got)
+	}
+}
@@ -0,0 +1,257 @@
+package helm
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+// GitOps formats that release manifests can be generated for
+const (
+	GitOpsArgoCD = "argocd"
+	GitOpsFlux   = "flux"
+)
+
+// GitOps values modes control how release values end up in the generated manifests
+const (
+	// GitOpsValuesInline embeds the values in the Application or HelmRelease
+	GitOpsValuesInline = "inline"
+	// GitOpsValuesRef references the exported values file (Argo CD) or a values ConfigMap (Flux)
+	GitOpsValuesRef = "ref"
+)
+
+// PlaceholderRepoURL is used for charts without a known repository, since Helm does not
+// record where a chart was installed from
+const PlaceholderRepoURL = "https://charts.example.com/REPLACE-ME"
+
+const (
+	argoCDNamespace     = "argocd"
+	argoCDInClusterURL  = "https://kubernetes.default.svc"
+	fluxSystemNamespace = "flux-system"
+	fluxInterval        = "10m"
+	fluxRepoInterval    = "1h"
+)
+
+// unsafeNameChars matches characters that are not allowed in a Kubernetes object name
+var unsafeNameChars = regexp.MustCompile(`[^a-z0-9]+`)
+
+// GitOpsOptions configures GitOps manifest generation
+type GitOpsOptions struct {
+	Format     string
+	ValuesMode string
+	ChartRepos map[string]string // chart name to repository URL
+	GitRepo    string            // git repository holding the exported values, for Argo CD refs
+}
+
+// GitOpsSource is a release to generate GitOps manifests for
+type GitOpsSource struct {
+	Release    Release
+	Values     string // values YAML
+	ValuesPath string // path of the values file relative to the git repository root
+}
+
+// Validate checks the GitOps options
+func (o GitOpsOptions) Validate() error {
+	if o.Format != GitOpsArgoCD && o.Format != GitOpsFlux {
+		return fmt.Errorf("invalid GitOps format %q (must be %s or %s)", o.Format, GitOpsArgoCD, GitOpsFlux)
+	}
+	if o.ValuesMode != GitOpsValuesInline && o.ValuesMode != GitOpsValuesRef {
+		return fmt.Errorf("invalid GitOps values mode %q (must be %s or %s)", o.ValuesMode, GitOpsValuesInline, GitOpsValuesRef)
+	}
+	if o.Format == GitOpsArgoCD && o.ValuesMode == GitOpsValuesRef && o.GitRepo == "" {
+		return fmt.Errorf("referencing values from Argo CD requires the git repository URL of the export")
+	}
+	return nil
+}
+
+// RepoURL returns the repository URL for a chart, or the placeholder when it is unknown
+func (o GitOpsOptions) RepoURL(chart string) (string, bool) {
+	return ChartRepoURL(o.ChartRepos, chart)
+}
+
+// ChartRepoURL looks up the repository URL of a chart, or returns the placeholder when it is unknown
+func ChartRepoURL(chartRepos map[string]string, chart string) (string, bool) {
+	url, ok := chartRepos[chart]
+	if !ok || url == "" {
+		return PlaceholderRepoURL, false
+	}
+	return url, true
+}
+
+// GenerateGitOps generates the GitOps manifests for a release, keyed by file name
+func GenerateGitOps(source GitOpsSource, opts GitOpsOptions) (map[string][]byte, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+
+	values := map[string]interface{}{}
+	if err := yaml.Unmarshal([]byte(source.Values), &values); err != nil {
+		return nil, fmt.Errorf("failed to parse values for %s: %w", source.Release.Name, err)
+	}
+
+	var objects map[string]interface{}
+	if opts.Format == GitOpsArgoCD {
+		objects = map[string]interface{}{"application.yaml": argoCDApplication(source, values, opts)}
+	} else {
+		objects = fluxObjects(source, values, opts)
+	}
+
+	files := make(map[string][]byte, len(objects))
+	for name, object := range objects {
+		data, err := yaml.Marshal(object)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal %s for %s: %w", name, source.Release.Name, err)
+		}
+		files[name] = data
+	}
+	return files, nil
+}
+
+// argoCDApplication builds an Argo CD Application deploying the release's chart
+func argoCDApplication(source GitOpsSource, values map[string]interface{}, opts GitOpsOptions) map[string]interface{} {
+	release := source.Release
+	repoURL, _ := opts.RepoURL(release.ChartName)
+
+	helmSpec := map[string]interface{}{"releaseName": release.Name}
+	chartSource := map[string]interface{}{
+		// Argo CD expects OCI registries without the scheme
+		"repoURL":        strings.TrimPrefix(repoURL, "oci://"),
+		"chart":          release.ChartName,
+		"targetRevision": release.ChartVersion,
+		"helm":           helmSpec,
+	}
+
+	spec := map[string]interface{}{
+		"project": "default",
+		"destination": map[string]interface{}{
+			"server":    argoCDInClusterURL,
+			"namespace": release.Namespace,
+		},
+	}
+
+	if opts.ValuesMode == GitOpsValuesRef {
+		// Multiple sources let the chart read its values file from the export repository
+		helmSpec["valueFiles"] = []string{path.Join("$values", source.ValuesPath)}
+		spec["sources"] = []interface{}{
+			chartSource,
+			map[string]interface{}{
+				"repoURL":        opts.GitRepo,
+				"targetRevision": "HEAD",
+				"ref":            "values",
+			},
+		}
+	} else {
+		if len(values) > 0 {
+			helmSpec["valuesObject"] = values
+		}
+		spec["source"] = chartSource
+	}
+
+	return map[string]interface{}{
+		"apiVersion": "argoproj.io/v1alpha1",
+		"kind":       "Application",
+		"metadata": map[string]interface{}{
+			"name":      objectName(release.Namespace + "-" + release.Name),
+			"namespace": argoCDNamespace,
+		},
+		"spec": spec,
+	}
+}
+
+// fluxObjects builds a Flux HelmRelease and HelmRepository, plus a values ConfigMap when
+// values are referenced
+func fluxObjects(source GitOpsSource, values map[string]interface{}, opts GitOpsOptions) map[string]interface{} {
+	release := source.Release
+	repoURL, _ := opts.RepoURL(release.ChartName)
+	repoName := repositoryName(repoURL)
+
+	repoSpec := map[string]interface{}{
+		"interval": fluxRepoInterval,
+		"url":      repoURL,
+	}
+	if strings.HasPrefix(repoURL, "oci://") {
+		repoSpec["type"] = "oci"
+	}
+
+	spec := map[string]interface{}{
+		"interval":    fluxInterval,
+		"releaseName": release.Name,
+		"chart": map[string]interface{}{
+			"spec": map[string]interface{}{
+				"chart":   release.ChartName,
+				"version": release.ChartVersion,
+				"sourceRef": map[string]interface{}{
+					"kind":      "HelmRepository",
+					"name":      repoName,
+					"namespace": fluxSystemNamespace,
+				},
+			},
+		},
+	}
+
+	objects := map[string]interface{}{
+		"helmrepository.yaml": map[string]interface{}{
+			"apiVersion": "source.toolkit.fluxcd.io/v1",
+			"kind":       "HelmRepository",
+			"metadata": map[string]interface{}{
+				"name":      repoName,
+				"namespace": fluxSystemNamespace,
+			},
+			"spec": repoSpec,
+		},
+	}
+
+	if opts.ValuesMode == GitOpsValuesRef {
+		configMapName := objectName(release.Name + "-values")
+		spec["valuesFrom"] = []interface{}{
+			map[string]interface{}{
+				"kind":      "ConfigMap",
+				"name":      configMapName,
+				"valuesKey": "values.yaml",
+			},
+		}
+		objects["values-configmap.yaml"] = map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "ConfigMap",
+			"metadata": map[string]interface{}{
+				"name":      configMapName,
+				"namespace": release.Namespace,
+			},
+			"data": map[string]interface{}{"values.yaml": source.Values},
+		}
+	} else if len(values) > 0 {
+		spec["values"] = values
+	}
+
+	objects["helmrelease.yaml"] = map[string]interface{}{
+		"apiVersion": "helm.toolkit.fluxcd.io/v2",
+		"kind":       "HelmRelease",
+		"metadata": map[string]interface{}{
+			"name":      release.Name,
+			"namespace": release.Namespace,
+		},
+		"spec": spec,
+	}
+
+	return objects
+}
+
+// repositoryName derives a HelmRepository name from its URL, without the scheme
+func repositoryName(url string) string {
+	if i := strings.Index(url, "://"); i >= 0 {
+		url = url[i+3:]
+	}
+	return objectName(url)
+}
+
+// objectName turns an arbitrary string into a valid Kubernetes object name
+func objectName(s string) string {
+	name := strings.Trim(unsafeNameChars.ReplaceAllString(strings.ToLower(s), "-"), "-")
+	if len(name) > 63 {
+		name = strings.TrimRight(name[:63], "-")
+	}
+	return name
+}
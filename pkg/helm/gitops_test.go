@@ -0,0 +1,228 @@
+package helm
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"sigs.k8s.io/yaml"
+)
+
+// gitOpsSource returns a release with user values for GitOps generation
+func gitOpsSource() GitOpsSource {
+	return GitOpsSource{
+		Release: Release{
+			Name:         "ingress",
+			Namespace:    "ingress-system",
+			ChartName:    "ingress-nginx",
+			ChartVersion: "4.10.1",
+		},
+		Values:     "controller:\n  replicaCount: 2\n",
+		ValuesPath: "prod/ingress-system/ingress-values.yaml",
+	}
+}
+
+// parseObject unmarshals a generated manifest for assertions
+func parseObject(t *testing.T, data []byte) map[string]interface{} {
+	t.Helper()
+	object := map[string]interface{}{}
+	if err := yaml.Unmarshal(data, &object); err != nil {
+		t.Fatalf("generated manifest is not valid YAML: %v\n%s", err, data)
+	}
+	return object
+}
+
+// field reads a nested field from a parsed manifest
+func field(object map[string]interface{}, path ...string) interface{} {
+	var current interface{} = object
+	for _, key := range path {
+		m, ok := current.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		current = m[key]
+	}
+	return current
+}
+
+func TestGenerateGitOps_ArgoCDInline(t *testing.T) {
+	opts := GitOpsOptions{
+		Format:     GitOpsArgoCD,
+		ValuesMode: GitOpsValuesInline,
+		ChartRepos: map[string]string{"ingress-nginx": "https://kubernetes.github.io/ingress-nginx"},
+	}
+
+	files, err := GenerateGitOps(gitOpsSource(), opts)
+	if err != nil {
+		t.Fatalf("GenerateGitOps() error = %v", err)
+	}
+	if len(files) != 1 {
+		t.Fatalf("GenerateGitOps() files = %v, want application.yaml only", files)
+	}
+
+	app := parseObject(t, files["application.yaml"])
+	checks := map[string]interface{}{
+		"kind":                          "Application",
+		"metadata.name":                 "ingress-system-ingress",
+		"metadata.namespace":            "argocd",
+		"spec.source.repoURL":           "https://kubernetes.github.io/ingress-nginx",
+		"spec.source.chart":             "ingress-nginx",
+		"spec.source.targetRevision":    "4.10.1",
+		"spec.source.helm.releaseName":  "ingress",
+		"spec.destination.namespace":    "ingress-system",
+		"spec.destination.server":       "https://kubernetes.default.svc",
+		"spec.source.helm.valuesObject": map[string]interface{}{"controller": map[string]interface{}{"replicaCount": float64(2)}},
+		"spec.sources":                  nil,
+		"spec.source.helm.valueFiles":   nil,
+		"spec.project":                  "default",
+		"apiVersion":                    "argoproj.io/v1alpha1",
+	}
+	for path, want := range checks {
+		if got := field(app, strings.Split(path, ".")...); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s = %v, want %v", path, got, want)
+		}
+	}
+}
+
+func TestGenerateGitOps_ArgoCDRef(t *testing.T) {
+	opts := GitOpsOptions{
+		Format:     GitOpsArgoCD,
+		ValuesMode: GitOpsValuesRef,
+		ChartRepos: map[string]string{"ingress-nginx": "oci://registry.example.com/charts"},
+		GitRepo:    "https://git.example.com/platform/helm-export.git",
+	}
+
+	files, err := GenerateGitOps(gitOpsSource(), opts)
+	if err != nil {
+		t.Fatalf("GenerateGitOps() error = %v", err)
+	}
+
+	app := parseObject(t, files["application.yaml"])
+	sources, ok := field(app, "spec", "sources").([]interface{})
+	if !ok || len(sources) != 2 {
+		t.Fatalf("spec.sources = %v, want chart and values sources", field(app, "spec", "sources"))
+	}
+
+	chart := sources[0].(map[string]interface{})
+	if chart["repoURL"] != "registry.example.com/charts" {
+		t.Errorf("chart repoURL = %v, want the OCI registry without scheme", chart["repoURL"])
+	}
+	valueFiles := field(chart, "helm", "valueFiles")
+	if !reflect.DeepEqual(valueFiles, []interface{}{"$values/prod/ingress-system/ingress-values.yaml"}) {
+		t.Errorf("valueFiles = %v", valueFiles)
+	}
+
+	values := sources[1].(map[string]interface{})
+	if values["ref"] != "values" || values["repoURL"] != opts.GitRepo || values["targetRevision"] != "HEAD" {
+		t.Errorf("values source = %v", values)
+	}
+	if field(app, "spec", "source") != nil {
+		t.Error("spec.source must not be set together with spec.sources")
+	}
+}
+
+func TestGenerateGitOps_FluxInline(t *testing.T) {
+	opts := GitOpsOptions{Format: GitOpsFlux, ValuesMode: GitOpsValuesInline}
+
+	files, err := GenerateGitOps(gitOpsSource(), opts)
+	if err != nil {
+		t.Fatalf("GenerateGitOps() error = %v", err)
+	}
+	if len(files) != 2 {
+		t.Fatalf("GenerateGitOps() returned %d files, want helmrelease.yaml and helmrepository.yaml", len(files))
+	}
+
+	repo := parseObject(t, files["helmrepository.yaml"])
+	if field(repo, "kind") != "HelmRepository" || field(repo, "spec", "url") != PlaceholderRepoURL {
+		t.Errorf("HelmRepository = %v, want the placeholder URL for an unknown chart", repo)
+	}
+	if field(repo, "metadata", "name") != "charts-example-com-replace-me" {
+		t.Errorf("HelmRepository name = %v", field(repo, "metadata", "name"))
+	}
+
+	hr := parseObject(t, files["helmrelease.yaml"])
+	checks := map[string]interface{}{
+		"apiVersion":                          "helm.toolkit.fluxcd.io/v2",
+		"metadata.name":                       "ingress",
+		"metadata.namespace":                  "ingress-system",
+		"spec.chart.spec.chart":               "ingress-nginx",
+		"spec.chart.spec.version":             "4.10.1",
+		"spec.chart.spec.sourceRef.kind":      "HelmRepository",
+		"spec.chart.spec.sourceRef.name":      "charts-example-com-replace-me",
+		"spec.chart.spec.sourceRef.namespace": "flux-system",
+		"spec.values.controller.replicaCount": float64(2),
+	}
+	for path, want := range checks {
+		if got := field(hr, strings.Split(path, ".")...); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s = %v, want %v", path, got, want)
+		}
+	}
+}
+
+func TestGenerateGitOps_FluxRef(t *testing.T) {
+	opts := GitOpsOptions{
+		Format:     GitOpsFlux,
+		ValuesMode: GitOpsValuesRef,
+		ChartRepos: map[string]string{"ingress-nginx": "oci://registry.example.com/charts"},
+	}
+
+	files, err := GenerateGitOps(gitOpsSource(), opts)
+	if err != nil {
+		t.Fatalf("GenerateGitOps() error = %v", err)
+	}
+
+	repo := parseObject(t, files["helmrepository.yaml"])
+	if field(repo, "spec", "type") != "oci" {
+		t.Errorf("HelmRepository type = %v, want oci", field(repo, "spec", "type"))
+	}
+
+	cm := parseObject(t, files["values-configmap.yaml"])
+	if field(cm, "metadata", "name") != "ingress-values" || field(cm, "data", "values.yaml") != gitOpsSource().Values {
+		t.Errorf("values ConfigMap = %v", cm)
+	}
+
+	hr := parseObject(t, files["helmrelease.yaml"])
+	if field(hr, "spec", "values") != nil {
+		t.Error("HelmRelease must not inline values when they are referenced")
+	}
+	want := []interface{}{map[string]interface{}{"kind": "ConfigMap", "name": "ingress-values", "valuesKey": "values.yaml"}}
+	if got := field(hr, "spec", "valuesFrom"); !reflect.DeepEqual(got, want) {
+		t.Errorf("valuesFrom = %v, want %v", got, want)
+	}
+}
+
+func TestGitOpsOptions_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    GitOpsOptions
+		wantErr bool
+	}{
+		{"argocd inline", GitOpsOptions{Format: GitOpsArgoCD, ValuesMode: GitOpsValuesInline}, false},
+		{"flux ref", GitOpsOptions{Format: GitOpsFlux, ValuesMode: GitOpsValuesRef}, false},
+		{"argocd ref with git repo", GitOpsOptions{Format: GitOpsArgoCD, ValuesMode: GitOpsValuesRef, GitRepo: "https://git.example.com/x.git"}, false},
+		{"argocd ref without git repo", GitOpsOptions{Format: GitOpsArgoCD, ValuesMode: GitOpsValuesRef}, true},
+		{"unknown format", GitOpsOptions{Format: "fleet", ValuesMode: GitOpsValuesInline}, true},
+		{"unknown values mode", GitOpsOptions{Format: GitOpsFlux, ValuesMode: "file"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.opts.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestObjectName(t *testing.T) {
+	tests := map[string]string{
+		"charts.bitnami.com/bitnami": "charts-bitnami-com-bitnami",
+		"My_Release":                 "my-release",
+		strings.Repeat("a", 70):      strings.Repeat("a", 63),
+	}
+	for in, want := range tests {
+		if got := objectName(in); got != want {
+			t.Errorf("objectName(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
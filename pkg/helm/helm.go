@@ -1,108 +1,252 @@
 package helm
 
 import (
-	"bytes"
+	"context"
 	"fmt"
-	"os/exec"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
+
+	"github.com/davidschrooten/manifold-k8s/pkg/k8s"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
 )
 
 // Release represents a Helm release
 type Release struct {
-	Name      string
-	Namespace string
-	Chart     string
-	Status    string
-	Revision  string
+	Name         string
+	Namespace    string
+	Chart        string
+	ChartName    string
+	ChartVersion string
+	AppVersion   string
+	Status       string
+	Revision     string
+	Updated      time.Time
 }
 
-// IsHelmInstalled checks if helm CLI is available
-func IsHelmInstalled() bool {
-	cmd := exec.Command("helm", "version", "--short")
-	return cmd.Run() == nil
+// releaseSecretType is the Secret type used by Helm's default storage driver
+const releaseSecretType = "helm.sh/release.v1"
+
+// DefaultStatuses are the statuses shown by `helm list` without extra flags
+var DefaultStatuses = []string{"deployed", "failed"}
+
+// releaseStatuses are all the statuses Helm records for a release revision
+var releaseStatuses = []string{
+	"unknown", "deployed", "uninstalled", "superseded", "failed",
+	"uninstalling", "pending-install", "pending-upgrade", "pending-rollback",
 }
 
-// ListReleases lists all Helm releases in a namespace using the specified context
-func ListReleases(namespace string) ([]Release, error) {
-	return ListReleasesWithContext(namespace, "")
+// ValidateStatuses checks that every status is a known Helm release status
+func ValidateStatuses(statuses []string) error {
+	for _, status := range statuses {
+		known := false
+		for _, s := range releaseStatuses {
+			if status == s {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return fmt.Errorf("invalid release status %q (must be one of: %s)", status, strings.Join(releaseStatuses, ", "))
+		}
+	}
+	return nil
 }
 
-// ListReleasesWithContext lists all Helm releases in a namespace using the specified kube context
-func ListReleasesWithContext(namespace, kubeContext string) ([]Release, error) {
-	args := []string{"list", "-n", namespace}
-	if kubeContext != "" {
-		args = append(args, "--kube-context", kubeContext)
+// ListReleases lists the deployed and failed Helm releases in a namespace, like `helm list`
+// Releases are read from Helm's release Secrets, so no helm binary is required.
+func ListReleases(ctx context.Context, client *k8s.Client, namespace string) ([]Release, error) {
+	return ListReleasesByStatus(ctx, client, namespace, DefaultStatuses)
+}
+
+// ListReleasesByStatus lists the Helm releases whose latest revision has one of the given statuses
+// An empty namespace lists releases in all namespaces in a single call, and no statuses
+// selects DefaultStatuses. Releases are sorted by namespace, then name.
+func ListReleasesByStatus(ctx context.Context, client *k8s.Client, namespace string, statuses []string) ([]Release, error) {
+	if len(statuses) == 0 {
+		statuses = DefaultStatuses
+	}
+	listed := make(map[string]bool, len(statuses))
+	for _, status := range statuses {
+		listed[status] = true
+	}
+
+	secrets, err := listReleaseSecrets(ctx, client, namespace, "")
+	if err != nil {
+		return nil, err
 	}
-	args = append(args, "--output", "json")
 
-	cmd := exec.Command("helm", args...)
-	var stdout, stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
+	var releases []Release
+	for _, secret := range latestRevisions(secrets) {
+		if !listed[secret.Labels["status"]] {
+			client.Logger().Debug("skipping Helm release with unlisted status", "namespace", secret.Namespace, "release", secret.Labels["name"], "status", secret.Labels["status"])
+			continue
+		}
 
-	if err := cmd.Run(); err != nil {
-		return nil, fmt.Errorf("failed to list helm releases: %s", stderr.String())
+		record, err := decodeReleaseSecret(secret)
+		if err != nil {
+			return nil, err
+		}
+		releases = append(releases, record.toRelease())
 	}
 
-	// Parse JSON output (simplified - just parse the text output instead)
-	// Using --output table for easier parsing
-	args = []string{"list", "-n", namespace}
-	if kubeContext != "" {
-		args = append(args, "--kube-context", kubeContext)
+	sort.Slice(releases, func(i, j int) bool {
+		if releases[i].Namespace != releases[j].Namespace {
+			return releases[i].Namespace < releases[j].Namespace
+		}
+		return releases[i].Name < releases[j].Name
+	})
+
+	return releases, nil
+}
+
+// Values modes select which values of a release are exported
+const (
+	// ValuesUser exports only the user-supplied values, like `helm get values`
+	ValuesUser = "user"
+	// ValuesComputed exports the user-supplied values merged over the chart defaults
+	ValuesComputed = "computed"
+	// ValuesBoth exports the user-supplied and computed values side by side
+	ValuesBoth = "both"
+)
+
+// ValidateValuesMode checks that mode is one of the supported values modes
+func ValidateValuesMode(mode string) error {
+	switch mode {
+	case ValuesUser, ValuesComputed, ValuesBoth:
+		return nil
+	default:
+		return fmt.Errorf("invalid values mode %q (must be %s, %s or %s)", mode, ValuesUser, ValuesComputed, ValuesBoth)
 	}
-	cmd = exec.Command("helm", args...)
-	stdout.Reset()
-	stderr.Reset()
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
+}
 
-	if err := cmd.Run(); err != nil {
-		return nil, fmt.Errorf("failed to list helm releases: %s", stderr.String())
+// GetValues retrieves the values of the latest revision of a Helm release as YAML
+// The user-supplied values are merged over the chart defaults, like `helm get values --all`.
+func GetValues(ctx context.Context, client *k8s.Client, releaseName, namespace string) (string, error) {
+	record, err := getLatestRelease(ctx, client, releaseName, namespace)
+	if err != nil {
+		return "", err
 	}
 
-	output := stdout.String()
-	lines := strings.Split(output, "\n")
+	return marshalValues(releaseName, mergeValues(record.Chart.Values, record.Config))
+}
 
-	var releases []Release
-	for i, line := range lines {
-		if i == 0 || strings.TrimSpace(line) == "" {
-			continue // Skip header and empty lines
+// GetUserValues retrieves the user-supplied values of the latest revision of a Helm release as YAML
+// Chart defaults are left out, like `helm get values` without --all.
+func GetUserValues(ctx context.Context, client *k8s.Client, releaseName, namespace string) (string, error) {
+	record, err := getLatestRelease(ctx, client, releaseName, namespace)
+	if err != nil {
+		return "", err
+	}
+
+	values := record.Config
+	if values == nil {
+		values = map[string]interface{}{}
+	}
+	return marshalValues(releaseName, values)
+}
+
+// marshalValues renders release values as YAML
+func marshalValues(releaseName string, values map[string]interface{}) (string, error) {
+	data, err := yaml.Marshal(values)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal values for %s: %w", releaseName, err)
+	}
+	return string(data), nil
+}
+
+// getLatestRelease decodes the latest revision of a single release
+func getLatestRelease(ctx context.Context, client *k8s.Client, releaseName, namespace string) (*releaseRecord, error) {
+	secrets, err := listReleaseSecrets(ctx, client, namespace, releaseName)
+	if err != nil {
+		return nil, err
+	}
+
+	latest := latestRevisions(secrets)
+	if len(latest) == 0 {
+		return nil, fmt.Errorf("release %s not found in namespace %s", releaseName, namespace)
+	}
+
+	return decodeReleaseSecret(latest[0])
+}
+
+// listReleaseSecrets lists Helm release Secrets, optionally for a single release
+func listReleaseSecrets(ctx context.Context, client *k8s.Client, namespace, releaseName string) ([]corev1.Secret, error) {
+	selector := "owner=helm"
+	if releaseName != "" {
+		selector += ",name=" + releaseName
+	}
+
+	secretList, err := client.Clientset.CoreV1().Secrets(namespace).List(ctx, metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		if namespace == metav1.NamespaceAll {
+			return nil, fmt.Errorf("failed to list helm release secrets in all namespaces: %w", err)
 		}
+		return nil, fmt.Errorf("failed to list helm release secrets in %s: %w", namespace, err)
+	}
 
-		fields := strings.Fields(line)
-		if len(fields) >= 5 {
-			releases = append(releases, Release{
-				Name:      fields[0],
-				Namespace: fields[1],
-				Revision:  fields[2],
-				Status:    fields[7],
-				Chart:     fields[8],
-			})
+	var secrets []corev1.Secret
+	for _, secret := range secretList.Items {
+		if secret.Type == releaseSecretType {
+			secrets = append(secrets, secret)
 		}
 	}
+	client.Logger().Debug("listed Helm release secrets", "namespace", namespace, "release", releaseName, "secrets", len(secrets))
+	return secrets, nil
+}
 
-	return releases, nil
+// latestRevisions returns the release Secret with the highest revision for each release
+// Releases are keyed by namespace too, since release names are only unique per namespace.
+func latestRevisions(secrets []corev1.Secret) []corev1.Secret {
+	latest := make(map[string]corev1.Secret)
+	for _, secret := range secrets {
+		name := secret.Namespace + "/" + secret.Labels["name"]
+		current, found := latest[name]
+		if !found || revisionOf(secret) > revisionOf(current) {
+			latest[name] = secret
+		}
+	}
+
+	result := make([]corev1.Secret, 0, len(latest))
+	for _, secret := range latest {
+		result = append(result, secret)
+	}
+	return result
 }
 
-// GetValues retrieves the values for a specific Helm release
-func GetValues(releaseName, namespace string) (string, error) {
-	return GetValuesWithContext(releaseName, namespace, "")
+// revisionOf returns the revision stored in a release Secret's version label
+func revisionOf(secret corev1.Secret) int {
+	revision, err := strconv.Atoi(secret.Labels["version"])
+	if err != nil {
+		return 0
+	}
+	return revision
 }
 
-// GetValuesWithContext retrieves the values for a specific Helm release using the specified kube context
-func GetValuesWithContext(releaseName, namespace, kubeContext string) (string, error) {
-	args := []string{"get", "values", releaseName, "-n", namespace, "--all"}
-	if kubeContext != "" {
-		args = append(args, "--kube-context", kubeContext)
+// mergeValues merges override values over base values
+// Nested maps are merged recursively, and a nil override removes the key, as in Helm.
+func mergeValues(base, override map[string]interface{}) map[string]interface{} {
+	merged := make(map[string]interface{}, len(base))
+	for key, value := range base {
+		merged[key] = value
 	}
-	cmd := exec.Command("helm", args...)
-	var stdout, stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
 
-	if err := cmd.Run(); err != nil {
-		return "", fmt.Errorf("failed to get helm values for %s: %s", releaseName, stderr.String())
+	for key, value := range override {
+		if value == nil {
+			delete(merged, key)
+			continue
+		}
+		overrideMap, overrideIsMap := value.(map[string]interface{})
+		baseMap, baseIsMap := merged[key].(map[string]interface{})
+		if overrideIsMap && baseIsMap {
+			merged[key] = mergeValues(baseMap, overrideMap)
+			continue
+		}
+		merged[key] = value
 	}
 
-	return stdout.String(), nil
+	return merged
 }
@@ -1,104 +1,417 @@
 package helm
 
 import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
 	"os"
-	"os/exec"
+	"path/filepath"
 	"testing"
+	"time"
+
+	"github.com/davidschrooten/manifold-k8s/pkg/k8s"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
 )
 
-func TestIsHelmInstalled(t *testing.T) {
-	// This test depends on whether helm is actually installed
-	// We'll test both scenarios by manipulating PATH
+// encodeRelease encodes a release the way Helm's storage driver does: JSON, gzip, base64
+func encodeRelease(t *testing.T, release map[string]interface{}) []byte {
+	t.Helper()
+
+	data, err := json.Marshal(release)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	writer := gzip.NewWriter(&buf)
+	if _, err := writer.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return []byte(base64.StdEncoding.EncodeToString(buf.Bytes()))
+}
+
+// releaseSecret builds a Helm release Secret for the given release revision
+func releaseSecret(t *testing.T, name, namespace, status string, revision int, config map[string]interface{}) *corev1.Secret {
+	t.Helper()
+
+	release := map[string]interface{}{
+		"name":      name,
+		"namespace": namespace,
+		"version":   revision,
+		"info":      map[string]interface{}{"status": status},
+		"chart": map[string]interface{}{
+			"metadata": map[string]interface{}{"name": name + "-chart", "version": fmt.Sprintf("1.%d.0", revision), "appVersion": "2.0.0"},
+			"values": map[string]interface{}{
+				"replicaCount": 1,
+				"image":        map[string]interface{}{"repository": "nginx", "tag": "stable"},
+				"debug":        true,
+			},
+		},
+		"config": config,
+	}
+
+	return releaseSecretFor(t, name, namespace, status, revision, release)
+}
+
+// releaseSecretFor wraps an encoded release in a Helm release Secret
+func releaseSecretFor(t *testing.T, name, namespace, status string, revision int, release map[string]interface{}) *corev1.Secret {
+	t.Helper()
 
-	originalPath := os.Getenv("PATH")
-	defer func() {
-		_ = os.Setenv("PATH", originalPath)
-	}()
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      fmt.Sprintf("sh.helm.release.v1.%s.v%d", name, revision),
+			Namespace: namespace,
+			Labels: map[string]string{
+				"owner":   "helm",
+				"name":    name,
+				"status":  status,
+				"version": fmt.Sprintf("%d", revision),
+			},
+		},
+		Type: releaseSecretType,
+		Data: map[string][]byte{"release": encodeRelease(t, release)},
+	}
+}
+
+// newFakeClient returns a client backed by a fake clientset holding the given objects
+func newFakeClient(objects ...runtime.Object) *k8s.Client {
+	return &k8s.Client{
+		Clientset: fake.NewSimpleClientset(objects...), //nolint:staticcheck // Using deprecated API for testing purposes
+	}
+}
+
+func TestListReleases(t *testing.T) {
+	client := newFakeClient(
+		releaseSecret(t, "web", "default", "superseded", 1, nil),
+		releaseSecret(t, "web", "default", "deployed", 2, nil),
+		releaseSecret(t, "api", "default", "failed", 1, nil),
+		releaseSecret(t, "old", "default", "uninstalled", 3, nil),
+		releaseSecret(t, "other", "kube-system", "deployed", 1, nil),
+	)
+
+	releases, err := ListReleases(context.Background(), client, "default")
+	if err != nil {
+		t.Fatalf("ListReleases() error = %v", err)
+	}
+
+	if len(releases) != 2 {
+		t.Fatalf("ListReleases() returned %d releases, want 2: %v", len(releases), releases)
+	}
 
-	t.Run("helm not in PATH", func(t *testing.T) {
-		_ = os.Setenv("PATH", "/nonexistent")
-		if IsHelmInstalled() {
-			t.Error("IsHelmInstalled() should return false when helm is not in PATH")
+	want := []Release{
+		{Name: "api", Namespace: "default", Chart: "api-chart-1.1.0", ChartName: "api-chart", ChartVersion: "1.1.0", AppVersion: "2.0.0", Status: "failed", Revision: "1"},
+		{Name: "web", Namespace: "default", Chart: "web-chart-1.2.0", ChartName: "web-chart", ChartVersion: "1.2.0", AppVersion: "2.0.0", Status: "deployed", Revision: "2"},
+	}
+	for i := range want {
+		if releases[i] != want[i] {
+			t.Errorf("ListReleases()[%d] = %+v, want %+v", i, releases[i], want[i])
 		}
-	})
-
-	t.Run("helm in PATH", func(t *testing.T) {
-		_ = os.Setenv("PATH", originalPath)
-		// Look for helm in the original PATH
-		_, err := exec.LookPath("helm")
-		if err == nil {
-			// helm is installed
-			if !IsHelmInstalled() {
-				t.Error("IsHelmInstalled() should return true when helm is in PATH")
+	}
+}
+
+func TestListReleasesByStatus_AllNamespaces(t *testing.T) {
+	client := newFakeClient(
+		releaseSecret(t, "web", "default", "superseded", 1, nil),
+		releaseSecret(t, "web", "default", "deployed", 2, nil),
+		releaseSecret(t, "web", "staging", "pending-upgrade", 5, nil),
+		releaseSecret(t, "api", "staging", "failed", 1, nil),
+		releaseSecret(t, "old", "default", "uninstalled", 3, nil),
+	)
+
+	tests := []struct {
+		name     string
+		statuses []string
+		want     []string
+	}{
+		{"default statuses", nil, []string{"default/web@2", "staging/api@1"}},
+		{"pending upgrades", []string{"pending-upgrade"}, []string{"staging/web@5"}},
+		{
+			name:     "several statuses",
+			statuses: []string{"deployed", "failed", "pending-upgrade"},
+			want:     []string{"default/web@2", "staging/api@1", "staging/web@5"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			releases, err := ListReleasesByStatus(context.Background(), client, "", tt.statuses)
+			if err != nil {
+				t.Fatalf("ListReleasesByStatus() error = %v", err)
 			}
-		} else {
-			// helm is not installed, skip this test
-			t.Skip("helm is not installed, skipping positive test")
-		}
-	})
+
+			var got []string
+			for _, r := range releases {
+				got = append(got, fmt.Sprintf("%s/%s@%s", r.Namespace, r.Name, r.Revision))
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("ListReleasesByStatus() = %v, want %v", got, tt.want)
+			}
+		})
+	}
 }
 
-func TestListReleases_NoHelm(t *testing.T) {
-	// Save original PATH
-	originalPath := os.Getenv("PATH")
-	defer func() {
-		_ = os.Setenv("PATH", originalPath)
-	}()
+func TestValidateStatuses(t *testing.T) {
+	if err := ValidateStatuses([]string{"deployed", "failed", "pending-upgrade"}); err != nil {
+		t.Errorf("ValidateStatuses() error = %v", err)
+	}
+	if err := ValidateStatuses([]string{"deployed", "running"}); err == nil {
+		t.Error("ValidateStatuses() expected error for unknown status, got nil")
+	}
+}
 
-	// Set PATH to empty to simulate missing helm
-	_ = os.Setenv("PATH", "/nonexistent")
+func TestListReleases_IgnoresOtherSecrets(t *testing.T) {
+	opaque := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "not-a-release",
+			Namespace: "default",
+			Labels:    map[string]string{"owner": "helm", "name": "fake", "status": "deployed", "version": "1"},
+		},
+		Type: corev1.SecretTypeOpaque,
+	}
+	client := newFakeClient(opaque)
 
-	_, err := ListReleases("default")
-	if err == nil {
-		t.Error("ListReleases() should return error when helm is not available")
+	releases, err := ListReleases(context.Background(), client, "default")
+	if err != nil {
+		t.Fatalf("ListReleases() error = %v", err)
+	}
+	if len(releases) != 0 {
+		t.Errorf("ListReleases() = %v, want no releases", releases)
 	}
 }
 
-func TestListReleases_InvalidNamespace(t *testing.T) {
-	// Check if helm is installed
-	if !IsHelmInstalled() {
-		t.Skip("helm is not installed, skipping test")
+func TestListReleases_CorruptPayload(t *testing.T) {
+	secret := releaseSecret(t, "web", "default", "deployed", 1, nil)
+	secret.Data["release"] = []byte("not base64!")
+	client := newFakeClient(secret)
+
+	if _, err := ListReleases(context.Background(), client, "default"); err == nil {
+		t.Error("ListReleases() expected error for corrupt release payload, got nil")
 	}
+}
+
+func TestGetValues(t *testing.T) {
+	client := newFakeClient(
+		releaseSecret(t, "web", "default", "superseded", 1, map[string]interface{}{"replicaCount": 2}),
+		releaseSecret(t, "web", "default", "deployed", 2, map[string]interface{}{
+			"replicaCount": 3,
+			"image":        map[string]interface{}{"tag": "1.25"},
+			"debug":        nil,
+		}),
+	)
 
-	// Try to list releases in a namespace that likely doesn't exist
-	_, err := ListReleases("nonexistent-namespace-12345")
-	// This should not error - it should just return empty list
-	// Helm list returns success with empty results for non-existent namespaces
+	values, err := GetValues(context.Background(), client, "web", "default")
 	if err != nil {
-		t.Logf("ListReleases() returned error: %v (this is acceptable)", err)
+		t.Fatalf("GetValues() error = %v", err)
+	}
+
+	// Latest revision's overrides merged over the chart defaults, null removes a key
+	want := `image:
+  repository: nginx
+  tag: "1.25"
+replicaCount: 3
+`
+	if values != want {
+		t.Errorf("GetValues() =\n%s\nwant\n%s", values, want)
 	}
 }
 
-func TestGetValues_NoHelm(t *testing.T) {
-	// Save original PATH
-	originalPath := os.Getenv("PATH")
-	defer func() {
-		_ = os.Setenv("PATH", originalPath)
-	}()
+func TestGetUserValues(t *testing.T) {
+	client := newFakeClient(
+		releaseSecret(t, "web", "default", "deployed", 1, map[string]interface{}{
+			"image": map[string]interface{}{"tag": "1.25"},
+		}),
+		releaseSecret(t, "plain", "default", "deployed", 1, nil),
+	)
+
+	values, err := GetUserValues(context.Background(), client, "web", "default")
+	if err != nil {
+		t.Fatalf("GetUserValues() error = %v", err)
+	}
+	// Only the overrides, without the chart defaults
+	if want := "image:\n  tag: \"1.25\"\n"; values != want {
+		t.Errorf("GetUserValues() =\n%s\nwant\n%s", values, want)
+	}
+
+	values, err = GetUserValues(context.Background(), client, "plain", "default")
+	if err != nil {
+		t.Fatalf("GetUserValues() error = %v", err)
+	}
+	if values != "{}\n" {
+		t.Errorf("GetUserValues() without overrides = %q, want {}", values)
+	}
 
-	// Set PATH to empty to simulate missing helm
-	_ = os.Setenv("PATH", "/nonexistent")
+	if _, err := GetUserValues(context.Background(), client, "missing", "default"); err == nil {
+		t.Error("GetUserValues() should return error for non-existent release")
+	}
+}
 
-	_, err := GetValues("test-release", "default")
-	if err == nil {
-		t.Error("GetValues() should return error when helm is not available")
+func TestValidateValuesMode(t *testing.T) {
+	for _, mode := range []string{ValuesUser, ValuesComputed, ValuesBoth} {
+		if err := ValidateValuesMode(mode); err != nil {
+			t.Errorf("ValidateValuesMode(%s) error = %v", mode, err)
+		}
+	}
+	if err := ValidateValuesMode("all"); err == nil {
+		t.Error("ValidateValuesMode() expected error for invalid mode, got nil")
 	}
 }
 
 func TestGetValues_NonExistentRelease(t *testing.T) {
-	// Check if helm is installed
-	if !IsHelmInstalled() {
-		t.Skip("helm is not installed, skipping test")
-	}
+	client := newFakeClient()
 
-	// Try to get values for a release that doesn't exist
-	_, err := GetValues("nonexistent-release-12345", "default")
+	_, err := GetValues(context.Background(), client, "nonexistent-release", "default")
 	if err == nil {
 		t.Error("GetValues() should return error for non-existent release")
 	}
+}
+
+func TestDecodeRelease_Fixtures(t *testing.T) {
+	tests := []struct {
+		name     string
+		fixture  string
+		compress bool
+		want     Release
+	}{
+		{
+			name:     "gzipped release with dashes in the chart name",
+			fixture:  "ingress-nginx.json",
+			compress: true,
+			want: Release{
+				Name:         "ingress",
+				Namespace:    "ingress-system",
+				Chart:        "ingress-nginx-4.10.1",
+				ChartName:    "ingress-nginx",
+				ChartVersion: "4.10.1",
+				AppVersion:   "1.10.1",
+				Status:       "deployed",
+				Revision:     "7",
+				Updated:      time.Date(2024, 3, 5, 13, 30, 15, 500000000, time.UTC),
+			},
+		},
+		{
+			name:     "uncompressed release without app version or timestamps",
+			fixture:  "pending-upgrade.json",
+			compress: false,
+			want: Release{
+				Name:         "payments-api",
+				Namespace:    "payments",
+				Chart:        "payments-api-0.1.0-rc.1+build.5",
+				ChartName:    "payments-api",
+				ChartVersion: "0.1.0-rc.1+build.5",
+				Status:       "pending-upgrade",
+				Revision:     "12",
+			},
+		},
+		{
+			name:     "release without chart metadata",
+			fixture:  "missing-metadata.json",
+			compress: true,
+			want: Release{
+				Name:      "orphan",
+				Namespace: "default",
+				Status:    "failed",
+				Revision:  "1",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := os.ReadFile(filepath.Join("testdata", tt.fixture))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var payload []byte
+			if tt.compress {
+				var release map[string]interface{}
+				if err := json.Unmarshal(data, &release); err != nil {
+					t.Fatal(err)
+				}
+				payload = encodeRelease(t, release)
+			} else {
+				payload = []byte(base64.StdEncoding.EncodeToString(data))
+			}
+
+			record, err := decodeRelease(payload)
+			if err != nil {
+				t.Fatalf("decodeRelease() error = %v", err)
+			}
+
+			got := record.toRelease()
+			if !got.Updated.Equal(tt.want.Updated) {
+				t.Errorf("Updated = %v, want %v", got.Updated, tt.want.Updated)
+			}
+			got.Updated, tt.want.Updated = time.Time{}, time.Time{}
+			if got != tt.want {
+				t.Errorf("toRelease() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeRelease_Invalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload []byte
+	}{
+		{"not base64", []byte("%%%")},
+		{"truncated gzip", []byte(base64.StdEncoding.EncodeToString([]byte{0x1f, 0x8b, 0x08, 0x00}))},
+		{"not JSON", []byte(base64.StdEncoding.EncodeToString([]byte("NAME NAMESPACE REVISION")))},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := decodeRelease(tt.payload); err == nil {
+				t.Error("decodeRelease() expected error, got nil")
+			}
+		})
+	}
+}
+
+func TestMergeValues(t *testing.T) {
+	base := map[string]interface{}{
+		"a": 1,
+		"nested": map[string]interface{}{
+			"keep":     "base",
+			"override": "base",
+		},
+		"removed": "base",
+	}
+	override := map[string]interface{}{
+		"nested": map[string]interface{}{
+			"override": "user",
+		},
+		"removed": nil,
+		"added":   true,
+	}
+
+	merged := mergeValues(base, override)
+
+	if merged["a"] != 1 || merged["added"] != true {
+		t.Errorf("mergeValues() top-level = %v", merged)
+	}
+	if _, ok := merged["removed"]; ok {
+		t.Error("mergeValues() should remove keys set to null")
+	}
+	nested := merged["nested"].(map[string]interface{})
+	if nested["keep"] != "base" || nested["override"] != "user" {
+		t.Errorf("mergeValues() nested = %v", nested)
+	}
 
-	if err != nil && err.Error() == "" {
-		t.Error("GetValues() error should have a message")
+	// The inputs must not be modified
+	if base["nested"].(map[string]interface{})["override"] != "base" {
+		t.Error("mergeValues() modified the base values")
 	}
 }
 
@@ -128,35 +441,3 @@ func TestRelease_Structure(t *testing.T) {
 		t.Errorf("Release.Revision = %s, want 1", release.Revision)
 	}
 }
-
-func TestListReleasesWithContext_NoHelm(t *testing.T) {
-	// Save original PATH
-	originalPath := os.Getenv("PATH")
-	defer func() {
-		_ = os.Setenv("PATH", originalPath)
-	}()
-
-	// Set PATH to empty to simulate missing helm
-	_ = os.Setenv("PATH", "/nonexistent")
-
-	_, err := ListReleasesWithContext("default", "test-context")
-	if err == nil {
-		t.Error("ListReleasesWithContext() should return error when helm is not available")
-	}
-}
-
-func TestGetValuesWithContext_NoHelm(t *testing.T) {
-	// Save original PATH
-	originalPath := os.Getenv("PATH")
-	defer func() {
-		_ = os.Setenv("PATH", originalPath)
-	}()
-
-	// Set PATH to empty to simulate missing helm
-	_ = os.Setenv("PATH", "/nonexistent")
-
-	_, err := GetValuesWithContext("test-release", "default", "test-context")
-	if err == nil {
-		t.Error("GetValuesWithContext() should return error when helm is not available")
-	}
-}
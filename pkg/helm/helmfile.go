@@ -0,0 +1,89 @@
+package helm
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+// HelmfileRelease is an exported release to describe in a helmfile.yaml
+type HelmfileRelease struct {
+	Release     Release
+	KubeContext string
+	ValuesFiles []string // relative to the directory holding helmfile.yaml
+}
+
+// helmfile mirrors the parts of helmfile's state file that are generated
+type helmfile struct {
+	Repositories []helmfileRepository  `json:"repositories,omitempty"`
+	Releases     []helmfileReleaseSpec `json:"releases"`
+}
+
+type helmfileRepository struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+	OCI  bool   `json:"oci,omitempty"`
+}
+
+type helmfileReleaseSpec struct {
+	Name        string            `json:"name"`
+	Namespace   string            `json:"namespace"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	Chart       string            `json:"chart"`
+	Version     string            `json:"version,omitempty"`
+	KubeContext string            `json:"kubeContext,omitempty"`
+	Values      []string          `json:"values,omitempty"`
+}
+
+// kubeContextLabel is the release label holding the kube context, so that
+// `helmfile -l kubeContext=<context>` selects the releases of one cluster
+const kubeContextLabel = "kubeContext"
+
+// GenerateHelmfile renders a helmfile.yaml that reinstalls the exported releases
+// Each release is pinned to its kube context, which alone selects the cluster, and labelled
+// with it. Helmfile environments are not generated: they would not keep the releases of other
+// contexts from being applied. Charts are resolved through chartRepos; unknown charts use the
+// placeholder repository.
+func GenerateHelmfile(releases []HelmfileRelease, chartRepos map[string]string) ([]byte, error) {
+	state := helmfile{Releases: []helmfileReleaseSpec{}}
+	repositories := make(map[string]helmfileRepository)
+
+	for _, r := range releases {
+		repoURL, _ := ChartRepoURL(chartRepos, r.Release.ChartName)
+		repo := helmfileRepository{Name: repositoryName(repoURL), URL: repoURL}
+		if strings.HasPrefix(repoURL, "oci://") {
+			// helmfile expects OCI registries without the scheme
+			repo.URL = strings.TrimPrefix(repoURL, "oci://")
+			repo.OCI = true
+		}
+		repositories[repo.Name] = repo
+
+		spec := helmfileReleaseSpec{
+			Name:        r.Release.Name,
+			Namespace:   r.Release.Namespace,
+			Chart:       repo.Name + "/" + r.Release.ChartName,
+			Version:     r.Release.ChartVersion,
+			KubeContext: r.KubeContext,
+			Values:      r.ValuesFiles,
+		}
+		if r.KubeContext != "" {
+			spec.Labels = map[string]string{kubeContextLabel: r.KubeContext}
+		}
+		state.Releases = append(state.Releases, spec)
+	}
+
+	for _, repo := range repositories {
+		state.Repositories = append(state.Repositories, repo)
+	}
+	sort.Slice(state.Repositories, func(i, j int) bool {
+		return state.Repositories[i].Name < state.Repositories[j].Name
+	})
+
+	data, err := yaml.Marshal(state)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal helmfile: %w", err)
+	}
+	return data, nil
+}
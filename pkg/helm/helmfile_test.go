@@ -0,0 +1,116 @@
+package helm
+
+import (
+	"testing"
+)
+
+func TestGenerateHelmfile(t *testing.T) {
+	releases := []HelmfileRelease{
+		{
+			Release:     Release{Name: "ingress", Namespace: "ingress-system", ChartName: "ingress-nginx", ChartVersion: "4.10.1"},
+			KubeContext: "prod",
+			ValuesFiles: []string{"prod/ingress-system/ingress-values.yaml"},
+		},
+		{
+			Release:     Release{Name: "podinfo", Namespace: "apps", ChartName: "podinfo", ChartVersion: "6.5.0"},
+			KubeContext: "prod",
+			ValuesFiles: []string{"prod/apps/podinfo-values.yaml"},
+		},
+		{
+			Release:     Release{Name: "legacy", Namespace: "apps", ChartName: "legacy"},
+			KubeContext: "prod",
+		},
+	}
+	chartRepos := map[string]string{
+		"ingress-nginx": "https://kubernetes.github.io/ingress-nginx",
+		"podinfo":       "oci://ghcr.io/stefanprodan/charts",
+	}
+
+	data, err := GenerateHelmfile(releases, chartRepos)
+	if err != nil {
+		t.Fatalf("GenerateHelmfile() error = %v", err)
+	}
+
+	want := `releases:
+- chart: kubernetes-github-io-ingress-nginx/ingress-nginx
+  kubeContext: prod
+  labels:
+    kubeContext: prod
+  name: ingress
+  namespace: ingress-system
+  values:
+  - prod/ingress-system/ingress-values.yaml
+  version: 4.10.1
+- chart: ghcr-io-stefanprodan-charts/podinfo
+  kubeContext: prod
+  labels:
+    kubeContext: prod
+  name: podinfo
+  namespace: apps
+  values:
+  - prod/apps/podinfo-values.yaml
+  version: 6.5.0
+- chart: charts-example-com-replace-me/legacy
+  kubeContext: prod
+  labels:
+    kubeContext: prod
+  name: legacy
+  namespace: apps
+repositories:
+- name: charts-example-com-replace-me
+  url: https://charts.example.com/REPLACE-ME
+- name: ghcr-io-stefanprodan-charts
+  oci: true
+  url: ghcr.io/stefanprodan/charts
+- name: kubernetes-github-io-ingress-nginx
+  url: https://kubernetes.github.io/ingress-nginx
+`
+	if string(data) != want {
+		t.Errorf("GenerateHelmfile() =\n%s\nwant\n%s", data, want)
+	}
+}
+
+func TestGenerateHelmfile_MultipleContexts(t *testing.T) {
+	releases := []HelmfileRelease{
+		{Release: Release{Name: "podinfo", Namespace: "apps", ChartName: "podinfo"}, KubeContext: "staging"},
+		{Release: Release{Name: "podinfo", Namespace: "apps", ChartName: "podinfo"}, KubeContext: "prod"},
+	}
+
+	data, err := GenerateHelmfile(releases, map[string]string{"podinfo": "https://stefanprodan.github.io/podinfo"})
+	if err != nil {
+		t.Fatalf("GenerateHelmfile() error = %v", err)
+	}
+
+	// Each release is tied to its own cluster and selectable by label; no environment claims to
+	// select a context while applying the releases of every context
+	want := `releases:
+- chart: stefanprodan-github-io-podinfo/podinfo
+  kubeContext: staging
+  labels:
+    kubeContext: staging
+  name: podinfo
+  namespace: apps
+- chart: stefanprodan-github-io-podinfo/podinfo
+  kubeContext: prod
+  labels:
+    kubeContext: prod
+  name: podinfo
+  namespace: apps
+repositories:
+- name: stefanprodan-github-io-podinfo
+  url: https://stefanprodan.github.io/podinfo
+`
+	if string(data) != want {
+		t.Errorf("GenerateHelmfile() =\n%s\nwant\n%s", data, want)
+	}
+}
+
+func TestGenerateHelmfile_NoReleases(t *testing.T) {
+	data, err := GenerateHelmfile(nil, nil)
+	if err != nil {
+		t.Fatalf("GenerateHelmfile() error = %v", err)
+	}
+	if string(data) != "releases: []\n" {
+		t.Errorf("GenerateHelmfile() = %q, want an empty release list", data)
+	}
+}
@@ -0,0 +1,144 @@
+package helm
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/davidschrooten/manifold-k8s/pkg/k8s"
+)
+
+// GetHistory retrieves the last max revisions of a Helm release, oldest first, like `helm history`
+// All stored revisions are returned when max is zero or negative.
+func GetHistory(ctx context.Context, client *k8s.Client, releaseName, namespace string, max int) ([]*ReleaseDetails, error) {
+	secrets, err := listReleaseSecrets(ctx, client, namespace, releaseName)
+	if err != nil {
+		return nil, err
+	}
+	if len(secrets) == 0 {
+		return nil, fmt.Errorf("release %s not found in namespace %s", releaseName, namespace)
+	}
+
+	sort.Slice(secrets, func(i, j int) bool {
+		return revisionOf(secrets[i]) < revisionOf(secrets[j])
+	})
+	if max > 0 && len(secrets) > max {
+		secrets = secrets[len(secrets)-max:]
+	}
+
+	history := make([]*ReleaseDetails, 0, len(secrets))
+	for _, secret := range secrets {
+		record, err := decodeReleaseSecret(secret)
+		if err != nil {
+			return nil, err
+		}
+		history = append(history, record.toDetails())
+	}
+	return history, nil
+}
+
+// ComputedValues returns the user-supplied values merged over the chart defaults
+func (d *ReleaseDetails) ComputedValues() map[string]interface{} {
+	return mergeValues(d.ChartValues, d.UserValues)
+}
+
+// ValuesYAML renders the user-supplied or computed values of the revision as YAML
+func (d *ReleaseDetails) ValuesYAML(user bool) (string, error) {
+	if !user {
+		return marshalValues(d.Name, d.ComputedValues())
+	}
+
+	values := d.UserValues
+	if values == nil {
+		values = map[string]interface{}{}
+	}
+	return marshalValues(d.Name, values)
+}
+
+// ValuesChangelog renders a Markdown changelog of the values keys that changed between
+// consecutive revisions in history, which must be ordered oldest first
+func ValuesChangelog(releaseName string, history []*ReleaseDetails, user bool) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s values changelog\n", releaseName)
+
+	for i := 1; i < len(history); i++ {
+		previous, current := history[i-1], history[i]
+		fmt.Fprintf(&b, "\n## Revision %s (from %s)\n\n", current.Revision, previous.Revision)
+		if current.ChartVersion != previous.ChartVersion {
+			fmt.Fprintf(&b, "Chart: %s -> %s\n\n", previous.Chart, current.Chart)
+		}
+
+		added, changed, removed := diffValueKeys(valuesOf(previous, user), valuesOf(current, user))
+		if len(added)+len(changed)+len(removed) == 0 {
+			b.WriteString("No values changed.\n")
+			continue
+		}
+		writeKeys(&b, "Added", added)
+		writeKeys(&b, "Changed", changed)
+		writeKeys(&b, "Removed", removed)
+	}
+
+	if len(history) < 2 {
+		b.WriteString("\nOnly one revision exported; nothing to compare.\n")
+	}
+	return b.String()
+}
+
+// valuesOf selects the values compared in the changelog
+func valuesOf(d *ReleaseDetails, user bool) map[string]interface{} {
+	if user {
+		return d.UserValues
+	}
+	return d.ComputedValues()
+}
+
+// writeKeys writes one changelog line per key
+func writeKeys(b *strings.Builder, label string, keys []string) {
+	for _, key := range keys {
+		fmt.Fprintf(b, "- %s: `%s`\n", label, key)
+	}
+}
+
+// diffValueKeys compares two values trees by their flattened keys
+func diffValueKeys(before, after map[string]interface{}) (added, changed, removed []string) {
+	beforeKeys := flattenValues("", before, map[string]interface{}{})
+	afterKeys := flattenValues("", after, map[string]interface{}{})
+
+	for key, value := range afterKeys {
+		previous, found := beforeKeys[key]
+		switch {
+		case !found:
+			added = append(added, key)
+		case !reflect.DeepEqual(previous, value):
+			changed = append(changed, key)
+		}
+	}
+	for key := range beforeKeys {
+		if _, found := afterKeys[key]; !found {
+			removed = append(removed, key)
+		}
+	}
+
+	sort.Strings(added)
+	sort.Strings(changed)
+	sort.Strings(removed)
+	return added, changed, removed
+}
+
+// flattenValues flattens nested maps into dotted keys; lists and scalars are leaf values
+func flattenValues(prefix string, values map[string]interface{}, flat map[string]interface{}) map[string]interface{} {
+	for key, value := range values {
+		path := key
+		if prefix != "" {
+			path = prefix + "." + key
+		}
+		if nested, ok := value.(map[string]interface{}); ok && len(nested) > 0 {
+			flattenValues(path, nested, flat)
+			continue
+		}
+		flat[path] = value
+	}
+	return flat
+}
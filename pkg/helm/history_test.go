@@ -0,0 +1,135 @@
+package helm
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestGetHistory(t *testing.T) {
+	client := newFakeClient(
+		releaseSecret(t, "web", "default", "superseded", 1, map[string]interface{}{"replicaCount": 1}),
+		releaseSecret(t, "web", "default", "superseded", 2, map[string]interface{}{"replicaCount": 2}),
+		releaseSecret(t, "web", "default", "superseded", 10, map[string]interface{}{"replicaCount": 10}),
+		releaseSecret(t, "web", "default", "deployed", 11, map[string]interface{}{"replicaCount": 11}),
+		releaseSecret(t, "api", "default", "deployed", 1, nil),
+	)
+
+	history, err := GetHistory(context.Background(), client, "web", "default", 3)
+	if err != nil {
+		t.Fatalf("GetHistory() error = %v", err)
+	}
+
+	var revisions []string
+	for _, revision := range history {
+		revisions = append(revisions, revision.Revision)
+	}
+	// Revisions are ordered numerically, not by label string
+	if want := []string{"2", "10", "11"}; !reflect.DeepEqual(revisions, want) {
+		t.Errorf("GetHistory() revisions = %v, want %v", revisions, want)
+	}
+
+	all, err := GetHistory(context.Background(), client, "web", "default", 0)
+	if err != nil {
+		t.Fatalf("GetHistory() error = %v", err)
+	}
+	if len(all) != 4 {
+		t.Errorf("GetHistory() with no limit returned %d revisions, want 4", len(all))
+	}
+
+	if _, err := GetHistory(context.Background(), client, "missing", "default", 3); err == nil {
+		t.Error("GetHistory() should return error for non-existent release")
+	}
+}
+
+func TestReleaseDetails_ValuesYAML(t *testing.T) {
+	details := &ReleaseDetails{
+		ChartValues: map[string]interface{}{"replicaCount": 1, "debug": true},
+		UserValues:  map[string]interface{}{"replicaCount": 3},
+	}
+
+	computed, err := details.ValuesYAML(false)
+	if err != nil {
+		t.Fatalf("ValuesYAML(false) error = %v", err)
+	}
+	if want := "debug: true\nreplicaCount: 3\n"; computed != want {
+		t.Errorf("ValuesYAML(false) = %q, want %q", computed, want)
+	}
+
+	user, err := details.ValuesYAML(true)
+	if err != nil {
+		t.Fatalf("ValuesYAML(true) error = %v", err)
+	}
+	if want := "replicaCount: 3\n"; user != want {
+		t.Errorf("ValuesYAML(true) = %q, want %q", user, want)
+	}
+}
+
+func TestValuesChangelog(t *testing.T) {
+	history := []*ReleaseDetails{
+		{
+			Release:     Release{Revision: "1", Chart: "web-1.0.0", ChartVersion: "1.0.0"},
+			ChartValues: map[string]interface{}{"image": map[string]interface{}{"tag": "1.0"}},
+			UserValues:  map[string]interface{}{"replicaCount": 1, "debug": true},
+		},
+		{
+			Release:     Release{Revision: "2", Chart: "web-1.0.0", ChartVersion: "1.0.0"},
+			ChartValues: map[string]interface{}{"image": map[string]interface{}{"tag": "1.0"}},
+			UserValues:  map[string]interface{}{"replicaCount": 1, "debug": true},
+		},
+		{
+			Release:     Release{Revision: "3", Chart: "web-1.1.0", ChartVersion: "1.1.0"},
+			ChartValues: map[string]interface{}{"image": map[string]interface{}{"tag": "1.1"}},
+			UserValues:  map[string]interface{}{"replicaCount": 3, "ingress": map[string]interface{}{"enabled": true}},
+		},
+	}
+
+	want := "# web values changelog\n" +
+		"\n## Revision 2 (from 1)\n\n" +
+		"No values changed.\n" +
+		"\n## Revision 3 (from 2)\n\n" +
+		"Chart: web-1.0.0 -> web-1.1.0\n\n" +
+		"- Added: `ingress.enabled`\n" +
+		"- Changed: `image.tag`\n" +
+		"- Changed: `replicaCount`\n" +
+		"- Removed: `debug`\n"
+	if got := ValuesChangelog("web", history, false); got != want {
+		t.Errorf("ValuesChangelog() =\n%s\nwant\n%s", got, want)
+	}
+
+	// Comparing only user values leaves out the chart default change
+	user := ValuesChangelog("web", history, true)
+	if strings.Contains(user, "`image.tag`") {
+		t.Errorf("ValuesChangelog(user) should not report chart defaults:\n%s", user)
+	}
+
+	single := ValuesChangelog("web", history[:1], false)
+	if want := "# web values changelog\n\nOnly one revision exported; nothing to compare.\n"; single != want {
+		t.Errorf("ValuesChangelog() for one revision = %q, want %q", single, want)
+	}
+}
+
+func TestDiffValueKeys(t *testing.T) {
+	before := map[string]interface{}{
+		"list":  []interface{}{"a", "b"},
+		"empty": map[string]interface{}{},
+		"same":  "x",
+	}
+	after := map[string]interface{}{
+		"list":  []interface{}{"a", "c"},
+		"empty": map[string]interface{}{"now": "set"},
+		"same":  "x",
+	}
+
+	added, changed, removed := diffValueKeys(before, after)
+	if !reflect.DeepEqual(added, []string{"empty.now"}) {
+		t.Errorf("added = %v, want [empty.now]", added)
+	}
+	if !reflect.DeepEqual(changed, []string{"list"}) {
+		t.Errorf("changed = %v, want [list]", changed)
+	}
+	if !reflect.DeepEqual(removed, []string{"empty"}) {
+		t.Errorf("removed = %v, want [empty]", removed)
+	}
+}
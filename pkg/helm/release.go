@@ -0,0 +1,164 @@
+package helm
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// gzipMagic is the header Helm's storage driver uses to detect compressed payloads
+var gzipMagic = []byte{0x1f, 0x8b, 0x08}
+
+// releaseRecord mirrors the parts of Helm's stored release that are used here
+type releaseRecord struct {
+	Name      string                 `json:"name"`
+	Namespace string                 `json:"namespace"`
+	Version   int                    `json:"version"`
+	Info      releaseInfo            `json:"info"`
+	Chart     chartRecord            `json:"chart"`
+	Config    map[string]interface{} `json:"config"`
+	Manifest  string                 `json:"manifest"`
+	Hooks     []hookRecord           `json:"hooks"`
+}
+
+// releaseInfo mirrors Helm's release.Info
+type releaseInfo struct {
+	Status       string   `json:"status"`
+	Description  string   `json:"description"`
+	Notes        string   `json:"notes"`
+	LastDeployed helmTime `json:"last_deployed"`
+}
+
+// hookRecord mirrors Helm's release.Hook
+type hookRecord struct {
+	Name     string   `json:"name"`
+	Kind     string   `json:"kind"`
+	Path     string   `json:"path"`
+	Manifest string   `json:"manifest"`
+	Events   []string `json:"events"`
+	Weight   int      `json:"weight"`
+}
+
+// helmTime decodes Helm's timestamps, which are stored as "" when unset
+type helmTime struct {
+	time.Time
+}
+
+// UnmarshalJSON implements json.Unmarshaler
+func (t *helmTime) UnmarshalJSON(data []byte) error {
+	if string(data) == `""` || string(data) == "null" {
+		t.Time = time.Time{}
+		return nil
+	}
+	return json.Unmarshal(data, &t.Time)
+}
+
+// chartRecord mirrors the parts of Helm's chart.Chart that are used here
+type chartRecord struct {
+	Metadata ChartMetadata          `json:"metadata"`
+	Values   map[string]interface{} `json:"values"`
+}
+
+// ChartMetadata mirrors the parts of Helm's chart.Metadata (Chart.yaml) that are exported
+type ChartMetadata struct {
+	APIVersion  string   `json:"apiVersion,omitempty"`
+	Name        string   `json:"name"`
+	Version     string   `json:"version"`
+	AppVersion  string   `json:"appVersion,omitempty"`
+	Description string   `json:"description,omitempty"`
+	Type        string   `json:"type,omitempty"`
+	Home        string   `json:"home,omitempty"`
+	Sources     []string `json:"sources,omitempty"`
+	Keywords    []string `json:"keywords,omitempty"`
+}
+
+// decodeReleaseSecret decodes the release stored in a Helm release Secret
+func decodeReleaseSecret(secret corev1.Secret) (*releaseRecord, error) {
+	payload, ok := secret.Data["release"]
+	if !ok {
+		return nil, fmt.Errorf("secret %s has no release data", secret.Name)
+	}
+
+	record, err := decodeRelease(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode release secret %s: %w", secret.Name, err)
+	}
+	return record, nil
+}
+
+// decodeRelease decodes a Helm release payload: base64 encoded, optionally gzipped JSON
+func decodeRelease(payload []byte) (*releaseRecord, error) {
+	data := make([]byte, base64.StdEncoding.DecodedLen(len(payload)))
+	n, err := base64.StdEncoding.Decode(data, payload)
+	if err != nil {
+		return nil, fmt.Errorf("invalid base64 payload: %w", err)
+	}
+	data = data[:n]
+
+	if bytes.HasPrefix(data, gzipMagic) {
+		reader, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("invalid gzip payload: %w", err)
+		}
+		defer func() { _ = reader.Close() }()
+
+		data, err = io.ReadAll(reader)
+		if err != nil {
+			return nil, fmt.Errorf("invalid gzip payload: %w", err)
+		}
+	}
+
+	var record releaseRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		return nil, fmt.Errorf("invalid release JSON: %w", err)
+	}
+	return &record, nil
+}
+
+// toRelease converts a decoded release into the Release summary
+// Chart uses the same name-version format as the CHART column of `helm list`.
+func (r *releaseRecord) toRelease() Release {
+	metadata := r.Chart.Metadata
+	chart := metadata.Name
+	if metadata.Version != "" {
+		chart = fmt.Sprintf("%s-%s", metadata.Name, metadata.Version)
+	}
+
+	return Release{
+		Name:         r.Name,
+		Namespace:    r.Namespace,
+		Chart:        chart,
+		ChartName:    metadata.Name,
+		ChartVersion: metadata.Version,
+		AppVersion:   metadata.AppVersion,
+		Status:       r.Info.Status,
+		Revision:     strconv.Itoa(r.Version),
+		Updated:      r.Info.LastDeployed.Time,
+	}
+}
+
+// toDetails converts a decoded release into ReleaseDetails
+func (r *releaseRecord) toDetails() *ReleaseDetails {
+	hooks := make([]Hook, 0, len(r.Hooks))
+	for _, hook := range r.Hooks {
+		hooks = append(hooks, Hook(hook))
+	}
+
+	return &ReleaseDetails{
+		Release:     r.toRelease(),
+		Description: r.Info.Description,
+		Notes:       r.Info.Notes,
+		Manifest:    r.Manifest,
+		Hooks:       hooks,
+		Metadata:    r.Chart.Metadata,
+		UserValues:  r.Config,
+		ChartValues: r.Chart.Values,
+	}
+}
@@ -0,0 +1,110 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+
+	authorizationv1 "k8s.io/api/authorization/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// AccessCheck is the result of a permission check for a resource type in a namespace
+type AccessCheck struct {
+	Resource  ResourceInfo
+	Namespace string
+	Allowed   bool
+	Reason    string
+}
+
+// CheckListAccess checks whether the current identity may list each resource type in each namespace
+// It issues one SelfSubjectRulesReview per namespace and falls back to a SelfSubjectAccessReview
+// per resource when the server reports the rules as incomplete (e.g. webhook authorizers).
+// Cluster-scoped resources are skipped, matching how exports process namespaces.
+func CheckListAccess(ctx context.Context, client *Client, resources []ResourceInfo, namespaces []string) ([]AccessCheck, error) {
+	var checks []AccessCheck
+	for _, namespace := range namespaces {
+		review, err := client.Clientset.AuthorizationV1().SelfSubjectRulesReviews().Create(ctx, &authorizationv1.SelfSubjectRulesReview{
+			Spec: authorizationv1.SelfSubjectRulesReviewSpec{Namespace: namespace},
+		}, metav1.CreateOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to review rules in namespace %s: %w", namespace, err)
+		}
+
+		for _, resource := range resources {
+			if !resource.Namespaced && namespace != "" {
+				continue
+			}
+
+			check := AccessCheck{Resource: resource, Namespace: namespace}
+			if rulesAllow(review.Status.ResourceRules, "list", resource.Group, resource.Name) {
+				check.Allowed = true
+			} else if review.Status.Incomplete {
+				client.Logger().Debug("rules review incomplete, falling back to an access review", "namespace", namespace, "resource", resource.Name)
+				check.Allowed, check.Reason, err = reviewAccess(ctx, client, "list", resource, namespace)
+				if err != nil {
+					return nil, err
+				}
+			} else {
+				check.Reason = "no RBAC rule allows list"
+			}
+			checks = append(checks, check)
+		}
+	}
+
+	return checks, nil
+}
+
+// reviewAccess issues a SelfSubjectAccessReview for a single verb, resource and namespace
+func reviewAccess(ctx context.Context, client *Client, verb string, resource ResourceInfo, namespace string) (bool, string, error) {
+	review, err := client.Clientset.AuthorizationV1().SelfSubjectAccessReviews().Create(ctx, &authorizationv1.SelfSubjectAccessReview{
+		Spec: authorizationv1.SelfSubjectAccessReviewSpec{
+			ResourceAttributes: &authorizationv1.ResourceAttributes{
+				Namespace: namespace,
+				Verb:      verb,
+				Group:     resource.Group,
+				Version:   resource.Version,
+				Resource:  resource.Name,
+			},
+		},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		return false, "", fmt.Errorf("failed to review access to %s in %s: %w", resource.Name, namespace, err)
+	}
+
+	reason := review.Status.Reason
+	if !review.Status.Allowed && reason == "" {
+		reason = fmt.Sprintf("%s denied", verb)
+	}
+	return review.Status.Allowed, reason, nil
+}
+
+// rulesAllow reports whether any rule grants the verb on the resource
+// Rules restricted to specific resource names never grant list access.
+func rulesAllow(rules []authorizationv1.ResourceRule, verb, group, resource string) bool {
+	for _, rule := range rules {
+		if len(rule.ResourceNames) > 0 {
+			continue
+		}
+		if matchesRule(rule.Verbs, verb) && matchesRule(rule.APIGroups, group) && matchesRule(rule.Resources, resource) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesRule reports whether a rule field contains the value or a wildcard
+func matchesRule(values []string, value string) bool {
+	for _, v := range values {
+		if v == "*" || v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// IsPermissionDenied reports whether a request was refused because the identity is not
+// authorized or could not be authenticated
+func IsPermissionDenied(err error) bool {
+	return apierrors.IsForbidden(err) || apierrors.IsUnauthorized(err)
+}
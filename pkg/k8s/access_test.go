@@ -0,0 +1,151 @@
+package k8s
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	authorizationv1 "k8s.io/api/authorization/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestRulesAllow(t *testing.T) {
+	tests := []struct {
+		name     string
+		rules    []authorizationv1.ResourceRule
+		group    string
+		resource string
+		want     bool
+	}{
+		{
+			name:     "exact match",
+			rules:    []authorizationv1.ResourceRule{{Verbs: []string{"get", "list"}, APIGroups: []string{"apps"}, Resources: []string{"deployments"}}},
+			group:    "apps",
+			resource: "deployments",
+			want:     true,
+		},
+		{
+			name:     "wildcards",
+			rules:    []authorizationv1.ResourceRule{{Verbs: []string{"*"}, APIGroups: []string{"*"}, Resources: []string{"*"}}},
+			group:    "example.com",
+			resource: "widgets",
+			want:     true,
+		},
+		{
+			name:     "wrong group",
+			rules:    []authorizationv1.ResourceRule{{Verbs: []string{"list"}, APIGroups: []string{""}, Resources: []string{"deployments"}}},
+			group:    "apps",
+			resource: "deployments",
+			want:     false,
+		},
+		{
+			name:     "verb not granted",
+			rules:    []authorizationv1.ResourceRule{{Verbs: []string{"get"}, APIGroups: []string{""}, Resources: []string{"secrets"}}},
+			group:    "",
+			resource: "secrets",
+			want:     false,
+		},
+		{
+			name:     "restricted to resource names",
+			rules:    []authorizationv1.ResourceRule{{Verbs: []string{"list"}, APIGroups: []string{""}, Resources: []string{"configmaps"}, ResourceNames: []string{"app-config"}}},
+			group:    "",
+			resource: "configmaps",
+			want:     false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := rulesAllow(tt.rules, "list", tt.group, tt.resource); got != tt.want {
+				t.Errorf("rulesAllow() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckListAccess(t *testing.T) {
+	fakeClient := fake.NewSimpleClientset() //nolint:staticcheck // Using deprecated API for testing purposes
+
+	// "default" grants pods only, "restricted" is incomplete and defers to access reviews
+	fakeClient.PrependReactor("create", "selfsubjectrulesreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		review := action.(k8stesting.CreateAction).GetObject().(*authorizationv1.SelfSubjectRulesReview)
+		switch review.Spec.Namespace {
+		case "default":
+			review.Status.ResourceRules = []authorizationv1.ResourceRule{
+				{Verbs: []string{"list"}, APIGroups: []string{""}, Resources: []string{"pods"}},
+			}
+		case "restricted":
+			review.Status.Incomplete = true
+		}
+		return true, review, nil
+	})
+	fakeClient.PrependReactor("create", "selfsubjectaccessreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		review := action.(k8stesting.CreateAction).GetObject().(*authorizationv1.SelfSubjectAccessReview)
+		review.Status.Allowed = review.Spec.ResourceAttributes.Resource == "deployments"
+		if !review.Status.Allowed {
+			review.Status.Reason = "denied by webhook"
+		}
+		return true, review, nil
+	})
+
+	client := &Client{Clientset: fakeClient}
+	resources := []ResourceInfo{
+		{Name: "pods", Version: "v1", Kind: "Pod", Namespaced: true},
+		{Name: "deployments", Group: "apps", Version: "v1", Kind: "Deployment", Namespaced: true},
+		{Name: "nodes", Version: "v1", Kind: "Node", Namespaced: false},
+	}
+
+	checks, err := CheckListAccess(context.Background(), client, resources, []string{"default", "restricted"})
+	if err != nil {
+		t.Fatalf("CheckListAccess() error = %v", err)
+	}
+
+	want := map[string]bool{
+		"default/pods":           true,
+		"default/deployments":    false,
+		"restricted/pods":        false,
+		"restricted/deployments": true,
+	}
+	if len(checks) != len(want) {
+		t.Fatalf("CheckListAccess() returned %d checks, want %d", len(checks), len(want))
+	}
+	for _, check := range checks {
+		key := check.Namespace + "/" + check.Resource.Name
+		allowed, ok := want[key]
+		if !ok {
+			t.Errorf("unexpected check for %s", key)
+			continue
+		}
+		if check.Allowed != allowed {
+			t.Errorf("%s Allowed = %v, want %v", key, check.Allowed, allowed)
+		}
+		if !check.Allowed && check.Reason == "" {
+			t.Errorf("%s denied without a reason", key)
+		}
+	}
+}
+
+func TestIsPermissionDenied(t *testing.T) {
+	pods := schema.GroupResource{Resource: "pods"}
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"forbidden", apierrors.NewForbidden(pods, "", errors.New("denied")), true},
+		{"unauthorized", apierrors.NewUnauthorized("expired token"), true},
+		{"wrapped", fmt.Errorf("failed to list pods: %w", apierrors.NewForbidden(pods, "", errors.New("denied"))), true},
+		{"not found", apierrors.NewNotFound(pods, "web"), false},
+		{"other", errors.New("connection refused"), false},
+	}
+	for _, tt := range tests {
+		if got := IsPermissionDenied(tt.err); got != tt.want {
+			t.Errorf("IsPermissionDenied(%s) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
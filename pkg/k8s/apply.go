@@ -0,0 +1,184 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// DefaultFieldManager is the field manager used for server-side apply
+const DefaultFieldManager = "manifold-k8s"
+
+// Conflict policies decide what happens when server-side apply reports conflicting field owners
+const (
+	ConflictFail  = "fail"
+	ConflictSkip  = "skip"
+	ConflictForce = "force"
+)
+
+// Apply phases, in the order objects are applied so that dependencies exist first
+const (
+	PhaseCRDs = iota
+	PhaseNamespaces
+	PhaseRBAC
+	PhaseConfig
+	PhaseWorkloads
+)
+
+// phaseNames are the display names of the apply phases
+var phaseNames = []string{"CRDs", "Namespaces", "RBAC", "ConfigMaps/Secrets", "Workloads"}
+
+// phaseByKind assigns kinds to the early phases; every other kind is a workload
+var phaseByKind = map[string]int{
+	"CustomResourceDefinition": PhaseCRDs,
+	"Namespace":                PhaseNamespaces,
+	"ServiceAccount":           PhaseRBAC,
+	"Role":                     PhaseRBAC,
+	"ClusterRole":              PhaseRBAC,
+	"RoleBinding":              PhaseRBAC,
+	"ClusterRoleBinding":       PhaseRBAC,
+	"ConfigMap":                PhaseConfig,
+	"Secret":                   PhaseConfig,
+}
+
+// ApplyOptions configures server-side apply
+type ApplyOptions struct {
+	FieldManager   string
+	ConflictPolicy string
+	DryRun         bool // server-side dry run: validated and admitted, but not persisted
+}
+
+// ApplyItem is an object to apply with the resource it belongs to
+type ApplyItem struct {
+	Object *unstructured.Unstructured
+	GVR    schema.GroupVersionResource
+}
+
+// ValidateConflictPolicy checks a conflict policy
+func ValidateConflictPolicy(policy string) error {
+	switch policy {
+	case ConflictFail, ConflictSkip, ConflictForce:
+		return nil
+	}
+	return fmt.Errorf("invalid conflict policy %q (must be %s, %s or %s)", policy, ConflictFail, ConflictSkip, ConflictForce)
+}
+
+// ApplyPhase returns the phase an object of the given kind is applied in
+func ApplyPhase(kind string) int {
+	if phase, ok := phaseByKind[kind]; ok {
+		return phase
+	}
+	return PhaseWorkloads
+}
+
+// PhaseName returns the display name of an apply phase
+func PhaseName(phase int) string {
+	return phaseNames[phase]
+}
+
+// SortForApply orders items by apply phase, then by namespace, resource and name
+func SortForApply(items []ApplyItem) {
+	sort.SliceStable(items, func(i, j int) bool {
+		a, b := items[i], items[j]
+		if pa, pb := ApplyPhase(a.Object.GetKind()), ApplyPhase(b.Object.GetKind()); pa != pb {
+			return pa < pb
+		}
+		if a.Object.GetNamespace() != b.Object.GetNamespace() {
+			return a.Object.GetNamespace() < b.Object.GetNamespace()
+		}
+		if a.GVR.Resource != b.GVR.Resource {
+			return a.GVR.Resource < b.GVR.Resource
+		}
+		return a.Object.GetName() < b.Object.GetName()
+	})
+}
+
+// ApplyObject applies an object with server-side apply
+// A conflict is returned as an error for the fail and skip policies, while the force policy
+// takes ownership of the conflicting fields; use IsConflict to tell conflicts apart.
+func ApplyObject(ctx context.Context, client *Client, item ApplyItem, opts ApplyOptions) (*unstructured.Unstructured, error) {
+	fieldManager := opts.FieldManager
+	if fieldManager == "" {
+		fieldManager = DefaultFieldManager
+	}
+	applyOpts := metav1.ApplyOptions{
+		FieldManager: fieldManager,
+		Force:        opts.ConflictPolicy == ConflictForce,
+	}
+	if opts.DryRun {
+		applyOpts.DryRun = []string{metav1.DryRunAll}
+	}
+
+	obj := item.Object
+	client.Logger().Debug("applying object", "resource", item.GVR.Resource, "namespace", obj.GetNamespace(), "name", obj.GetName(), "dryRun", opts.DryRun, "force", applyOpts.Force)
+	resource := client.DynamicClient.Resource(item.GVR)
+	if obj.GetNamespace() != "" {
+		return resource.Namespace(obj.GetNamespace()).Apply(ctx, obj.GetName(), obj, applyOpts)
+	}
+	return resource.Apply(ctx, obj.GetName(), obj, applyOpts)
+}
+
+// lastAppliedAnnotation is where kubectl apply keeps the applied configuration of an object
+const lastAppliedAnnotation = "kubectl.kubernetes.io/last-applied-configuration"
+
+// clusterAllocatedFields are fields the cluster fills in, per kind, which are rejected or
+// conflict when applied to another cluster
+var clusterAllocatedFields = map[string][][]string{
+	"Service": {{"spec", "clusterIP"}, {"spec", "clusterIPs"}},
+	"Pod":     {{"spec", "nodeName"}},
+}
+
+// StripClusterFields returns a copy of obj without the fields its source cluster allocated,
+// such as the cluster IPs of a Service, and without the last-applied-configuration annotation
+func StripClusterFields(obj *unstructured.Unstructured) *unstructured.Unstructured {
+	stripped := obj.DeepCopy()
+	for _, path := range clusterAllocatedFields[stripped.GetKind()] {
+		unstructured.RemoveNestedField(stripped.Object, path...)
+	}
+
+	if annotations := stripped.GetAnnotations(); annotations != nil {
+		delete(annotations, lastAppliedAnnotation)
+		if len(annotations) == 0 {
+			annotations = nil
+		}
+		stripped.SetAnnotations(annotations)
+	}
+	return stripped
+}
+
+// ClusterCreated returns why obj is created by the cluster itself, such as the
+// kube-root-ca.crt ConfigMap of every namespace, or "" when it is not
+// Such objects differ between clusters and are recreated by their controllers, so they are not
+// applied.
+func ClusterCreated(obj *unstructured.Unstructured) string {
+	switch obj.GetKind() {
+	case "ConfigMap":
+		if obj.GetName() == "kube-root-ca.crt" {
+			return "published by the root CA controller"
+		}
+	case "Secret":
+		if secretType, _, _ := unstructured.NestedString(obj.Object, "type"); secretType == "kubernetes.io/service-account-token" {
+			return "service account token created by the token controller"
+		}
+	}
+	return ""
+}
+
+// IsConflict reports whether an apply failed because other field managers own the fields
+func IsConflict(err error) bool {
+	return apierrors.IsConflict(err)
+}
+
+// NamespaceObject returns a Namespace object to apply
+func NamespaceObject(name string) ApplyItem {
+	obj := &unstructured.Unstructured{}
+	obj.SetAPIVersion("v1")
+	obj.SetKind("Namespace")
+	obj.SetName(name)
+	return ApplyItem{Object: obj, GVR: schema.GroupVersionResource{Version: "v1", Resource: "namespaces"}}
+}
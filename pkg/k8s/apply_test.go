@@ -0,0 +1,193 @@
+package k8s
+
+import (
+	"context"
+	"testing"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func applyItem(apiVersion, kind, resource, namespace, name string) ApplyItem {
+	obj := &unstructured.Unstructured{}
+	obj.SetAPIVersion(apiVersion)
+	obj.SetKind(kind)
+	obj.SetNamespace(namespace)
+	obj.SetName(name)
+	gv, _ := schema.ParseGroupVersion(apiVersion)
+	return ApplyItem{Object: obj, GVR: gv.WithResource(resource)}
+}
+
+func TestSortForApply(t *testing.T) {
+	items := []ApplyItem{
+		applyItem("apps/v1", "Deployment", "deployments", "default", "web"),
+		applyItem("v1", "Service", "services", "default", "web"),
+		applyItem("v1", "ConfigMap", "configmaps", "default", "web-config"),
+		applyItem("rbac.authorization.k8s.io/v1", "RoleBinding", "rolebindings", "default", "web"),
+		applyItem("v1", "Secret", "secrets", "default", "web-tls"),
+		applyItem("v1", "ServiceAccount", "serviceaccounts", "default", "web"),
+		NamespaceObject("default"),
+		applyItem("apiextensions.k8s.io/v1", "CustomResourceDefinition", "customresourcedefinitions", "", "widgets.example.com"),
+	}
+
+	SortForApply(items)
+
+	want := []string{
+		"CustomResourceDefinition/widgets.example.com",
+		"Namespace/default",
+		"RoleBinding/web",
+		"ServiceAccount/web",
+		"ConfigMap/web-config",
+		"Secret/web-tls",
+		"Deployment/web",
+		"Service/web",
+	}
+	for i, item := range items {
+		if got := item.Object.GetKind() + "/" + item.Object.GetName(); got != want[i] {
+			t.Errorf("item %d = %s, want %s", i, got, want[i])
+		}
+	}
+}
+
+func TestApplyPhase(t *testing.T) {
+	tests := map[string]int{
+		"CustomResourceDefinition": PhaseCRDs,
+		"Namespace":                PhaseNamespaces,
+		"ClusterRoleBinding":       PhaseRBAC,
+		"Secret":                   PhaseConfig,
+		"StatefulSet":              PhaseWorkloads,
+		"Widget":                   PhaseWorkloads,
+	}
+	for kind, want := range tests {
+		if got := ApplyPhase(kind); got != want {
+			t.Errorf("ApplyPhase(%s) = %s, want %s", kind, PhaseName(got), PhaseName(want))
+		}
+	}
+}
+
+func TestValidateConflictPolicy(t *testing.T) {
+	for _, policy := range []string{ConflictFail, ConflictSkip, ConflictForce} {
+		if err := ValidateConflictPolicy(policy); err != nil {
+			t.Errorf("ValidateConflictPolicy(%s) error = %v", policy, err)
+		}
+	}
+	if err := ValidateConflictPolicy("merge"); err == nil {
+		t.Error("ValidateConflictPolicy(merge) expected error")
+	}
+}
+
+func TestStripClusterFields(t *testing.T) {
+	service := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Service",
+		"metadata": map[string]interface{}{
+			"name":        "web",
+			"annotations": map[string]interface{}{lastAppliedAnnotation: "{}"},
+		},
+		"spec": map[string]interface{}{
+			"clusterIP":  "10.96.0.10",
+			"clusterIPs": []interface{}{"10.96.0.10"},
+			"ports":      []interface{}{map[string]interface{}{"port": int64(80)}},
+		},
+	}}
+
+	stripped := StripClusterFields(service)
+	if _, found, _ := unstructured.NestedFieldNoCopy(stripped.Object, "spec", "clusterIP"); found {
+		t.Error("spec.clusterIP was kept")
+	}
+	if _, found, _ := unstructured.NestedFieldNoCopy(stripped.Object, "spec", "clusterIPs"); found {
+		t.Error("spec.clusterIPs was kept")
+	}
+	if _, found, _ := unstructured.NestedFieldNoCopy(stripped.Object, "spec", "ports"); !found {
+		t.Error("spec.ports was removed")
+	}
+	if _, found, _ := unstructured.NestedFieldNoCopy(stripped.Object, "metadata", "annotations"); found {
+		t.Error("empty annotations were kept")
+	}
+	if service.GetAnnotations()[lastAppliedAnnotation] == "" {
+		t.Error("the original object was modified")
+	}
+
+	pod := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Pod",
+		"metadata":   map[string]interface{}{"name": "web"},
+		"spec":       map[string]interface{}{"nodeName": "node-1"},
+	}}
+	if _, found, _ := unstructured.NestedFieldNoCopy(StripClusterFields(pod).Object, "spec", "nodeName"); found {
+		t.Error("spec.nodeName was kept")
+	}
+}
+
+func TestClusterCreated(t *testing.T) {
+	rootCA := applyItem("v1", "ConfigMap", "configmaps", "default", "kube-root-ca.crt").Object
+	config := applyItem("v1", "ConfigMap", "configmaps", "default", "web").Object
+	token := applyItem("v1", "Secret", "secrets", "default", "web-token").Object
+	token.Object["type"] = "kubernetes.io/service-account-token"
+	tls := applyItem("v1", "Secret", "secrets", "default", "web-tls").Object
+	tls.Object["type"] = "kubernetes.io/tls"
+
+	for _, obj := range []*unstructured.Unstructured{rootCA, token} {
+		if ClusterCreated(obj) == "" {
+			t.Errorf("ClusterCreated(%s) = \"\", want a reason", obj.GetName())
+		}
+	}
+	for _, obj := range []*unstructured.Unstructured{config, tls} {
+		if reason := ClusterCreated(obj); reason != "" {
+			t.Errorf("ClusterCreated(%s) = %q, want \"\"", obj.GetName(), reason)
+		}
+	}
+}
+
+func TestApplyObject(t *testing.T) {
+	dynamicClient := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme())
+	var patches []k8stesting.PatchActionImpl
+	dynamicClient.PrependReactor("patch", "*", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		patch := action.(k8stesting.PatchActionImpl)
+		patches = append(patches, patch)
+		if patch.GetName() == "owned" && !*patch.PatchOptions.Force {
+			return true, nil, apierrors.NewConflict(patch.GetResource().GroupResource(), "owned", nil)
+		}
+		return true, &unstructured.Unstructured{}, nil
+	})
+	client := &Client{DynamicClient: dynamicClient}
+	ctx := context.Background()
+
+	// Namespaced object, server-side dry run
+	_, err := ApplyObject(ctx, client, applyItem("v1", "ConfigMap", "configmaps", "payments", "app"), ApplyOptions{DryRun: true})
+	if err != nil {
+		t.Fatalf("ApplyObject() error = %v", err)
+	}
+	patch := patches[0]
+	if patch.GetNamespace() != "payments" || patch.GetPatchType() != "application/apply-patch+yaml" {
+		t.Errorf("unexpected patch: namespace %q, type %q", patch.GetNamespace(), patch.GetPatchType())
+	}
+	if patch.PatchOptions.FieldManager != DefaultFieldManager {
+		t.Errorf("FieldManager = %q, want %q", patch.PatchOptions.FieldManager, DefaultFieldManager)
+	}
+	if len(patch.PatchOptions.DryRun) != 1 || patch.PatchOptions.DryRun[0] != metav1.DryRunAll {
+		t.Errorf("DryRun = %v, want [All]", patch.PatchOptions.DryRun)
+	}
+
+	// Cluster-scoped object
+	if _, err := ApplyObject(ctx, client, NamespaceObject("payments"), ApplyOptions{FieldManager: "restore"}); err != nil {
+		t.Fatalf("ApplyObject() error = %v", err)
+	}
+	if patches[1].GetNamespace() != "" || patches[1].PatchOptions.FieldManager != "restore" {
+		t.Errorf("unexpected namespace patch: %+v", patches[1])
+	}
+
+	// Conflicts are reported unless the force policy is used
+	owned := applyItem("v1", "ConfigMap", "configmaps", "payments", "owned")
+	if _, err := ApplyObject(ctx, client, owned, ApplyOptions{ConflictPolicy: ConflictSkip}); !IsConflict(err) {
+		t.Errorf("ApplyObject() error = %v, want conflict", err)
+	}
+	if _, err := ApplyObject(ctx, client, owned, ApplyOptions{ConflictPolicy: ConflictForce}); err != nil {
+		t.Errorf("ApplyObject() with force error = %v", err)
+	}
+}
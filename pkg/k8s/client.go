@@ -2,14 +2,20 @@ package k8s
 
 import (
 	"fmt"
-	"os"
-	"path/filepath"
+	"log/slog"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
 
 	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
 	"k8s.io/client-go/tools/clientcmd/api"
+
+	// Register the auth provider plugins (OIDC) supported by kubectl
+	_ "k8s.io/client-go/plugin/pkg/client/auth"
 )
 
 // Client wraps Kubernetes clients
@@ -18,36 +24,109 @@ type Client struct {
 	DynamicClient dynamic.Interface
 	RESTConfig    *rest.Config
 	Context       string
+	Namespace     string
+
+	logger *slog.Logger
 }
 
-// LoadKubeConfig loads kubeconfig from the specified path
-// If path is empty, uses default location ($HOME/.kube/config)
-func LoadKubeConfig(kubeconfigPath string) (*api.Config, error) {
-	if kubeconfigPath == "" {
-		home, err := os.UserHomeDir()
-		if err != nil {
-			return nil, fmt.Errorf("failed to get home directory: %w", err)
-		}
-		kubeconfigPath = filepath.Join(home, ".kube", "config")
+// ClientOptions holds kubectl-style overrides applied on top of the selected context
+type ClientOptions struct {
+	// Cluster overrides the kubeconfig cluster used by the context
+	Cluster string
+	// AuthInfo overrides the kubeconfig user used by the context
+	AuthInfo string
+	// Namespace overrides the default namespace of the context
+	Namespace string
+	// ImpersonateUser is the user or ServiceAccount to act as (--as)
+	ImpersonateUser string
+	// ImpersonateGroups are the groups to act as (--as-group)
+	ImpersonateGroups []string
+	// ImpersonateUID is the UID to act as (--as-uid)
+	ImpersonateUID string
+	// Logger receives the diagnostics of the client and of the packages using it
+	Logger *slog.Logger
+	// TraceHTTP logs every API request at debug level
+	TraceHTTP bool
+}
+
+// impersonationConfig returns the rest impersonation settings for these options
+func (o ClientOptions) impersonationConfig() (rest.ImpersonationConfig, error) {
+	if o.ImpersonateUser == "" && (len(o.ImpersonateGroups) > 0 || o.ImpersonateUID != "") {
+		return rest.ImpersonationConfig{}, fmt.Errorf("impersonating groups or a UID requires a user name")
 	}
+	return rest.ImpersonationConfig{
+		UserName: o.ImpersonateUser,
+		UID:      o.ImpersonateUID,
+		Groups:   o.ImpersonateGroups,
+	}, nil
+}
 
-	config, err := clientcmd.LoadFromFile(kubeconfigPath)
+// LoadKubeConfig loads kubeconfig using the same loading rules as kubectl
+// If path is empty, the KUBECONFIG environment variable is honoured (merging
+// all listed files) and $HOME/.kube/config is used as a fallback
+func LoadKubeConfig(kubeconfigPath string) (*api.Config, error) {
+	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
+	loadingRules.ExplicitPath = kubeconfigPath
+
+	config, err := loadingRules.Load()
 	if err != nil {
+		if kubeconfigPath == "" {
+			return nil, fmt.Errorf("failed to load kubeconfig: %w", err)
+		}
 		return nil, fmt.Errorf("failed to load kubeconfig from %s: %w", kubeconfigPath, err)
 	}
 
 	return config, nil
 }
 
-// GetContexts returns a list of all available contexts from kubeconfig
+// GetContexts returns a sorted list of all available contexts from kubeconfig
 func GetContexts(config *api.Config) []string {
 	contexts := make([]string, 0, len(config.Contexts))
 	for name := range config.Contexts {
 		contexts = append(contexts, name)
 	}
+	sort.Strings(contexts)
 	return contexts
 }
 
+// MatchContexts resolves context names and glob patterns (e.g. "prod-*") against kubeconfig
+// Contexts are returned in the order of the patterns, without duplicates. Plain names are
+// passed through as given so that unknown contexts are reported when the client is created.
+func MatchContexts(config *api.Config, patterns []string) ([]string, error) {
+	var matched []string
+	seen := make(map[string]bool)
+	add := func(name string) {
+		if !seen[name] {
+			seen[name] = true
+			matched = append(matched, name)
+		}
+	}
+
+	for _, pattern := range patterns {
+		if !strings.ContainsAny(pattern, "*?[") {
+			add(pattern)
+			continue
+		}
+
+		found := false
+		for _, name := range GetContexts(config) {
+			ok, err := path.Match(pattern, name)
+			if err != nil {
+				return nil, fmt.Errorf("invalid context pattern %q: %w", pattern, err)
+			}
+			if ok {
+				found = true
+				add(name)
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("no contexts match %q", pattern)
+		}
+	}
+
+	return matched, nil
+}
+
 // GetCurrentContext returns the current context from kubeconfig
 func GetCurrentContext(config *api.Config) string {
 	return config.CurrentContext
@@ -55,6 +134,21 @@ func GetCurrentContext(config *api.Config) string {
 
 // NewClient creates a new Kubernetes client for the specified context
 func NewClient(config *api.Config, context string) (*Client, error) {
+	return NewClientWithOptions(config, context, ClientOptions{})
+}
+
+// NewClientWithOptions creates a new Kubernetes client for the specified context
+// with the given overrides applied. An empty context resolves to the current context.
+func NewClientWithOptions(config *api.Config, context string, opts ClientOptions) (*Client, error) {
+	if context == "" {
+		context = config.CurrentContext
+	}
+
+	impersonate, err := opts.impersonationConfig()
+	if err != nil {
+		return nil, err
+	}
+
 	// Validate that the context exists
 	if _, exists := config.Contexts[context]; !exists {
 		return nil, fmt.Errorf("context %s not found in kubeconfig", context)
@@ -63,6 +157,11 @@ func NewClient(config *api.Config, context string) (*Client, error) {
 	// Create a client config for the specific context
 	clientConfig := clientcmd.NewDefaultClientConfig(*config, &clientcmd.ConfigOverrides{
 		CurrentContext: context,
+		Context: api.Context{
+			Cluster:   opts.Cluster,
+			AuthInfo:  opts.AuthInfo,
+			Namespace: opts.Namespace,
+		},
 	})
 
 	// Get the REST config
@@ -70,6 +169,25 @@ func NewClient(config *api.Config, context string) (*Client, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed to create REST config for context %s: %w", context, err)
 	}
+	if impersonate.UserName != "" {
+		restConfig.Impersonate = impersonate
+	}
+
+	logger := opts.Logger
+	if logger == nil {
+		logger = discardLogger
+	}
+	if opts.TraceHTTP {
+		restConfig.Wrap(func(rt http.RoundTripper) http.RoundTripper {
+			return &tracingRoundTripper{next: rt, logger: logger}
+		})
+	}
+
+	// Resolve the default namespace for this context
+	namespace, _, err := clientConfig.Namespace()
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve namespace for context %s: %w", context, err)
+	}
 
 	// Create the standard clientset
 	clientset, err := kubernetes.NewForConfig(restConfig)
@@ -83,10 +201,30 @@ func NewClient(config *api.Config, context string) (*Client, error) {
 		return nil, fmt.Errorf("failed to create dynamic client: %w", err)
 	}
 
+	logger.Debug("created client", "server", restConfig.Host, "namespace", namespace)
 	return &Client{
 		Clientset:     clientset,
 		DynamicClient: dynamicClient,
 		RESTConfig:    restConfig,
 		Context:       context,
+		Namespace:     namespace,
+		logger:        logger,
 	}, nil
 }
+
+// Identity returns a human-readable description of the identity used for API requests
+func (c *Client) Identity() string {
+	if c.RESTConfig == nil || c.RESTConfig.Impersonate.UserName == "" {
+		return "kubeconfig credentials"
+	}
+
+	impersonate := c.RESTConfig.Impersonate
+	identity := fmt.Sprintf("impersonating %s", impersonate.UserName)
+	if impersonate.UID != "" {
+		identity += fmt.Sprintf(" (uid %s)", impersonate.UID)
+	}
+	if len(impersonate.Groups) > 0 {
+		identity += fmt.Sprintf(" with groups %s", strings.Join(impersonate.Groups, ", "))
+	}
+	return identity
+}
@@ -3,7 +3,10 @@ package k8s
 import (
 	"os"
 	"path/filepath"
+	"reflect"
 	"testing"
+
+	"k8s.io/client-go/tools/clientcmd/api"
 )
 
 func TestLoadKubeConfig(t *testing.T) {
@@ -336,3 +339,293 @@ users:
 		t.Error("NewClient() expected error for invalid server URL, got nil")
 	}
 }
+
+func TestLoadKubeConfig_MergesKUBECONFIG(t *testing.T) {
+	tmpDir := t.TempDir()
+	first := filepath.Join(tmpDir, "first")
+	second := filepath.Join(tmpDir, "second")
+	firstContent := `apiVersion: v1
+kind: Config
+clusters:
+- cluster:
+    server: https://cluster1:6443
+  name: cluster1
+contexts:
+- context:
+    cluster: cluster1
+    user: user1
+  name: context1
+current-context: context1
+users:
+- name: user1
+  user:
+    token: token1
+`
+	secondContent := `apiVersion: v1
+kind: Config
+clusters:
+- cluster:
+    server: https://cluster2:6443
+  name: cluster2
+contexts:
+- context:
+    cluster: cluster2
+    user: user2
+    namespace: team-b
+  name: context2
+current-context: context2
+users:
+- name: user2
+  user:
+    token: token2
+`
+	if err := os.WriteFile(first, []byte(firstContent), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(second, []byte(secondContent), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("KUBECONFIG", first+string(os.PathListSeparator)+second)
+
+	config, err := LoadKubeConfig("")
+	if err != nil {
+		t.Fatalf("LoadKubeConfig() error = %v", err)
+	}
+
+	contexts := GetContexts(config)
+	if len(contexts) != 2 || contexts[0] != "context1" || contexts[1] != "context2" {
+		t.Errorf("GetContexts() = %v, want [context1 context2]", contexts)
+	}
+
+	// The first file that sets current-context wins, as in kubectl
+	if got := GetCurrentContext(config); got != "context1" {
+		t.Errorf("GetCurrentContext() = %v, want context1", got)
+	}
+
+	client, err := NewClient(config, "context2")
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	if client.RESTConfig.Host != "https://cluster2:6443" {
+		t.Errorf("RESTConfig.Host = %s, want https://cluster2:6443", client.RESTConfig.Host)
+	}
+	if client.Namespace != "team-b" {
+		t.Errorf("Namespace = %s, want team-b", client.Namespace)
+	}
+}
+
+func TestNewClientWithOptions(t *testing.T) {
+	tmpDir := t.TempDir()
+	kubeconfigPath := filepath.Join(tmpDir, "config")
+	content := `apiVersion: v1
+kind: Config
+clusters:
+- cluster:
+    server: https://cluster1:6443
+  name: cluster1
+- cluster:
+    server: https://cluster2:6443
+  name: cluster2
+contexts:
+- context:
+    cluster: cluster1
+    user: user1
+  name: context1
+current-context: context1
+users:
+- name: user1
+  user:
+    token: token1
+- name: user2
+  user:
+    token: token2
+`
+	if err := os.WriteFile(kubeconfigPath, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := LoadKubeConfig(kubeconfigPath)
+	if err != nil {
+		t.Fatalf("LoadKubeConfig() error = %v", err)
+	}
+
+	tests := []struct {
+		name          string
+		context       string
+		opts          ClientOptions
+		wantHost      string
+		wantToken     string
+		wantNamespace string
+		wantErr       bool
+	}{
+		{
+			name:          "no overrides",
+			context:       "context1",
+			wantHost:      "https://cluster1:6443",
+			wantToken:     "token1",
+			wantNamespace: "default",
+		},
+		{
+			name:          "empty context resolves to current context",
+			context:       "",
+			wantHost:      "https://cluster1:6443",
+			wantToken:     "token1",
+			wantNamespace: "default",
+		},
+		{
+			name:          "cluster, user and namespace overrides",
+			context:       "context1",
+			opts:          ClientOptions{Cluster: "cluster2", AuthInfo: "user2", Namespace: "apps"},
+			wantHost:      "https://cluster2:6443",
+			wantToken:     "token2",
+			wantNamespace: "apps",
+		},
+		{
+			name:    "unknown cluster override",
+			context: "context1",
+			opts:    ClientOptions{Cluster: "missing"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, err := NewClientWithOptions(config, tt.context, tt.opts)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewClientWithOptions() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if client.Context != "context1" {
+				t.Errorf("Context = %s, want context1", client.Context)
+			}
+			if client.RESTConfig.Host != tt.wantHost {
+				t.Errorf("RESTConfig.Host = %s, want %s", client.RESTConfig.Host, tt.wantHost)
+			}
+			if client.RESTConfig.BearerToken != tt.wantToken {
+				t.Errorf("RESTConfig.BearerToken = %s, want %s", client.RESTConfig.BearerToken, tt.wantToken)
+			}
+			if client.Namespace != tt.wantNamespace {
+				t.Errorf("Namespace = %s, want %s", client.Namespace, tt.wantNamespace)
+			}
+		})
+	}
+}
+
+func TestNewClientWithOptions_Impersonation(t *testing.T) {
+	tmpDir := t.TempDir()
+	kubeconfigPath := filepath.Join(tmpDir, "config")
+	content := `apiVersion: v1
+kind: Config
+clusters:
+- cluster:
+    server: https://localhost:6443
+  name: test-cluster
+contexts:
+- context:
+    cluster: test-cluster
+    user: test-user
+  name: test-context
+current-context: test-context
+users:
+- name: test-user
+  user:
+    token: test-token
+`
+	if err := os.WriteFile(kubeconfigPath, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := LoadKubeConfig(kubeconfigPath)
+	if err != nil {
+		t.Fatalf("LoadKubeConfig() error = %v", err)
+	}
+
+	t.Run("no impersonation", func(t *testing.T) {
+		client, err := NewClientWithOptions(config, "test-context", ClientOptions{})
+		if err != nil {
+			t.Fatalf("NewClientWithOptions() error = %v", err)
+		}
+		if client.RESTConfig.Impersonate.UserName != "" {
+			t.Errorf("Impersonate.UserName = %s, want empty", client.RESTConfig.Impersonate.UserName)
+		}
+		if got := client.Identity(); got != "kubeconfig credentials" {
+			t.Errorf("Identity() = %s, want kubeconfig credentials", got)
+		}
+	})
+
+	t.Run("user, groups and uid", func(t *testing.T) {
+		client, err := NewClientWithOptions(config, "test-context", ClientOptions{
+			ImpersonateUser:   "system:serviceaccount:default:backup",
+			ImpersonateGroups: []string{"auditors", "viewers"},
+			ImpersonateUID:    "1234",
+		})
+		if err != nil {
+			t.Fatalf("NewClientWithOptions() error = %v", err)
+		}
+		impersonate := client.RESTConfig.Impersonate
+		if impersonate.UserName != "system:serviceaccount:default:backup" {
+			t.Errorf("Impersonate.UserName = %s", impersonate.UserName)
+		}
+		if impersonate.UID != "1234" {
+			t.Errorf("Impersonate.UID = %s, want 1234", impersonate.UID)
+		}
+		if len(impersonate.Groups) != 2 {
+			t.Errorf("Impersonate.Groups = %v, want 2 groups", impersonate.Groups)
+		}
+		want := "impersonating system:serviceaccount:default:backup (uid 1234) with groups auditors, viewers"
+		if got := client.Identity(); got != want {
+			t.Errorf("Identity() = %s, want %s", got, want)
+		}
+	})
+
+	t.Run("groups without user", func(t *testing.T) {
+		_, err := NewClientWithOptions(config, "test-context", ClientOptions{
+			ImpersonateGroups: []string{"auditors"},
+		})
+		if err == nil {
+			t.Error("NewClientWithOptions() expected error for groups without user, got nil")
+		}
+	})
+}
+
+func TestClientIdentity_NilRESTConfig(t *testing.T) {
+	client := &Client{}
+	if got := client.Identity(); got != "kubeconfig credentials" {
+		t.Errorf("Identity() = %s, want kubeconfig credentials", got)
+	}
+}
+
+func TestMatchContexts(t *testing.T) {
+	config := api.NewConfig()
+	for _, name := range []string{"prod-eu", "prod-us", "staging", "dev"} {
+		config.Contexts[name] = &api.Context{Cluster: name}
+	}
+
+	tests := []struct {
+		name     string
+		patterns []string
+		want     []string
+		wantErr  bool
+	}{
+		{name: "plain names keep their order", patterns: []string{"staging", "dev"}, want: []string{"staging", "dev"}},
+		{name: "glob", patterns: []string{"prod-*"}, want: []string{"prod-eu", "prod-us"}},
+		{name: "glob and name without duplicates", patterns: []string{"prod-eu", "prod-*", "dev"}, want: []string{"prod-eu", "prod-us", "dev"}},
+		{name: "unknown plain name is passed through", patterns: []string{"missing"}, want: []string{"missing"}},
+		{name: "glob without matches", patterns: []string{"qa-*"}, wantErr: true},
+		{name: "invalid glob", patterns: []string{"prod-["}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := MatchContexts(config, tt.patterns)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("MatchContexts() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("MatchContexts() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,53 @@
+package k8s
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/discovery/cached/disk"
+	"k8s.io/client-go/rest"
+)
+
+// DefaultDiscoveryCacheTTL matches the lifetime kubectl uses for its discovery cache
+const DefaultDiscoveryCacheTTL = 6 * time.Hour
+
+// unsafeCacheDirChars matches characters that are replaced when deriving a cache directory from a host
+var unsafeCacheDirChars = regexp.MustCompile(`[^(\w/.)]`)
+
+// DefaultCacheDir returns the default cache directory ($HOME/.kube/cache), shared with kubectl
+func DefaultCacheDir() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return filepath.Join(os.TempDir(), ".kube", "cache")
+	}
+	return filepath.Join(home, ".kube", "cache")
+}
+
+// discoveryCacheDir returns the per-server discovery cache directory, keyed by the server URL
+func discoveryCacheDir(cacheDir, host string) string {
+	// Strip the scheme and replace anything that isn't safe in a path, as kubectl does
+	schemelessHost := strings.Replace(strings.Replace(host, "https://", "", 1), "http://", "", 1)
+	return filepath.Join(cacheDir, "discovery", unsafeCacheDirChars.ReplaceAllString(schemelessHost, "_"))
+}
+
+// NewCachedDiscoveryClient returns a discovery client that caches API groups and resources
+// on disk under cacheDir for the given TTL
+func NewCachedDiscoveryClient(restConfig *rest.Config, cacheDir string, ttl time.Duration) (discovery.CachedDiscoveryInterface, error) {
+	if restConfig == nil {
+		return nil, fmt.Errorf("no REST config available for discovery")
+	}
+
+	discoveryDir := discoveryCacheDir(cacheDir, restConfig.Host)
+	httpCacheDir := filepath.Join(cacheDir, "http")
+
+	client, err := disk.NewCachedDiscoveryClientForConfig(restConfig, discoveryDir, httpCacheDir, ttl)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cached discovery client: %w", err)
+	}
+	return client, nil
+}
@@ -0,0 +1,122 @@
+package k8s
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/rest"
+)
+
+func TestDiscoveryCacheDir(t *testing.T) {
+	tests := []struct {
+		name string
+		host string
+		want string
+	}{
+		{
+			name: "https host with port",
+			host: "https://my-cluster.example.com:6443",
+			want: filepath.Join("/cache", "discovery", "my_cluster.example.com_6443"),
+		},
+		{
+			name: "http host with path",
+			host: "http://localhost:8080/k8s",
+			want: filepath.Join("/cache", "discovery", "localhost_8080", "k8s"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := discoveryCacheDir("/cache", tt.host); got != tt.want {
+				t.Errorf("discoveryCacheDir() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+// newDiscoveryServer serves a minimal legacy discovery API and counts requests
+func newDiscoveryServer(t *testing.T, requests *int32) *httptest.Server {
+	responses := map[string]interface{}{
+		"/api":  &metav1.APIVersions{Versions: []string{"v1"}},
+		"/apis": &metav1.APIGroupList{},
+		"/api/v1": &metav1.APIResourceList{
+			GroupVersion: "v1",
+			APIResources: []metav1.APIResource{
+				{Name: "pods", Kind: "Pod", Namespaced: true, Verbs: []string{"get", "list"}},
+			},
+		},
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(requests, 1)
+		resp, ok := responses[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(resp)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestNewCachedDiscoveryClient(t *testing.T) {
+	var requests int32
+	server := newDiscoveryServer(t, &requests)
+	cacheDir := t.TempDir()
+	restConfig := &rest.Config{Host: server.URL}
+
+	client, err := NewCachedDiscoveryClient(restConfig, cacheDir, time.Hour)
+	if err != nil {
+		t.Fatalf("NewCachedDiscoveryClient() error = %v", err)
+	}
+
+	resources, err := DiscoverResources(client)
+	if err != nil {
+		t.Fatalf("DiscoverResources() error = %v", err)
+	}
+	if len(resources) != 1 || resources[0].Name != "pods" {
+		t.Fatalf("DiscoverResources() = %v, want [pods]", resources)
+	}
+
+	// The discovery documents must be cached on disk for this server
+	if _, err := os.Stat(discoveryCacheDir(cacheDir, server.URL)); err != nil {
+		t.Fatalf("discovery cache directory not created: %v", err)
+	}
+
+	// A second client for the same server is served from the cache
+	atomic.StoreInt32(&requests, 0)
+	client, err = NewCachedDiscoveryClient(restConfig, cacheDir, time.Hour)
+	if err != nil {
+		t.Fatalf("NewCachedDiscoveryClient() error = %v", err)
+	}
+	if _, err := DiscoverResources(client); err != nil {
+		t.Fatalf("DiscoverResources() error = %v", err)
+	}
+	if got := atomic.LoadInt32(&requests); got != 0 {
+		t.Errorf("cached discovery made %d requests, want 0", got)
+	}
+
+	// Invalidating the cache forces a refresh from the server
+	client.Invalidate()
+	if _, err := DiscoverResources(client); err != nil {
+		t.Fatalf("DiscoverResources() error = %v", err)
+	}
+	if got := atomic.LoadInt32(&requests); got == 0 {
+		t.Error("invalidated discovery made no requests, want a refresh")
+	}
+}
+
+func TestNewCachedDiscoveryClient_NilConfig(t *testing.T) {
+	if _, err := NewCachedDiscoveryClient(nil, t.TempDir(), time.Hour); err == nil {
+		t.Error("NewCachedDiscoveryClient() expected error for nil config, got nil")
+	}
+}
@@ -0,0 +1,37 @@
+package k8s
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// discardLogger is the logger of clients created without one
+var discardLogger = slog.New(slog.DiscardHandler)
+
+// Logger returns the logger of the client, which discards records when none was set
+func (c *Client) Logger() *slog.Logger {
+	if c.logger == nil {
+		return discardLogger
+	}
+	return c.logger
+}
+
+// tracingRoundTripper logs every API request with its status and duration at debug level
+// Only the method and URL are logged; headers carrying credentials are left out.
+type tracingRoundTripper struct {
+	next   http.RoundTripper
+	logger *slog.Logger
+}
+
+func (t *tracingRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	attrs := []any{"method", req.Method, "url", req.URL.String(), "duration", time.Since(start)}
+	if err != nil {
+		t.logger.Debug("HTTP request failed", append(attrs, "error", err)...)
+		return resp, err
+	}
+	t.logger.Debug("HTTP request", append(attrs, "status", resp.StatusCode)...)
+	return resp, nil
+}
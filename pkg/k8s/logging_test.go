@@ -0,0 +1,70 @@
+package k8s
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+func TestNewClientWithOptions_TraceHTTP(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"major":"1","minor":"35","gitVersion":"v1.35.0"}`))
+	}))
+	defer server.Close()
+
+	config := api.NewConfig()
+	config.Clusters["test-cluster"] = &api.Cluster{Server: server.URL}
+	config.AuthInfos["test-user"] = &api.AuthInfo{Token: "secret-token"}
+	config.Contexts["test-context"] = &api.Context{Cluster: "test-cluster", AuthInfo: "test-user"}
+
+	var logs bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	client, err := NewClientWithOptions(config, "test-context", ClientOptions{Logger: logger, TraceHTTP: true})
+	if err != nil {
+		t.Fatalf("NewClientWithOptions() error = %v", err)
+	}
+	if client.Logger() != logger {
+		t.Error("Logger() should return the logger of the options")
+	}
+	if _, err := client.Clientset.Discovery().RESTClient().Get().AbsPath("/version").DoRaw(context.Background()); err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+
+	output := logs.String()
+	for _, want := range []string{`msg="HTTP request"`, "method=GET", server.URL + "/version", "status=200"} {
+		if !strings.Contains(output, want) {
+			t.Errorf("trace missing %q:\n%s", want, output)
+		}
+	}
+	if strings.Contains(output, "secret-token") {
+		t.Errorf("trace should not contain credentials:\n%s", output)
+	}
+}
+
+func TestNewClientWithOptions_NoTrace(t *testing.T) {
+	config := api.NewConfig()
+	config.Clusters["test-cluster"] = &api.Cluster{Server: "https://localhost:6443"}
+	config.Contexts["test-context"] = &api.Context{Cluster: "test-cluster"}
+
+	client, err := NewClientWithOptions(config, "test-context", ClientOptions{})
+	if err != nil {
+		t.Fatalf("NewClientWithOptions() error = %v", err)
+	}
+	if client.RESTConfig.WrapTransport != nil {
+		t.Error("requests should not be traced without TraceHTTP")
+	}
+	if client.Logger() == nil {
+		t.Error("Logger() should discard records when no logger was set")
+	}
+	if (&Client{}).Logger() == nil {
+		t.Error("Logger() of a client built without NewClient should not be nil")
+	}
+}
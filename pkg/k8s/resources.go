@@ -37,6 +37,40 @@ func (r ResourceInfo) GroupVersionResource() schema.GroupVersionResource {
 	}
 }
 
+// DiscoveryFailure describes an API group-version that could not be discovered
+type DiscoveryFailure struct {
+	GroupVersion string
+	Err          error
+}
+
+// PartialDiscoveryError is returned together with the discovered resources when
+// some API group-versions could not be discovered, e.g. because an aggregated
+// APIService such as metrics-server is unavailable
+type PartialDiscoveryError struct {
+	Failures []DiscoveryFailure
+}
+
+// Error implements the error interface
+func (e *PartialDiscoveryError) Error() string {
+	groupVersions := make([]string, len(e.Failures))
+	for i, failure := range e.Failures {
+		groupVersions[i] = failure.GroupVersion
+	}
+	return fmt.Sprintf("unable to discover %d API group-version(s): %s", len(e.Failures), strings.Join(groupVersions, ", "))
+}
+
+// newPartialDiscoveryError converts a group discovery failure into a PartialDiscoveryError
+func newPartialDiscoveryError(err *discovery.ErrGroupDiscoveryFailed) *PartialDiscoveryError {
+	failures := make([]DiscoveryFailure, 0, len(err.Groups))
+	for gv, groupErr := range err.Groups {
+		failures = append(failures, DiscoveryFailure{GroupVersion: gv.String(), Err: groupErr})
+	}
+	sort.Slice(failures, func(i, j int) bool {
+		return failures[i].GroupVersion < failures[j].GroupVersion
+	})
+	return &PartialDiscoveryError{Failures: failures}
+}
+
 // excludedResources is a list of resource types to exclude
 var excludedResources = map[string]bool{
 	"persistentvolumes":      true,
@@ -67,14 +101,19 @@ func shouldExcludeResource(resourceName string) bool {
 
 // DiscoverResources discovers all available Kubernetes resources
 // It excludes PersistentVolumes and PersistentVolumeClaims
+// If some API groups could not be discovered, the resources that were found are
+// returned together with a *PartialDiscoveryError listing the failed group-versions
 func DiscoverResources(discoveryClient discovery.DiscoveryInterface) ([]ResourceInfo, error) {
 	// Get all API resource lists
+	var partialErr *PartialDiscoveryError
 	_, apiResourceLists, err := discoveryClient.ServerGroupsAndResources()
 	if err != nil {
-		// Ignore partial errors, as some API groups may not be available
-		if !discovery.IsGroupDiscoveryFailedError(err) {
+		groupErr, ok := err.(*discovery.ErrGroupDiscoveryFailed)
+		if !ok {
 			return nil, fmt.Errorf("failed to discover resources: %w", err)
 		}
+		// Keep the resources that were discovered and report the failed groups
+		partialErr = newPartialDiscoveryError(groupErr)
 	}
 
 	var resources []ResourceInfo
@@ -124,6 +163,9 @@ func DiscoverResources(discoveryClient discovery.DiscoveryInterface) ([]Resource
 	// Sort resources by priority
 	sortResourcesByPriority(resources)
 
+	if partialErr != nil {
+		return resources, partialErr
+	}
 	return resources, nil
 }
 
@@ -2,11 +2,13 @@ package k8s
 
 import (
 	"context"
+	"errors"
 	"testing"
 
 	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
 	fakediscovery "k8s.io/client-go/discovery/fake"
 	"k8s.io/client-go/kubernetes/fake"
 )
@@ -402,3 +404,51 @@ func v1Namespace(name string) *v1.Namespace {
 		},
 	}
 }
+
+// partialDiscovery returns resources together with a group discovery failure
+type partialDiscovery struct {
+	discovery.DiscoveryInterface
+	resources []*metav1.APIResourceList
+	failed    map[schema.GroupVersion]error
+}
+
+func (p *partialDiscovery) ServerGroupsAndResources() ([]*metav1.APIGroup, []*metav1.APIResourceList, error) {
+	return nil, p.resources, &discovery.ErrGroupDiscoveryFailed{Groups: p.failed}
+}
+
+func TestDiscoverResources_PartialFailure(t *testing.T) {
+	client := &partialDiscovery{
+		resources: []*metav1.APIResourceList{
+			{
+				GroupVersion: "v1",
+				APIResources: []metav1.APIResource{
+					{Name: "pods", Kind: "Pod", Namespaced: true, Verbs: []string{"get", "list"}},
+				},
+			},
+		},
+		failed: map[schema.GroupVersion]error{
+			{Group: "metrics.k8s.io", Version: "v1beta1"}:   errors.New("the server is currently unable to handle the request"),
+			{Group: "custom.metrics.k8s.io", Version: "v1"}: errors.New("service unavailable"),
+		},
+	}
+
+	resources, err := DiscoverResources(client)
+	if len(resources) != 1 || resources[0].Name != "pods" {
+		t.Errorf("DiscoverResources() resources = %v, want [pods]", resources)
+	}
+
+	var partialErr *PartialDiscoveryError
+	if !errors.As(err, &partialErr) {
+		t.Fatalf("DiscoverResources() error = %v, want *PartialDiscoveryError", err)
+	}
+	if len(partialErr.Failures) != 2 {
+		t.Fatalf("Failures = %v, want 2 entries", partialErr.Failures)
+	}
+	if partialErr.Failures[0].GroupVersion != "custom.metrics.k8s.io/v1" || partialErr.Failures[1].GroupVersion != "metrics.k8s.io/v1beta1" {
+		t.Errorf("Failures not sorted by group-version: %v", partialErr.Failures)
+	}
+	want := "unable to discover 2 API group-version(s): custom.metrics.k8s.io/v1, metrics.k8s.io/v1beta1"
+	if err.Error() != want {
+		t.Errorf("Error() = %s, want %s", err.Error(), want)
+	}
+}